@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// targetGroup is a named group of target sequences given a fixed share of a chimeric construct
+type targetGroup struct {
+	name    string
+	members []int // indices of the group's target sequences
+	length  int   // segment length (nt)
+}
+
+// maxChimeraGroups is the most groups a chimeric construct can be assembled from, as every order of their segments may
+// be searched
+const maxChimeraGroups = 8
+
+// loadTargetGroups reads a tab-separated file of target header and group name.  Every target must be assigned to a group.
+// Groups are returned in the order they first appear, and there must be 2 to maxChimeraGroups of them.  Blank lines and
+// lines starting with '#' are skipped.
+func loadTargetGroups(fileName string, ref []*HeaderRef) ([]*targetGroup, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening groups file: %v", err)
+	}
+	defer f.Close()
+
+	targetIndices := make(map[string][]int)
+	for i, hr := range ref {
+		targetIndices[hr.Header] = append(targetIndices[hr.Header], i)
+	}
+	assigned := make([]bool, len(ref))
+	var groups []*targetGroup
+	groupIndices := make(map[string]int)
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+			return nil, fmt.Errorf("groups file line %d: expected header<TAB>group", lineNo)
+		}
+		indices, ok := targetIndices[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("groups file line %d: header '%s' not present in target file", lineNo, fields[0])
+		}
+		name := strings.TrimSpace(fields[1])
+		g, ok := groupIndices[name]
+		if !ok {
+			g = len(groups)
+			groupIndices[name] = g
+			groups = append(groups, &targetGroup{name: name})
+		}
+		for _, i := range indices {
+			if assigned[i] {
+				return nil, fmt.Errorf("groups file line %d: header '%s' assigned to more than one group", lineNo, fields[0])
+			}
+			assigned[i] = true
+			groups[g].members = append(groups[g].members, i)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, a := range assigned {
+		if !a {
+			return nil, fmt.Errorf("target '%s' is not assigned to a group", ref[i].Header)
+		}
+	}
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("a chimeric construct needs at least 2 groups (%d found)", len(groups))
+	}
+	if len(groups) > maxChimeraGroups {
+		return nil, fmt.Errorf("a chimeric construct can have at most %d groups (%d found)", maxChimeraGroups, len(groups))
+	}
+	return groups, nil
+}
+
+// setGroupLengths sets the segment length of each group from a comma-separated list of group=length pairs.  With an empty
+// list the construct length is split evenly between groups (earlier groups take any remainder).  Lengths must sum to the
+// construct length, and each must be at least the kmer length.
+func setGroupLengths(groups []*targetGroup, spec string, constructLen int, kmerLen int) error {
+	if spec == "" {
+		for i, g := range groups {
+			g.length = constructLen / len(groups)
+			if i < constructLen%len(groups) {
+				g.length++
+			}
+		}
+	} else {
+		lengths := make(map[string]int)
+		for _, pair := range strings.Split(spec, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("group length '%s' must be group=length", pair)
+			}
+			length, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return fmt.Errorf("group length '%s' must be an integer", pair)
+			}
+			lengths[strings.TrimSpace(parts[0])] = length
+		}
+		for _, g := range groups {
+			length, ok := lengths[g.name]
+			if !ok {
+				return fmt.Errorf("no length given for group '%s'", g.name)
+			}
+			g.length = length
+			delete(lengths, g.name)
+		}
+		for name := range lengths {
+			return fmt.Errorf("length given for unknown group '%s'", name)
+		}
+	}
+	total := 0
+	for _, g := range groups {
+		if g.length < kmerLen {
+			return fmt.Errorf("group '%s' segment length (%d) must be >= kmer length (%d)", g.name, g.length, kmerLen)
+		}
+		total += g.length
+	}
+	if total != constructLen {
+		return fmt.Errorf("group segment lengths sum to %d, not the construct length (%d)", total, constructLen)
+	}
+	return nil
+}
+
+// groupKmers returns the table of kmers present in a group's targets, with target j of the table being members[j].  Kmers
+// are added in goodKmers' row order, so the table's rows are in kmer order too.
+func groupKmers(goodKmers *kmerTable, members []int) *kmerTable {
+	kmers := newKmerTable(goodKmers.kmerLen, len(members))
+	for row, key := range goodKmers.keys {
+		if goodKmers.removed[row] {
+			continue
+		}
+		for j, i := range members {
+			if goodKmers.members[row*goodKmers.words+i/64]&(1<<uint(i%64)) != 0 {
+				kmers.add(key, j)
+			}
+		}
+	}
+	return kmers
+}
+
+// subsetFloats returns the values at the given indices (nil for a nil slice)
+func subsetFloats(vals []float64, indices []int) []float64 {
+	if vals == nil {
+		return nil
+	}
+	sub := make([]float64, len(indices))
+	for j, i := range indices {
+		sub[j] = vals[i]
+	}
+	return sub
+}
+
+// subsetInts returns the values at the given indices (nil for a nil slice)
+func subsetInts(vals []int, indices []int) []int {
+	if vals == nil {
+		return nil
+	}
+	sub := make([]int, len(indices))
+	for j, i := range indices {
+		sub[j] = vals[i]
+	}
+	return sub
+}
+
+// junctionKmers returns the kmers spanning the join of segment a followed by segment b
+func junctionKmers(a string, b string, kmerLen int) []string {
+	joined := a[len(a)-kmerLen+1:] + b[:kmerLen-1]
+	kmers := make([]string, 0, kmerLen-1)
+	for i := 0; i <= len(joined)-kmerLen; i++ {
+		kmers = append(kmers, joined[i:i+kmerLen])
+	}
+	return kmers
+}
+
+// chimeraJunctionKmers returns every kmer that could span a join between candidate segments of different groups
+func chimeraJunctionKmers(candidates [][]*construct, kmerLen int) []string {
+	seen := make(map[string]struct{})
+	var kmers []string
+	for g, groupCands := range candidates {
+		for h, nextCands := range candidates {
+			if g == h {
+				continue
+			}
+			for _, a := range groupCands {
+				for _, b := range nextCands {
+					for _, kmer := range junctionKmers(a.seq, b.seq, kmerLen) {
+						if _, ok := seen[kmer]; !ok {
+							seen[kmer] = struct{}{}
+							kmers = append(kmers, kmer)
+						}
+					}
+				}
+			}
+		}
+	}
+	return kmers
+}
+
+// chimera is an assembled chimeric construct - an ordering of groups and a candidate segment for each
+type chimera struct {
+	order  []int // group indices in construct order
+	choice []int // chosen candidate segment for each group
+	seq    string
+}
+
+// assembleChimera chooses a candidate segment for each group, and an order of groups, so that no junction kmer matches
+// an off-target and the joined construct meets any composition constraints.  The combination with the highest total
+// segment score is returned, preferring the given group order and better-ranked candidates on ties.  As the total score
+// doesn't depend on the order, choices of candidates are tried best first and the orders of each searched until one is
+// clean.
+//
+// Args:
+//
+//	candidates: Candidate segments for each group, best first.
+//	otJunctionKmers: Junction kmers matching an off-target.
+//	constraints: Composition constraints on the joined construct (nil for none).
+//	kmerLen: The kmer length.
+//
+// Returns:
+//
+//	The best chimera without off-target junction kmers that meets the constraints, or nil if every combination has an
+//	off-target junction kmer or breaks a constraint.
+func assembleChimera(candidates [][]*construct, otJunctionKmers map[string]struct{}, constraints *seqConstraints, kmerLen int) *chimera {
+	choices := newChoiceQueue(candidates)
+	for {
+		tied := choices.nextTied()
+		if tied == nil {
+			return nil
+		}
+		order := make([]int, len(candidates))
+		for i := range order {
+			order[i] = i
+		}
+		for {
+			for _, choice := range tied {
+				if !cleanJunctions(candidates, order, choice, otJunctionKmers, kmerLen) {
+					continue
+				}
+				var sb strings.Builder
+				for _, g := range order {
+					sb.WriteString(candidates[g][choice[g]].seq)
+				}
+				if constraints.satisfied(sb.String()) {
+					return &chimera{order: order, choice: choice, seq: sb.String()}
+				}
+			}
+			if !nextPermutation(order) {
+				break
+			}
+		}
+	}
+}
+
+// choiceQueue yields choices of a candidate for each group in order of total segment score, best first
+type choiceQueue struct {
+	candidates [][]*construct
+	ranked     [][]int // each group's candidates, by score (best first, keeping their order on ties)
+	pending    choiceHeap
+}
+
+// queuedChoice is a choice of the rank[g]'th ranked candidate for each group g.  Only ranks from pivot on are
+// increased to give the next choices, so each choice is queued once.
+type queuedChoice struct {
+	rank  []int
+	pivot int
+	score float64
+}
+
+// newChoiceQueue returns a queue of the choices of candidates, starting with the best candidate for each group
+func newChoiceQueue(candidates [][]*construct) *choiceQueue {
+	q := &choiceQueue{candidates: candidates, ranked: make([][]int, len(candidates))}
+	for g, cands := range candidates {
+		q.ranked[g] = make([]int, len(cands))
+		for c := range cands {
+			q.ranked[g][c] = c
+		}
+		sort.SliceStable(q.ranked[g], func(i, j int) bool { return cands[q.ranked[g][i]].score > cands[q.ranked[g][j]].score })
+		if len(cands) == 0 {
+			return q
+		}
+	}
+	q.push(make([]int, len(candidates)), 0)
+	return q
+}
+
+// choice returns the candidate chosen for each group by ranks
+func (q *choiceQueue) choice(rank []int) []int {
+	choice := make([]int, len(rank))
+	for g, r := range rank {
+		choice[g] = q.ranked[g][r]
+	}
+	return choice
+}
+
+// push queues the choice of ranked candidates
+func (q *choiceQueue) push(rank []int, pivot int) {
+	score := 0.0
+	for g, c := range q.choice(rank) {
+		score += q.candidates[g][c].score
+	}
+	heap.Push(&q.pending, &queuedChoice{rank: rank, pivot: pivot, score: score})
+}
+
+// nextTied returns the queued choices with the highest total score, in order of candidate, or nil once every choice has
+// been returned
+func (q *choiceQueue) nextTied() [][]int {
+	if q.pending.Len() == 0 {
+		return nil
+	}
+	score := q.pending[0].score
+	var tied [][]int
+	for q.pending.Len() > 0 && q.pending[0].score == score {
+		qc := heap.Pop(&q.pending).(*queuedChoice)
+		tied = append(tied, q.choice(qc.rank))
+		for g := qc.pivot; g < len(qc.rank); g++ {
+			if qc.rank[g]+1 < len(q.ranked[g]) {
+				rank := append([]int(nil), qc.rank...)
+				rank[g]++
+				q.push(rank, g)
+			}
+		}
+	}
+	sort.Slice(tied, func(i, j int) bool {
+		for g := range tied[i] {
+			if tied[i][g] != tied[j][g] {
+				return tied[i][g] < tied[j][g]
+			}
+		}
+		return false
+	})
+	return tied
+}
+
+// choiceHeap is a max-heap of choices by total score
+type choiceHeap []*queuedChoice
+
+func (h choiceHeap) Len() int            { return len(h) }
+func (h choiceHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h choiceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *choiceHeap) Push(x interface{}) { *h = append(*h, x.(*queuedChoice)) }
+func (h *choiceHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// cleanJunctions reports whether no kmer spanning a join of the ordered, chosen segments matches an off-target
+func cleanJunctions(candidates [][]*construct, order []int, choice []int, otJunctionKmers map[string]struct{}, kmerLen int) bool {
+	for i := 0; i < len(order)-1; i++ {
+		a := candidates[order[i]][choice[order[i]]].seq
+		b := candidates[order[i+1]][choice[order[i+1]]].seq
+		for _, kmer := range junctionKmers(a, b, kmerLen) {
+			if _, ok := otJunctionKmers[kmer]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// nextPermutation rearranges order into the next permutation in lexicographic order, or returns false if it's the last
+func nextPermutation(order []int) bool {
+	i := len(order) - 2
+	for i >= 0 && order[i] >= order[i+1] {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	j := len(order) - 1
+	for order[j] <= order[i] {
+		j--
+	}
+	order[i], order[j] = order[j], order[i]
+	for l, r := i+1, len(order)-1; l < r; l, r = l+1, r-1 {
+		order[l], order[r] = order[r], order[l]
+	}
+	return true
+}
+
+// scoreConstruct returns a construct for seq, with its kmer hits to each target and objective score (using the search's
+// kmer weights, if any)
+func scoreConstruct(goodKmers *kmerTable, seq string, p searchParams) *construct {
+	hits := constructHits(goodKmers, seq)
+	var score float64
+	if p.kmerWeights != nil {
+		weighted := make([]float64, goodKmers.seqLen)
+		for _, row := range goodKmers.rows(seq) {
+			if row >= 0 {
+				goodKmers.addWeightedHits(row, weighted, p.kmerWeights[row])
+			}
+		}
+		score, _ = p.obj.scoreHits(weighted)
+	} else {
+		score, _ = p.obj.score(hits)
+	}
+	return &construct{kmerHits: hits, score: score, seq: seq}
+}
+
+// constructHits returns the no. of kmers in seq matching each target sequence
+func constructHits(goodKmers *kmerTable, seq string) []int {
+	hits := make([]int, goodKmers.seqLen)
+	for _, row := range goodKmers.rows(seq) {
+		if row >= 0 {
+			goodKmers.addHits(row, hits, 1)
+		}
+	}
+	return hits
+}
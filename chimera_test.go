@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLoadTargetGroups(t *testing.T) {
+	ref := []*HeaderRef{{Header: "a1"}, {Header: "a2"}, {Header: "b1"}}
+	tests := []struct {
+		name    string
+		content string
+		want    [][]int
+		wantErr bool
+	}{
+		{name: "groups", content: "# header\tgroup\na1\tvATPase\nb1\tSnf7\na2\tvATPase\n", want: [][]int{{0, 1}, {2}}},
+		{name: "unassigned", content: "a1\tvATPase\nb1\tSnf7\n", wantErr: true},
+		{name: "twoGroups", content: "a1\tvATPase\na2\tvATPase\nb1\tSnf7\nb1\tvATPase\n", wantErr: true},
+		{name: "oneGroup", content: "a1\tvATPase\na2\tvATPase\nb1\tvATPase\n", wantErr: true},
+		{name: "unknownHeader", content: "a1\tvATPase\na2\tvATPase\nb1\tSnf7\nc1\tSnf7\n", wantErr: true},
+		{name: "noGroup", content: "a1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "groups.tsv")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write temp file: %v", err)
+			}
+			groups, err := loadTargetGroups(fileName, ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTargetGroups() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got [][]int
+			for _, g := range groups {
+				got = append(got, g.members)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadTargetGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Each target in its own group, one more than a chimera can have
+	var content strings.Builder
+	many := make([]*HeaderRef, maxChimeraGroups+1)
+	for i := range many {
+		many[i] = &HeaderRef{Header: "t" + strconv.Itoa(i)}
+		fmt.Fprintf(&content, "t%d\tg%d\n", i, i)
+	}
+	fileName := filepath.Join(t.TempDir(), "groups.tsv")
+	if err := os.WriteFile(fileName, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+	if _, err := loadTargetGroups(fileName, many); err == nil {
+		t.Errorf("loadTargetGroups() = nil, want an error for %d groups", len(many))
+	}
+}
+
+func Test_setGroupLengths(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{name: "evenSplit", spec: "", want: []int{101, 100, 100}},
+		{name: "spec", spec: "a=150, b=100,c=51", want: []int{150, 100, 51}},
+		{name: "wrongTotal", spec: "a=150,b=100,c=50", wantErr: true},
+		{name: "missingGroup", spec: "a=201,b=100", wantErr: true},
+		{name: "unknownGroup", spec: "a=150,b=100,c=41,d=10", wantErr: true},
+		{name: "shorterThanKmer", spec: "a=270,b=20,c=11", wantErr: true},
+		{name: "badLength", spec: "a=x,b=100,c=51", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := []*targetGroup{{name: "a"}, {name: "b"}, {name: "c"}}
+			err := setGroupLengths(groups, tt.spec, 301, 21)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setGroupLengths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for i, g := range groups {
+				if g.length != tt.want[i] {
+					t.Errorf("group %s length = %d, want %d", g.name, g.length, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_groupKmers(t *testing.T) {
+	goodKmers := testKmerTable(map[string][]int{"AAAA": {1, 0, 1}, "CCCC": {0, 1, 0}})
+	want := map[string][]int{"AAAA": {1, 1}}
+	if got := tablePresence(groupKmers(goodKmers, []int{0, 2})); !reflect.DeepEqual(got, want) {
+		t.Errorf("groupKmers() = %v, want %v", got, want)
+	}
+}
+
+func Test_junctionKmers(t *testing.T) {
+	want := []string{"ACGT", "CGTT", "GTTG"}
+	if got := junctionKmers("AAACG", "TTGCA", 4); !reflect.DeepEqual(got, want) {
+		t.Errorf("junctionKmers() = %v, want %v", got, want)
+	}
+}
+
+func Test_nextPermutation(t *testing.T) {
+	want := [][]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+	order := []int{0, 1, 2}
+	var got [][]int
+	for {
+		got = append(got, append([]int(nil), order...))
+		if !nextPermutation(order) {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nextPermutation() gave %v, want %v", got, want)
+	}
+}
+
+func Test_assembleChimera(t *testing.T) {
+	candidates := [][]*construct{
+		{{seq: "AAAAC", score: 5}, {seq: "AAAAG", score: 4}},
+		{{seq: "TTTTT", score: 3}},
+	}
+	noACT, err := newSeqConstraints(0, 0, 0, 100, "ACT", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		otJunction  map[string]struct{}
+		constraints *seqConstraints
+		wantSeq     string
+	}{
+		{name: "noOffTargets", otJunction: map[string]struct{}{}, wantSeq: "AAAACTTTTT"},
+		// AAAAC+TTTTT has junction kmer ACTT, so the other group order is used
+		{name: "reorder", otJunction: map[string]struct{}{"ACTT": {}}, wantSeq: "TTTTTAAAAC"},
+		// Both orders with AAAAC have an off-target junction kmer, so the second candidate is used
+		{name: "nextCandidate", otJunction: map[string]struct{}{"ACTT": {}, "TTAA": {}}, wantSeq: "AAAAGTTTTT"},
+		// AAAAC+TTTTT contains a forbidden motif
+		{name: "constraints", otJunction: map[string]struct{}{}, constraints: noACT, wantSeq: "TTTTTAAAAC"},
+		{name: "none", otJunction: map[string]struct{}{"CTTT": {}, "GTTT": {}, "TTAA": {}}, wantSeq: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := assembleChimera(candidates, tt.otJunction, tt.constraints, 4)
+			gotSeq := ""
+			if got != nil {
+				gotSeq = got.seq
+			}
+			if gotSeq != tt.wantSeq {
+				t.Errorf("assembleChimera() = %v, want %v", gotSeq, tt.wantSeq)
+			}
+		})
+	}
+}
+
+func Test_assembleChimeraBestFirst(t *testing.T) {
+	// The best-first search finds the chimera an exhaustive search of every order and choice of candidates does
+	r := rand.New(rand.NewSource(3))
+	for trial := 0; trial < 200; trial++ {
+		candidates := make([][]*construct, 2+r.Intn(3))
+		for g := range candidates {
+			candidates[g] = make([]*construct, 1+r.Intn(3))
+			for c := range candidates[g] {
+				candidates[g][c] = &construct{seq: randomTargets(r, 1, 6, 0)[0].Seq, score: float64(r.Intn(4))}
+			}
+		}
+		otJunction := make(map[string]struct{})
+		for i := 0; i < 40; i++ {
+			otJunction[randomTargets(r, 1, 3, 0)[0].Seq] = struct{}{}
+		}
+		got := assembleChimera(candidates, otJunction, nil, 3)
+		want := exhaustiveChimera(candidates, otJunction, 3)
+		if (got == nil) != (want == nil) || got != nil && (got.seq != want.seq || !reflect.DeepEqual(got.choice, want.choice)) {
+			t.Fatalf("trial %d: assembleChimera() = %v, want %v", trial, got, want)
+		}
+	}
+
+	// With many groups, the best candidates in the given order are found without trying every order
+	candidates := make([][]*construct, maxChimeraGroups)
+	for g := range candidates {
+		for c := 0; c < chimeraCandidates; c++ {
+			candidates[g] = append(candidates[g], &construct{seq: randomTargets(r, 1, 30, 0)[0].Seq, score: float64(chimeraCandidates - c)})
+		}
+	}
+	if got := assembleChimera(candidates, map[string]struct{}{}, nil, 21); got == nil || !reflect.DeepEqual(got.choice, make([]int, maxChimeraGroups)) {
+		t.Errorf("assembleChimera() = %v, want the best candidate of each group", got)
+	}
+}
+
+// exhaustiveChimera returns the chimera with the highest total score over every order and choice of candidates,
+// preferring earlier orders and then earlier choices on ties
+func exhaustiveChimera(candidates [][]*construct, otJunctionKmers map[string]struct{}, kmerLen int) *chimera {
+	var best *chimera
+	bestScore := -1.0
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	for {
+		choice := make([]int, len(candidates))
+		for {
+			score := 0.0
+			for g, c := range choice {
+				score += candidates[g][c].score
+			}
+			if score > bestScore && cleanJunctions(candidates, order, choice, otJunctionKmers, kmerLen) {
+				seq := ""
+				for _, g := range order {
+					seq += candidates[g][choice[g]].seq
+				}
+				best, bestScore = &chimera{order: append([]int(nil), order...), choice: append([]int(nil), choice...), seq: seq}, score
+			}
+			g := len(choice) - 1
+			for ; g >= 0; g-- {
+				if choice[g]++; choice[g] < len(candidates[g]) {
+					break
+				}
+				choice[g] = 0
+			}
+			if g < 0 {
+				break
+			}
+		}
+		if !nextPermutation(order) {
+			return best
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// iupacClasses maps IUPAC nucleotide codes to the bases they match
+var iupacClasses = map[rune]string{
+	'A': "A", 'C': "C", 'G': "G", 'T': "T", 'U': "T",
+	'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT", 'K': "GT", 'M': "AC",
+	'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG", 'N': "ACGT",
+}
+
+// forbiddenMotif is a sequence motif the construct must not contain on either strand
+type forbiddenMotif struct {
+	pattern string // IUPAC pattern as given
+	re      *regexp.Regexp
+}
+
+// seqConstraints are composition limits on a construct, for synthesis and in vitro transcription
+type seqConstraints struct {
+	maxHomopolymer int     // max. homopolymer run length (0 for no limit)
+	gcWindow       int     // sliding window length for the GC limits
+	gcMin, gcMax   float64 // GC content (%) limits for every window (0 and 100 for no limit)
+	motifs         []forbiddenMotif
+}
+
+// constraintViolation is a stretch of sequence breaking a composition constraint.  A window containing the whole
+// stretch breaks the constraint.
+type constraintViolation struct {
+	start, end int    // 0-based, end exclusive
+	constraint string // the constraint broken
+	detail     string // how the stretch breaks it
+}
+
+// newSeqConstraints validates the composition constraint options and returns the constraints they describe, or nil if
+// none are set.  motifs is a comma-separated list of IUPAC patterns.
+func newSeqConstraints(maxHomopolymer int, gcWindow int, gcMin float64, gcMax float64, motifs string, constructLen int) (*seqConstraints, error) {
+	c := &seqConstraints{maxHomopolymer: maxHomopolymer, gcWindow: gcWindow, gcMin: gcMin, gcMax: gcMax}
+	if maxHomopolymer < 0 {
+		return nil, fmt.Errorf("max. homopolymer length (%d) must be >= 0", maxHomopolymer)
+	}
+	if gcMin < 0 || gcMax > 100 || gcMin > gcMax {
+		return nil, fmt.Errorf("GC window limits (%.1f-%.1f%%) must satisfy 0 <= min. <= max. <= 100", gcMin, gcMax)
+	}
+	if c.gcLimited() && (gcWindow < 1 || gcWindow > constructLen) {
+		return nil, fmt.Errorf("GC window length (%d) must be between 1 and the construct length (%d)", gcWindow, constructLen)
+	}
+	for _, pattern := range strings.Split(motifs, ",") {
+		pattern = strings.ToUpper(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if len(pattern) > constructLen {
+			return nil, fmt.Errorf("forbidden motif '%s' is longer than the construct length (%d)", pattern, constructLen)
+		}
+		var expr strings.Builder
+		for _, nuc := range pattern {
+			class, ok := iupacClasses[nuc]
+			if !ok {
+				return nil, fmt.Errorf("forbidden motif '%s' has an invalid IUPAC code '%c'", pattern, nuc)
+			}
+			expr.WriteString("[" + class + "]")
+		}
+		c.motifs = append(c.motifs, forbiddenMotif{pattern: pattern, re: regexp.MustCompile(expr.String())})
+	}
+	if maxHomopolymer == 0 && !c.gcLimited() && len(c.motifs) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// gcLimited reports whether windows have a GC content limit
+func (c *seqConstraints) gcLimited() bool {
+	return c.gcMin > 0 || c.gcMax < 100
+}
+
+// violations returns every stretch of seq breaking a constraint, in order of constraint
+func (c *seqConstraints) violations(seq string) []constraintViolation {
+	var found []constraintViolation
+	if c.maxHomopolymer > 0 {
+		constraint := "max. homopolymer length " + strconv.Itoa(c.maxHomopolymer)
+		for start := 0; start < len(seq); {
+			end := start + 1
+			for end < len(seq) && seq[end] == seq[start] {
+				end++
+			}
+			if run := end - start; run > c.maxHomopolymer {
+				detail := fmt.Sprintf("%d nt run of %c at position %d", run, seq[start], start+1)
+				// Any window holding more than the max. of the run breaks the constraint
+				for i := start; i+c.maxHomopolymer < end; i++ {
+					found = append(found, constraintViolation{i, i + c.maxHomopolymer + 1, constraint, detail})
+				}
+			}
+			start = end
+		}
+	}
+	if c.gcLimited() {
+		constraint := fmt.Sprintf("GC content %.1f-%.1f%% in every %d nt window", c.gcMin, c.gcMax, c.gcWindow)
+		for i := 0; i+c.gcWindow <= len(seq); i++ {
+			if gc := gcContent(seq[i : i+c.gcWindow]); gc < c.gcMin || gc > c.gcMax {
+				detail := fmt.Sprintf("%.1f%% GC at position %d", gc, i+1)
+				found = append(found, constraintViolation{i, i + c.gcWindow, constraint, detail})
+			}
+		}
+	}
+	rc := reverseComplement(seq)
+	for _, m := range c.motifs {
+		constraint := "forbidden motif " + m.pattern
+		for strand, s := range []string{seq, rc} {
+			for _, loc := range overlappingMatches(m.re, s) {
+				start, end := loc[0], loc[1]
+				if strand == 1 {
+					start, end = len(seq)-loc[1], len(seq)-loc[0]
+				}
+				detail := fmt.Sprintf("%s at position %d (%c strand)", s[loc[0]:loc[1]], start+1, "+-"[strand])
+				found = append(found, constraintViolation{start, end, constraint, detail})
+			}
+		}
+	}
+	return found
+}
+
+// overlappingMatches returns the start and end of every match of re in s, including overlapping matches
+func overlappingMatches(re *regexp.Regexp, s string) [][2]int {
+	var matches [][2]int
+	for offset := 0; offset < len(s); {
+		loc := re.FindStringIndex(s[offset:])
+		if loc == nil {
+			break
+		}
+		matches = append(matches, [2]int{offset + loc[0], offset + loc[1]})
+		offset += loc[0] + 1
+	}
+	return matches
+}
+
+// validWindows reports, for each start position of a window of windowLen nt in seq, whether the window meets every
+// constraint
+func (c *seqConstraints) validWindows(seq string, windowLen int) []bool {
+	n := len(seq) - windowLen + 1
+	if n < 1 {
+		return nil
+	}
+	// Each violation rules out the windows containing it, marked with a difference array
+	diff := make([]int, n+1)
+	for _, v := range c.violations(seq) {
+		first, last := v.end-windowLen, v.start
+		if first < 0 {
+			first = 0
+		}
+		if last > n-1 {
+			last = n - 1
+		}
+		if first <= last {
+			diff[first]++
+			diff[last+1]--
+		}
+	}
+	valid := make([]bool, n)
+	bad := 0
+	for i := range valid {
+		bad += diff[i]
+		valid[i] = bad == 0
+	}
+	return valid
+}
+
+// unmet returns each constraint a sequence breaks, with its first violation
+func (c *seqConstraints) unmet(seq string) []string {
+	var issues []string
+	seen := make(map[string]bool)
+	for _, v := range c.violations(seq) {
+		if !seen[v.constraint] {
+			seen[v.constraint] = true
+			issues = append(issues, v.constraint+": "+v.detail)
+		}
+	}
+	return issues
+}
+
+// satisfied reports whether a sequence meets every constraint (always true for nil constraints)
+func (c *seqConstraints) satisfied(seq string) bool {
+	return c == nil || len(c.violations(seq)) == 0
+}
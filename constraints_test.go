@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_newSeqConstraints(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxHomopolymer int
+		gcWindow       int
+		gcMin, gcMax   float64
+		motifs         string
+		wantNil        bool
+		wantErr        bool
+	}{
+		{"none", 0, 50, 0, 100, "", true, false},
+		{"homopolymer", 6, 50, 0, 100, "", false, false},
+		{"gc", 0, 50, 30, 70, "", false, false},
+		{"motifs", 0, 50, 0, 100, "GAATTC, ggtacc", false, false},
+		{"negative homopolymer", -1, 50, 0, 100, "", true, true},
+		{"min above max", 0, 50, 70, 30, "", true, true},
+		{"window too long", 0, 400, 30, 70, "", true, true},
+		{"bad IUPAC code", 0, 50, 0, 100, "GAAXTC", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSeqConstraints(tt.maxHomopolymer, tt.gcWindow, tt.gcMin, tt.gcMax, tt.motifs, 300)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSeqConstraints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("newSeqConstraints() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_seqConstraintsUnmet(t *testing.T) {
+	c, err := newSeqConstraints(4, 6, 20, 80, "CAGGW", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issues := c.unmet("ACGTACGTAC"); len(issues) != 0 {
+		t.Errorf("unmet() = %v, want none", issues)
+	}
+	want := []string{
+		"max. homopolymer length 4: 5 nt run of A at position 2",
+		"GC content 20.0-80.0% in every 6 nt window: 16.7% GC at position 1",
+		"forbidden motif CAGGW: CAGGA at position 8 (+ strand)",
+	}
+	if got := c.unmet("CAAAAATCAGGACCT"); !reflect.DeepEqual(got, want) {
+		t.Errorf("unmet() = %v, want %v", got, want)
+	}
+	// A motif on the reverse strand - TCCTG is the reverse complement of CAGGA
+	want = []string{"forbidden motif CAGGW: CAGGA at position 2 (- strand)"}
+	if got := c.unmet("ATCCTGA"); !reflect.DeepEqual(got, want) {
+		t.Errorf("unmet() = %v, want %v", got, want)
+	}
+}
+
+func Test_validWindows(t *testing.T) {
+	c, err := newSeqConstraints(3, 0, 0, 100, "", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The run of 5 Ts is only allowed in windows holding no more than 3 of it
+	want := []bool{true, true, false, false, false, true, true}
+	if got := c.validWindows("ACGTTTTTCGA", 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("validWindows() = %v, want %v", got, want)
+	}
+	if got := c.validWindows("ACG", 5); got != nil {
+		t.Errorf("validWindows() = %v, want nil for a sequence shorter than the window", got)
+	}
+}
+
+func Test_bestConstructConstraints(t *testing.T) {
+	ref := []*HeaderRef{{Header: "ref_1", Seq: "ACGTGAATTCAGTCA"}}
+	goodKmers, _ := getKmers(ref, 4)
+	p := searchParams{kmerLen: 4, seqLen: 1, constructLen: 8, obj: objective{name: "median"}}
+	p.constraints, _ = newSeqConstraints(0, 0, 0, 100, "GAATTC", 8)
+
+	got, err := bestConstruct(goodKmers, ref[0].Seq+"A", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.constraints.satisfied(got.seq) || got.score == 0 {
+		t.Errorf("bestConstruct() = %s (score %v), want a construct without GAATTC", got.seq, got.score)
+	}
+
+	// Every window contains the motif
+	p.constructLen = 14
+	got, _ = bestConstruct(goodKmers, ref[0].Seq+"A", p)
+	if got.score != 0 {
+		t.Errorf("bestConstruct() score = %v, want 0", got.score)
+	}
+}
@@ -31,138 +31,295 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/rand"
+	"runtime"
 	"sort"
 	"sync"
-	"time"
 )
 
 // construct struct contains kmerHits slice (total present in each input target),
-// the geometric mean of the slice, and the sequence of the selected construct
+// the objective score of the slice, and the sequence of the selected construct
 type construct struct {
-	kmerHits   []int
-	medianHits float64
-	seq        string
+	kmerHits []int
+	score    float64
+	seq      string
 }
 
-// Concurrent implementation to identify the best construct over multiple iterations
-func conBestConstruct(goodKmers map[string][]int, kmerCts map[string]int, kmerLen int, seqLen int, constructLen int, iterations int) *construct {
+// searchParams holds the settings shared by every iteration of the construct search
+type searchParams struct {
+	kmerLen      int
+	seqLen       int // no. of target sequences
+	constructLen int
+	iterations   int
+	seed         int64
+	obj          objective
+	minHits      []int           // min. kmer hits required for each target sequence (nil for none)
+	kmerWeights  []float64       // weight of each kmer's hits in the objective, by kmer table row (nil for a weight of 1 each)
+	constraints  *seqConstraints // composition constraints on the construct (nil for none)
+	ctx          context.Context // stops the search early, keeping the constructs found so far (nil for none)
+}
+
+// cancelled reports whether the search's context has been cancelled
+func (p searchParams) cancelled() bool {
+	return p.ctx != nil && p.ctx.Err() != nil
+}
+
+// Concurrent implementation to identify the best construct over multiple iterations, from the target kmer table and
+// the abundance of each of its kmers (kmerCts, by row).
+// Each iteration gets its own random source derived from the master seed, so the same seed and inputs always
+// give the same construct.
+func conBestConstruct(goodKmers *kmerTable, kmerCts []float64, p searchParams) *construct {
+	consSeqsChan := launchIterations(goodKmers, kmerCts, p)
+	prog := newProgress("Construct search", int64(p.iterations), "iterations")
+	selConstruct := compileConsSeqs(consSeqsChan, prog)
+	prog.finish()
+	return selConstruct
+}
+
+// conTopConstructs runs the same search as conBestConstruct, but returns up to n of the best constructs, each sharing
+// no more than maxShared of its kmers with a better-ranked construct.
+func conTopConstructs(goodKmers *kmerTable, kmerCts []float64, p searchParams, n int, maxShared float64) []*construct {
+	consSeqsChan := launchIterations(goodKmers, kmerCts, p)
+	prog := newProgress("Construct search", int64(p.iterations), "iterations")
+	defer prog.finish()
+	return compileTopConsSeqs(consSeqsChan, n, maxShared, p.kmerLen, prog)
+}
+
+// launchIterations runs the iterations on a pool of GOMAXPROCS workerBC goroutines, starting from the kmers with an
+// abundance, and returns the channel their constructs are streamed on.  The channel is closed once all iterations
+// are done - or, if the search's context is cancelled, once the iterations in progress are done.
+func launchIterations(t *kmerTable, kmerCts []float64, p searchParams) chan *construct {
+	var starts []int32 // in kmer order
+	for row, ct := range kmerCts {
+		if ct >= 0 {
+			starts = append(starts, int32(row))
+		}
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > p.iterations {
+		workers = p.iterations
+	}
+	// Each iteration's seed is drawn from the master seed in order, so results don't depend on the no. of workers
+	seeds := make(chan int64, workers)
+	var done <-chan struct{}
+	if p.ctx != nil {
+		done = p.ctx.Done()
+	}
+	go func() {
+		defer close(seeds)
+		master := rand.New(rand.NewSource(p.seed))
+		for a := 0; a < p.iterations; a++ {
+			select {
+			case seeds <- master.Int63():
+			case <-done:
+				return
+			}
+		}
+	}()
 	wg := &sync.WaitGroup{}
-	wg.Add(iterations)
-	consSeqsChan := make(chan *construct, iterations)
-	for a := 0; a < iterations; a++ {
-		go workerBC(goodKmers, kmerCts, kmerLen, seqLen, constructLen, consSeqsChan, wg)
+	wg.Add(workers)
+	consSeqsChan := make(chan *construct, workers)
+	for w := 0; w < workers; w++ {
+		go workerBC(t, kmerCts, starts, p, seeds, consSeqsChan, wg)
 	}
 	go func(cs chan *construct, wg *sync.WaitGroup) {
 		wg.Wait()
 		close(cs)
 	}(consSeqsChan, wg)
-	selConstruct := compileConsSeqs(consSeqsChan)
-	return selConstruct
+	return consSeqsChan
 }
 
-// Worker function for a single iteration of identifying the best construct among the input sequences
-// Randomly selects an initKmer, then build forward and backward based on the highest no. of kmer matches
-// to each input sequences for a given extension nucleotide until no nucleotides can be added.  kmers are removed
-// from the input kmer map upon extension.  The best constrcut with the assembled sequences is selected based on maximising
-// the geometric mean of input kmer hits.
-
-func workerBC(goodKmers map[string][]int, kmerCts map[string]int, kmerLen int, seqLen int, constructLen int, consSeqsChan chan *construct, wg *sync.WaitGroup) {
-	var kmerSeq []string
-	kmerCtsCpy := make(map[string]int)
-	for k, v := range kmerCts {
-		kmerCtsCpy[k] = v
-		kmerSeq = append(kmerSeq, k)
+// Worker function running iterations of identifying the best construct among the input sequences, one for each seed
+// received, until the seed channel is closed or the search is cancelled.
+// Each iteration randomly selects an initKmer from the start rows (in kmer order, so the same seed selects the same
+// kmer), then build forward and backward based on the highest no. of kmer matches to each input sequences for a given
+// extension nucleotide until no nucleotides can be added.  kmers are used up in the worker's copy of the kmer
+// abundances upon extension, and restored for the next iteration.  The best constrcut with the assembled sequences is
+// selected based on maximising the objective score of input kmer hits.
+func workerBC(t *kmerTable, kmerCts []float64, starts []int32, p searchParams, seeds <-chan int64, consSeqsChan chan<- *construct, wg *sync.WaitGroup) {
+	defer wg.Done()
+	cts := append([]float64(nil), kmerCts...)
+	for seed := range seeds {
+		if p.cancelled() || len(starts) == 0 {
+			continue
+		}
+		r := rand.New(rand.NewSource(seed))
+		initKmer := starts[r.Intn(len(starts))]
+		fcons := buildf(t, cts, initKmer, r)
+		bcons := buildr(t, cts, fcons, r)
+		construct, _ := bestConstruct(t, bcons, p)
+		consSeqsChan <- construct
+		for _, row := range t.rows(bcons) {
+			if row >= 0 {
+				cts[row] = kmerCts[row]
+			}
+		}
 	}
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	randomIndex := r.Intn(len(kmerSeq))
-	initKmer := kmerSeq[randomIndex]
-	fcons := buildf(kmerCtsCpy, initKmer, kmerLen)
-	bcons := buildr(kmerCtsCpy, fcons, kmerLen)
-	construct, _ := bestConstruct(goodKmers, bcons, constructLen, kmerLen, seqLen)
-	consSeqsChan <- construct
-	wg.Done()
 }
 
-// Checks all the generated constrcuts and retains the best (highest geomean)
-func compileConsSeqs(consSeqsChan chan *construct) *construct {
+// Checks all the generated constructs, all of one length, and retains the best (highest objective score - the lengths
+// of a -constructLen range are then compared by score per nt, see selectLength).
+// Ties are broken by sequence so the result doesn't depend on the order constructs arrive.
+// Each construct received is added to prog (nil if not reporting), with the best score so far.
+func compileConsSeqs(consSeqsChan chan *construct, prog *progress) *construct {
 	var selConstruct *construct
 	best := 0.0
 	for eachConstruct := range consSeqsChan {
-
-		if eachConstruct.medianHits > best {
-			best = eachConstruct.medianHits
+		prog.add(1)
+		if eachConstruct.score > best || (selConstruct != nil && eachConstruct.score == best && eachConstruct.seq < selConstruct.seq) {
+			if eachConstruct.score > best {
+				prog.setNote(fmt.Sprintf("best score %.1f", eachConstruct.score))
+			}
+			best = eachConstruct.score
 			selConstruct = eachConstruct
 		}
 	}
 	return selConstruct
 }
 
-// Build forward from the initial kmer until no nucleotides can be added.  Nucleotide selection
-// is random when the kmer abundance for 2 or nucleotides is even.
-func buildf(kmerCtsCpy map[string]int, initKmer string, kmerLen int) string {
-	consensus := initKmer
-	nucs := []string{"A", "C", "G", "T"}
+// compileTopConsSeqs ranks all generated constructs (highest objective score first, ties broken by sequence) and greedily
+// retains up to n, skipping any that share more than maxShared of their kmers with an already retained construct.
+// Each construct received is added to prog (nil if not reporting), with the best score so far.
+func compileTopConsSeqs(consSeqsChan chan *construct, n int, maxShared float64, kmerLen int, prog *progress) []*construct {
+	var all []*construct
+	best := 0.0
+	for eachConstruct := range consSeqsChan {
+		prog.add(1)
+		if eachConstruct.score > best {
+			best = eachConstruct.score
+			prog.setNote(fmt.Sprintf("best score %.1f", best))
+		}
+		if eachConstruct.score > 0 {
+			all = append(all, eachConstruct)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].seq < all[j].seq
+	})
+
+	var selConstructs []*construct
+	var selKmers []map[string]struct{}
+	for _, candidate := range all {
+		if len(selConstructs) == n {
+			break
+		}
+		redundant := false
+		for _, kmers := range selKmers {
+			if sharedKmerFraction(candidate.seq, kmers, kmerLen) > maxShared {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			selConstructs = append(selConstructs, candidate)
+			selKmers = append(selKmers, constructKmerSet(candidate.seq, kmerLen))
+		}
+	}
+	return selConstructs
+}
+
+// constructKmerSet returns the kmers of a construct in both orientations, as either dsRNA strand yields siRNAs
+func constructKmerSet(seq string, kmerLen int) map[string]struct{} {
+	kmers := make(map[string]struct{})
+	for _, s := range []string{seq, reverseComplement(seq)} {
+		for i := 0; i <= len(s)-kmerLen; i++ {
+			kmers[s[i:i+kmerLen]] = struct{}{}
+		}
+	}
+	return kmers
+}
+
+// sharedKmerFraction returns the fraction of the sequence's kmers present in the kmer set
+func sharedKmerFraction(seq string, kmers map[string]struct{}, kmerLen int) float64 {
+	total, shared := 0, 0
+	for i := 0; i <= len(seq)-kmerLen; i++ {
+		total++
+		if _, ok := kmers[seq[i:i+kmerLen]]; ok {
+			shared++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(shared) / float64(total)
+}
+
+// Build forward from the initial kmer (a row of the kmer table) until no nucleotides can be added.  Nucleotide
+// selection is random when the kmer abundance for 2 or nucleotides is even.  Kmers added are used up in cts, the
+// worker's copy of the kmer abundances.
+func buildf(t *kmerTable, cts []float64, initKmer int32, r *rand.Rand) string {
+	last := t.keys[initKmer]
+	consensus := []byte(last.unpack(t.kmerLen))
+	nucs := []uint64{0, 1, 2, 3}
 	for {
-		nextSub := consensus[len(consensus)-kmerLen+1:]
-		bestScore := 0
-		bestKmer := ""
-		bestNuc := ""
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(len(nucs), func(i, j int) { nucs[i], nucs[j] = nucs[j], nucs[i] })
+		bestScore := 0.0
+		var bestKmer packedKmer
+		bestRow := int32(-1)
+		bestNuc := uint64(0)
+		r.Shuffle(len(nucs), func(i, j int) { nucs[i], nucs[j] = nucs[j], nucs[i] })
 		for _, v := range nucs {
-			nextKmer := nextSub + v
-			if val, ok := kmerCtsCpy[nextKmer]; ok {
-				if val > bestScore {
-					bestNuc = v
-					bestKmer = nextKmer
-					bestScore = val
-				}
+			nextKmer := last.push(v, t.kmerLen)
+			if row, ok := t.row(nextKmer); ok && cts[row] > bestScore {
+				bestNuc = v
+				bestKmer = nextKmer
+				bestRow = row
+				bestScore = cts[row]
 			}
 		}
 		if bestScore == 0 {
-			return consensus
-		} else {
-			consensus = consensus + bestNuc
-			delete(kmerCtsCpy, bestKmer)
+			return string(consensus)
 		}
+		consensus = append(consensus, "ACGT"[bestNuc])
+		cts[bestRow] = 0
+		last = bestKmer
 	}
 }
 
 // Build backward from the completed forward consensus.  Sames rules apply.
-func buildr(kmerCtsCpy map[string]int, fcons string, kmerLen int) string {
-	consensus := fcons
-	nucs := []string{"A", "C", "G", "T"}
+func buildr(t *kmerTable, cts []float64, fcons string, r *rand.Rand) string {
+	first, _ := packKmer(fcons[:t.kmerLen])
+	var prefix []byte // added nucleotides, last added first
+	nucs := []uint64{0, 1, 2, 3}
 	for {
-		nextSub := consensus[:kmerLen-1]
-		bestScore := 0
-		bestKmer := ""
-		bestNuc := ""
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(len(nucs), func(i, j int) { nucs[i], nucs[j] = nucs[j], nucs[i] })
+		bestScore := 0.0
+		var bestKmer packedKmer
+		bestRow := int32(-1)
+		bestNuc := uint64(0)
+		r.Shuffle(len(nucs), func(i, j int) { nucs[i], nucs[j] = nucs[j], nucs[i] })
 		for _, v := range nucs {
-			nextKmer := v + nextSub
-			if val, ok := kmerCtsCpy[nextKmer]; ok {
-				if val > bestScore {
-					bestNuc = v
-					bestKmer = nextKmer
-					bestScore = val
-				}
+			nextKmer := first.pushFront(v, t.kmerLen)
+			if row, ok := t.row(nextKmer); ok && cts[row] > bestScore {
+				bestNuc = v
+				bestKmer = nextKmer
+				bestRow = row
+				bestScore = cts[row]
 			}
 		}
 		if bestScore == 0 {
-			return consensus
-		} else {
-			consensus = bestNuc + consensus
-			delete(kmerCtsCpy, bestKmer)
+			break
 		}
+		prefix = append(prefix, "ACGT"[bestNuc])
+		cts[bestRow] = 0
+		first = bestKmer
+	}
+	consensus := make([]byte, len(prefix), len(prefix)+len(fcons))
+	for i, nuc := range prefix {
+		consensus[len(prefix)-1-i] = nuc
 	}
+	return string(append(consensus, fcons...))
 }
 
 // Select the best construct of the specified length from the provided consensus sequence
-// by maximising the geometric mean of the number of kmers to match each input target sequence
-func bestConstruct(goodKmers map[string][]int, consensus string, constructLen int, kmerLen int, seqLen int) (*construct, error) {
+// by maximising the objective score of the number of kmers to match each input target sequence.
+// Kmer hits are counted from the kmer table's target bitsets, sliding along the consensus a kmer at a time.
+func bestConstruct(t *kmerTable, consensus string, p searchParams) (*construct, error) {
+	constructLen, kmerLen := p.constructLen, p.kmerLen
 	if len(consensus) < constructLen {
 		var bad []int
 		return &construct{bad, 0.0, ""}, errors.New("consensus shorter than construct length")
@@ -170,37 +327,71 @@ func bestConstruct(goodKmers map[string][]int, consensus string, constructLen in
 	bestScore := 0.0
 	bestPos := 0
 	var bestConScores []int
-	var allScores [][]int
-	for i := 0; i < len(consensus)-kmerLen; i++ {
-		s := goodKmers[consensus[i:i+kmerLen]]
-		allScores = append(allScores, s)
+	rows := t.rows(consensus)
+	numKmers := constructLen - kmerLen + 1
+	conScores := make([]int, p.seqLen)
+	var weightedScores []float64 // when kmer hits are weighted
+	if p.kmerWeights != nil {
+		weightedScores = make([]float64, p.seqLen)
 	}
-	for i := 0; i < len(consensus)-constructLen; i++ {
-		bestScore, bestPos, bestConScores = bcHelper(seqLen, i, constructLen, kmerLen, allScores, bestScore, bestPos, bestConScores)
+	var valid []bool
+	if p.constraints != nil {
+		valid = p.constraints.validWindows(consensus, constructLen)
+	}
+	for i := 0; i <= len(consensus)-constructLen; i++ {
+		if i == 0 {
+			for _, row := range rows[:numKmers] {
+				if row >= 0 {
+					t.addHits(row, conScores, 1)
+				}
+			}
+		} else {
+			if row := rows[i-1]; row >= 0 {
+				t.addHits(row, conScores, -1)
+			}
+			if row := rows[i+numKmers-1]; row >= 0 {
+				t.addHits(row, conScores, 1)
+			}
+		}
+		if valid != nil && !valid[i] {
+			continue
+		}
+		if weightedScores != nil {
+			// Summed afresh for each window, so scores don't drift
+			for x := range weightedScores {
+				weightedScores[x] = 0
+			}
+			for _, row := range rows[i : i+numKmers] {
+				if row >= 0 {
+					t.addWeightedHits(row, weightedScores, p.kmerWeights[row])
+				}
+			}
+		}
+		if score, ok := windowScore(p, conScores, weightedScores); ok && score > bestScore {
+			bestScore = score
+			bestPos = i
+			bestConScores = append([]int(nil), conScores...)
+		}
 	}
 	return &construct{bestConScores, bestScore, consensus[bestPos : bestPos+constructLen]}, nil
 }
 
-func bcHelper(seqLen int, i int, constructLen int, kmerLen int, allScores [][]int, bestScore float64, bestPos int, bestConScores []int) (float64, int, []int) {
-	var conScores []int
-	for seq := 0; seq < seqLen; seq++ {
-		conScores = append(conScores, 0)
-	}
-
-	for j := i; j < i+constructLen-kmerLen+1; j++ {
-		for x, y := range allScores[j] {
-			conScores[x] += y
+// windowScore returns the objective score of a window's kmer hits to each target (of its weighted hits, if not nil),
+// or false if a target is short of its min. kmer hits or the hits can't be scored
+func windowScore(p searchParams, conScores []int, weightedScores []float64) (float64, bool) {
+	for x, required := range p.minHits {
+		if conScores[x] < required {
+			return 0, false
 		}
 	}
-	median, err := calculateMedian(conScores)
-	if err == nil {
-		if median > bestScore {
-			bestScore = median
-			bestPos = i
-			bestConScores = conScores
-		}
+	var score float64
+	var err error
+	if weightedScores != nil {
+		score, err = p.obj.scoreHits(weightedScores)
+	} else {
+		score, err = p.obj.score(conScores)
 	}
-	return bestScore, bestPos, bestConScores
+	return score, err == nil
 }
 
 // calculateMedian takes a slice of integers and returns their median as a float64.
@@ -211,7 +402,8 @@ func calculateMedian(numbers []int) (float64, error) {
 		return 0, errors.New("slice is empty")
 	}
 
-	// Sort the slice in ascending order
+	// Sort a copy of the slice in ascending order, so the caller's per-target order is kept
+	numbers = append([]int(nil), numbers...)
 	sort.Ints(numbers)
 
 	// Calculate the median
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+)
+
+// combineMinHits returns the min. kmer hits required for each target - the larger of the global minimum and any
+// per-target minimum (nil for none) - or nil if no target has a minimum.
+func combineMinHits(global int, perTarget []int, n int) []int {
+	minHits := make([]int, n)
+	constrained := false
+	for i := range minHits {
+		minHits[i] = global
+		if perTarget != nil && perTarget[i] > minHits[i] {
+			minHits[i] = perTarget[i]
+		}
+		if minHits[i] > 0 {
+			constrained = true
+		}
+	}
+	if !constrained {
+		return nil
+	}
+	return minHits
+}
+
+// kmersPerTarget returns the no. of distinct kmers present in each target sequence
+func kmersPerTarget(goodKmers *kmerTable, n int) []int {
+	counts := make([]int, n)
+	for row := range goodKmers.keys {
+		if !goodKmers.removed[row] {
+			goodKmers.addHits(int32(row), counts, 1)
+		}
+	}
+	return counts
+}
+
+// maxWindowHits returns the most kmers of a target sequence that remain in goodKmers within any constructLen window
+// of that sequence.  This is the no. of hits a construct copied directly from the target would have.
+func maxWindowHits(seq string, goodKmers *kmerTable, kmerLen int, constructLen int) int {
+	var present []int
+	for i := 0; i <= len(seq)-kmerLen; i++ {
+		if goodKmers.has(seq[i : i+kmerLen]) {
+			present = append(present, 1)
+		} else {
+			present = append(present, 0)
+		}
+	}
+	window := constructLen - kmerLen + 1
+	best, hits := 0, 0
+	for i, val := range present {
+		hits += val
+		if i >= window {
+			hits -= present[i-window]
+		}
+		if hits > best {
+			best = hits
+		}
+	}
+	return best
+}
+
+// diagnoseCoverage explains why each target's minimum kmer hits could not be met.
+//
+// Args:
+//
+//	ref: A slice of HeaderRef structures containing the target sequences.
+//	goodKmers: Target kmers remaining after off-target filtering.
+//	preFilterCounts: The no. of kmers in each target before off-target filtering.
+//	p: The construct search parameters, including the min. kmer hits for each target.
+//	unconstrained: The best construct found without minimums (nil if none).
+//
+// Returns:
+//
+//	A message for each target whose minimum could not be met, or a single general message if no target explains it.
+func diagnoseCoverage(ref []*HeaderRef, goodKmers *kmerTable, preFilterCounts []int, p searchParams, unconstrained *construct) []string {
+	var issues []string
+	postFilterCounts := kmersPerTarget(goodKmers, len(ref))
+	maxPossible := p.constructLen - p.kmerLen + 1
+	for i, required := range p.minHits {
+		if required == 0 {
+			continue
+		}
+		var reason string
+		windowHits := maxWindowHits(ref[i].Seq, goodKmers, p.kmerLen, p.constructLen)
+		switch {
+		case required > maxPossible:
+			reason = fmt.Sprintf("a %d nt construct only has %d kmers", p.constructLen, maxPossible)
+		case preFilterCounts[i] < required:
+			reason = fmt.Sprintf("the target sequence only has %d distinct kmers", preFilterCounts[i])
+		case postFilterCounts[i] == 0:
+			reason = fmt.Sprintf("all of its %d kmers were removed by off-target filtering", preFilterCounts[i])
+		case postFilterCounts[i] < required:
+			reason = fmt.Sprintf("only %d of its %d kmers remain after off-target filtering", postFilterCounts[i], preFilterCounts[i])
+		case windowHits < required:
+			reason = fmt.Sprintf("at most %d of its remaining kmers fall within any %d nt window of the target sequence", windowHits, p.constructLen)
+		case unconstrained != nil && unconstrained.kmerHits != nil && unconstrained.kmerHits[i] >= required:
+			// Satisfiable on its own - only reported if no other target explains the failure
+			continue
+		case unconstrained != nil && unconstrained.kmerHits != nil:
+			reason = fmt.Sprintf("the best construct without minimums has %d hits - its minimum conflicts with those of other targets", unconstrained.kmerHits[i])
+		default:
+			reason = "no construct meeting its minimum was found - try more iterations"
+		}
+		issues = append(issues, fmt.Sprintf("Target '%s' (min. %d kmer hits): %s", ref[i].Header, required, reason))
+	}
+	if len(issues) == 0 {
+		issues = append(issues, "Each target's minimum can be met, but no single construct meeting all of them was found - try more iterations or lower minimums")
+	}
+	return issues
+}
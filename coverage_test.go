@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_combineMinHits(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    int
+		perTarget []int
+		want      []int
+	}{
+		{name: "none", global: 0, perTarget: nil, want: nil},
+		{name: "perTargetZero", global: 0, perTarget: []int{0, 0, 0}, want: nil},
+		{name: "globalOnly", global: 2, perTarget: nil, want: []int{2, 2, 2}},
+		{name: "larger", global: 2, perTarget: []int{0, 5, 1}, want: []int{2, 5, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := combineMinHits(tt.global, tt.perTarget, 3); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("combineMinHits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_maxWindowHits(t *testing.T) {
+	goodKmers := testKmerTable(map[string][]int{
+		"AAAC": {1},
+		"CCGT": {1},
+		"CGTT": {1},
+	})
+	if got := maxWindowHits("AAAACCGTTT", goodKmers, 4, 6); got != 2 {
+		t.Errorf("maxWindowHits() = %v, want 2", got)
+	}
+	if got := maxWindowHits("AAAACCGTTT", goodKmers, 4, 10); got != 3 {
+		t.Errorf("maxWindowHits() = %v, want 3", got)
+	}
+}
+
+func Test_diagnoseCoverage(t *testing.T) {
+	ref := []*HeaderRef{
+		{Header: "ref_1", Seq: "AAAACCGTTT"},
+		{Header: "ref_2", Seq: "GGGGTTTT"},
+		{Header: "ref_3", Seq: "ACGTACGTAC"},
+		{Header: "ref_4", Seq: "CCCCGGGG"},
+	}
+	// ref_2's kmers were all removed by off-target filtering, and only 2 of ref_4's remain
+	goodKmers := testKmerTable(map[string][]int{
+		"AAAA": {1, 0, 0, 0},
+		"AAAC": {1, 0, 0, 0},
+		"AACC": {1, 0, 0, 0},
+		"ACGT": {0, 0, 1, 0},
+		"CGTA": {0, 0, 1, 0},
+		"CCCC": {0, 0, 0, 1},
+		"GGGG": {0, 0, 0, 1},
+	})
+	preFilterCounts := []int{7, 5, 4, 5}
+	p := searchParams{kmerLen: 4, constructLen: 7, minHits: []int{3, 1, 2, 3}}
+	unconstrained := &construct{kmerHits: []int{3, 0, 1, 0}}
+	got := diagnoseCoverage(ref, goodKmers, preFilterCounts, p, unconstrained)
+	want := []string{
+		"Target 'ref_2' (min. 1 kmer hits): all of its 5 kmers were removed",
+		"Target 'ref_3' (min. 2 kmer hits): the best construct without minimums has 1 hits",
+		"Target 'ref_4' (min. 3 kmer hits): only 2 of its 5 kmers remain",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("diagnoseCoverage() = %v, want %d issues", got, len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("diagnoseCoverage()[%d] = %v, want prefix %v", i, got[i], want[i])
+		}
+	}
+
+	p.minHits = []int{5, 0, 0, 0}
+	got = diagnoseCoverage(ref, goodKmers, preFilterCounts, p, unconstrained)
+	if len(got) != 1 || !strings.Contains(got[0], "a 7 nt construct only has 4 kmers") {
+		t.Errorf("diagnoseCoverage() = %v, want construct length issue", got)
+	}
+}
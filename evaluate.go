@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// otKmerHit is a kmer of an evaluated sequence that matches an off-target
+type otKmerHit struct {
+	pos  int // 0-based position in the evaluated sequence
+	kmer string
+}
+
+// evalInput parses the command line parameters for an evaluate run
+func evalInput(args []string) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("dsRNAmax evaluate", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	fs.StringVar(&opts.evalSeq, "seq", "", "dsRNA sense arm sequence to evaluate")
+	fs.StringVar(&opts.candidates, "candidates", "", "FASTA/FASTQ file of dsRNA sense arm sequences to evaluate, optionally gzip/bgzip/zstd compressed")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	setCommonDefaults(fs, opts)
+	if opts.refFile == "" {
+		return opts, errors.New("error: no target FASTA file was specificed")
+	}
+	if (opts.evalSeq == "") == (opts.candidates == "") {
+		return opts, errors.New("error: specify either a sequence (-seq) or a candidates file (-candidates) to evaluate")
+	}
+	if err := setProgressMode(opts.progress, os.Stderr); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// runEvaluate scores existing dsRNA sense arm sequences against the targets and off-targets, without designing a construct
+func runEvaluate(args []string) {
+	opts, err := evalInput(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := offTargetPolicy(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var candidates []*HeaderRef
+	if opts.evalSeq != "" {
+		candidates = []*HeaderRef{{Header: "sequence", Seq: opts.evalSeq}}
+	} else {
+		log.Println("Loading candidate sequences...")
+		candidates = RefLoad(opts.candidates)
+	}
+	for _, c := range candidates {
+		c.Seq = normalizeCandidate(c.Seq)
+		if err := validateCandidate(c.Seq, opts.kmerLength); err != nil {
+			log.Fatalf("Candidate '%s': %v", c.Header, err)
+		}
+	}
+
+	log.Println("Loading target sequences...")
+	ref := RefLoad(opts.refFile)
+	var weights []float64
+	if opts.weightsFile != "" {
+		log.Printf("Loading target weights from %s...", opts.weightsFile)
+		weights, _, err = loadTargetWeights(opts.weightsFile, ref)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	obj, err := newObjective(opts.objective, weights)
+	if err != nil {
+		log.Fatal(err)
+	}
+	eff, err := newSiRNAEfficacy(opts.siRNAScore, opts.siRNAWeight, opts.kmerLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+	goodKmers, err := getKmers(ref, opts.kmerLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+	params := searchParams{kmerLen: opts.kmerLength, seqLen: len(ref), obj: obj}
+	if eff != nil && eff.weighted {
+		params.kmerWeights = eff.kmerWeights(goodKmers)
+	}
+
+	report, err := newJSONReport("evaluate", opts, ref)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var kmerHits [][]otKmerHit
+	var otHits [][]otHit
+	if opts.otRefFiles != "" || opts.otKmerFile != "" {
+		seqs := make([]string, len(candidates))
+		for i, c := range candidates {
+			seqs[i] = c.Seq
+		}
+		kmerHits, otHits, err = offTargetKmerHits(seqs, opts, policy)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for i, c := range candidates {
+		if len(candidates) > 1 {
+			fmt.Printf("\n=== Candidate %d of %d: %s ===\n", i+1, len(candidates), c.Header)
+		}
+		selConstruct := scoreConstruct(goodKmers, c.Seq, params)
+		outputResults(goodKmers, &opts.kmerLength, selConstruct, ref, obj, eff, numberedFileName(opts.csv, i, len(candidates)))
+		report.addConstruct(c.Header, goodKmers, opts.kmerLength, selConstruct, ref, obj, eff)
+		if kmerHits != nil {
+			outputOffTargetHits(kmerHits[i], c.Seq, opts.kmerLength)
+			report.setOffTargetKmers(len(kmerHits[i]))
+			outputOffTargetRecords(summarizeOTRecords(otHits[i]))
+			if opts.otReport != "" {
+				reportFile := numberedFileName(opts.otReport, i, len(candidates))
+				if err := writeOTReport(reportFile, otHits[i]); err != nil {
+					log.Fatal(err)
+				}
+				fmt.Println("Off-target report written to", reportFile)
+			}
+		}
+	}
+	writeJSONReport(report, opts.json)
+}
+
+// normalizeCandidate uppercases a sequence, removes whitespace and converts U to T
+func normalizeCandidate(seq string) string {
+	seq = strings.Join(strings.Fields(seq), "")
+	return strings.ReplaceAll(strings.ToUpper(seq), "U", "T")
+}
+
+// validateCandidate checks a sequence to evaluate contains only ACGT and is at least one kmer long
+func validateCandidate(seq string, kmerLen int) error {
+	if len(seq) < kmerLen {
+		return fmt.Errorf("sequence length (%d) must be >= kmer length (%d)", len(seq), kmerLen)
+	}
+	if i := strings.IndexFunc(seq, func(r rune) bool { return !strings.ContainsRune("ACGT", r) }); i >= 0 {
+		return fmt.Errorf("invalid nucleotide '%c' at position %d", seq[i], i+1)
+	}
+	return nil
+}
+
+// offTargetKmerHits returns the kmers of each sequence matching an off-target under the run's off-target settings, in
+// sequence order, along with every off-target match of those kmers.  A kmer occurring more than once is reported at
+// each position.  The kmers of all the sequences are screened together, so the off-targets are read once.
+func offTargetKmerHits(seqs []string, opts *options, policy otPolicy) ([][]otKmerHit, [][]otHit, error) {
+	var kmers []string
+	for _, seq := range seqs {
+		for i := 0; i <= len(seq)-opts.kmerLength; i++ {
+			kmers = append(kmers, seq[i:i+opts.kmerLength])
+		}
+	}
+	remaining, err := kmerTableOf(kmers, opts.kmerLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec := &otRecorder{}
+	if err := removeOffTargets(remaining, opts, policy, rec); err != nil {
+		return nil, nil, err
+	}
+	matches := make(map[string][]otHit)
+	for _, hit := range rec.sortedHits() {
+		matches[hit.kmer] = append(matches[hit.kmer], hit)
+	}
+
+	kmerHits, otHits := make([][]otKmerHit, len(seqs)), make([][]otHit, len(seqs))
+	for s, seq := range seqs {
+		seen := make(map[string]bool)
+		for i := 0; i <= len(seq)-opts.kmerLength; i++ {
+			kmer := seq[i : i+opts.kmerLength]
+			if !remaining.screenedOut(kmer) {
+				continue
+			}
+			kmerHits[s] = append(kmerHits[s], otKmerHit{pos: i, kmer: kmer})
+			if !seen[kmer] {
+				seen[kmer] = true
+				otHits[s] = append(otHits[s], matches[kmer]...)
+			}
+		}
+		sortOTHits(otHits[s])
+	}
+	return kmerHits, otHits, nil
+}
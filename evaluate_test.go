@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_normalizeCandidate(t *testing.T) {
+	if got := normalizeCandidate("acgu\nACGU "); got != "ACGTACGT" {
+		t.Errorf("normalizeCandidate() = %v, want ACGTACGT", got)
+	}
+}
+
+func Test_validateCandidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		seq     string
+		wantErr bool
+	}{
+		{name: "valid", seq: "ACGTACGT", wantErr: false},
+		{name: "tooShort", seq: "ACG", wantErr: true},
+		{name: "invalidNucleotide", seq: "ACGNACGT", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCandidate(tt.seq, 4); (err != nil) != tt.wantErr {
+				t.Errorf("validateCandidate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_constructHits(t *testing.T) {
+	goodKmers := testKmerTable(map[string][]int{"AAAA": {1, 0}, "AAAC": {1, 1}})
+	if got := constructHits(goodKmers, "AAAAAC"); !reflect.DeepEqual(got, []int{3, 1}) {
+		t.Errorf("constructHits() = %v, want [3 1]", got)
+	}
+}
+
+func Test_offTargetKmerHits(t *testing.T) {
+	otFile := filepath.Join(t.TempDir(), "ot.fa")
+	// Matches the reverse complement of GGTTAC
+	if err := os.WriteFile(otFile, []byte(">ot\nTTGTAACCTT\n"), 0644); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+	opts := &options{otRefFiles: otFile, kmerLength: 6, otKmerLength: 6}
+	// Each sequence gets only its own hits, although they're screened together
+	got, otHits, err := offTargetKmerHits([]string{"CCGGTTACGG", "AAAAAAAA", "GGTTACGGTTAC"}, opts, otPolicy{kmerLen: 6})
+	if err != nil {
+		t.Fatalf("offTargetKmerHits() error = %v", err)
+	}
+	want := [][]otKmerHit{{{pos: 2, kmer: "GGTTAC"}}, nil, {{pos: 0, kmer: "GGTTAC"}, {pos: 6, kmer: "GGTTAC"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("offTargetKmerHits() = %v, want %v", got, want)
+	}
+	match := otHit{kmer: "GGTTAC", match: "GGTTAC", file: otFile, header: "ot", pos: 3, strand: '-'}
+	wantOT := [][]otHit{{match}, nil, {match}}
+	if !reflect.DeepEqual(otHits, wantOT) {
+		t.Errorf("offTargetKmerHits() off-target matches = %v, want %v", otHits, wantOT)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// searchNames lists the supported construct searches
+var searchNames = []string{"greedy", "exhaustive"}
+
+// exhaustiveMaxTable is the max. no. of entries in the exhaustive search's walk bound table
+const exhaustiveMaxTable = 1 << 26
+
+// unitig is a maximal non-branching path of the target kmers' de Bruijn graph
+type unitig struct {
+	seq    string      // the unitig's kmers, spelled out
+	n      int         // no. of kmers
+	prefix [][]float64 // hits to each target of the first j kmers, for j = 0 to n
+	mean   []float64   // weighted mean hits of the first j kmers, for j = 0 to n
+	succ   []int       // unitigs whose first kmer follows this unitig's last kmer
+	tail   [][]float64 // max. hits to each target of a walk of n+1+j kmers from the first kmer (nil if there is none)
+	// max. weighted mean hits of a single walk of n+1+j kmers from the first kmer (-1 if there is none)
+	meanTail []float64
+}
+
+// kmerGraph is the de Bruijn graph of the target kmers, compacted into unitigs.  Edges join kmers overlapping by
+// kmerLen-1 nt, so every construct made only of target kmers is a walk through the graph.
+type kmerGraph struct {
+	unitigs []*unitig
+	kmerLen int
+	seqLen  int
+	obj     objective
+}
+
+// newKmerGraph builds the unitig graph of goodKmers, with each kmer's hits to each target weighted as in the search
+// objective
+func newKmerGraph(goodKmers *kmerTable, p searchParams) *kmerGraph {
+	kmers := goodKmers.kmers() // in kmer order
+	next := func(kmer string) []string {
+		var found []string
+		for _, nuc := range []string{"A", "C", "G", "T"} {
+			if goodKmers.has(kmer[1:] + nuc) {
+				found = append(found, kmer[1:]+nuc)
+			}
+		}
+		return found
+	}
+	prev := func(kmer string) []string {
+		var found []string
+		for _, nuc := range []string{"A", "C", "G", "T"} {
+			if goodKmers.has(nuc + kmer[:len(kmer)-1]) {
+				found = append(found, nuc+kmer[:len(kmer)-1])
+			}
+		}
+		return found
+	}
+
+	g := &kmerGraph{kmerLen: p.kmerLen, seqLen: p.seqLen, obj: p.obj}
+	unitigOf := make(map[string]int, len(kmers))
+	var lasts []string
+	addUnitig := func(head string) {
+		u := &unitig{seq: head, prefix: [][]float64{make([]float64, p.seqLen)}, mean: []float64{0}}
+		for kmer := head; ; {
+			unitigOf[kmer] = len(g.unitigs)
+			u.n++
+			hits := append([]float64(nil), u.prefix[len(u.prefix)-1]...)
+			row, _ := goodKmers.lookup(kmer)
+			w := 1.0
+			if p.kmerWeights != nil {
+				w = p.kmerWeights[row]
+			}
+			goodKmers.addWeightedHits(row, hits, w)
+			u.prefix = append(u.prefix, hits)
+			u.mean = append(u.mean, p.obj.weightedMean(hits))
+			nexts := next(kmer)
+			if len(nexts) != 1 || len(prev(nexts[0])) != 1 {
+				lasts = append(lasts, kmer)
+				break
+			}
+			if _, seen := unitigOf[nexts[0]]; seen {
+				lasts = append(lasts, kmer)
+				break
+			}
+			kmer = nexts[0]
+			u.seq += kmer[len(kmer)-1:]
+		}
+		g.unitigs = append(g.unitigs, u)
+	}
+	// A kmer starts a unitig unless it is the only successor of its only predecessor
+	for _, kmer := range kmers {
+		if preds := prev(kmer); len(preds) != 1 || preds[0] == kmer || len(next(preds[0])) != 1 {
+			addUnitig(kmer)
+		}
+	}
+	// What remains are isolated cycles, each broken at its first kmer
+	for _, kmer := range kmers {
+		if _, seen := unitigOf[kmer]; !seen {
+			addUnitig(kmer)
+		}
+	}
+	for i, u := range g.unitigs {
+		for _, kmer := range next(lasts[i]) {
+			u.succ = append(u.succ, unitigOf[kmer])
+		}
+	}
+	return g
+}
+
+// walk returns the max. hits to each target of a walk of r kmers from the first kmer of unitig u, or nil if there is
+// none.  Walks may repeat kmers, so this bounds the hits of any construct.
+func (g *kmerGraph) walk(u int, r int) []float64 {
+	ut := g.unitigs[u]
+	if r <= ut.n {
+		return ut.prefix[r]
+	}
+	return ut.tail[r-ut.n-1]
+}
+
+// bestNext returns the max. hits to each target of a walk of r kmers from any successor of unitig u, or nil if there
+// is none
+func (g *kmerGraph) bestNext(u int, r int) []float64 {
+	var best []float64
+	for _, v := range g.unitigs[u].succ {
+		w := g.walk(v, r)
+		if w == nil {
+			continue
+		}
+		if best == nil {
+			best = append([]float64(nil), w...)
+			continue
+		}
+		for j := range best {
+			if w[j] > best[j] {
+				best[j] = w[j]
+			}
+		}
+	}
+	return best
+}
+
+// walkMean returns the max. weighted mean hits of a single walk of r kmers from the first kmer of unitig u, or -1 if
+// there is none
+func (g *kmerGraph) walkMean(u int, r int) float64 {
+	ut := g.unitigs[u]
+	if r <= ut.n {
+		return ut.mean[r]
+	}
+	return ut.meanTail[r-ut.n-1]
+}
+
+// bestNextMean returns the max. weighted mean hits of a walk of r kmers from any successor of unitig u, or -1 if there
+// is none
+func (g *kmerGraph) bestNextMean(u int, r int) float64 {
+	best := -1.0
+	for _, v := range g.unitigs[u].succ {
+		if m := g.walkMean(v, r); m > best {
+			best = m
+		}
+	}
+	return best
+}
+
+// boundWalks fills in the max. hits of walks of up to maxLen kmers from each unitig, by increasing walk length.  The
+// weighted mean hits are maximized over single walks, whereas each target's hits are maximized separately.
+func (g *kmerGraph) boundWalks(maxLen int) error {
+	size := 0
+	for _, u := range g.unitigs {
+		if maxLen > u.n {
+			size += (maxLen - u.n) * g.seqLen
+		}
+	}
+	if size > exhaustiveMaxTable {
+		return fmt.Errorf("exhaustive search needs a %s entry bound table (max. %s) - use a shorter construct, fewer targets or the greedy search", intWithCommas(size), intWithCommas(exhaustiveMaxTable))
+	}
+	for r := 1; r <= maxLen; r++ {
+		for i, u := range g.unitigs {
+			if r <= u.n {
+				continue
+			}
+			best := g.bestNext(i, r-u.n)
+			if best != nil {
+				best = addHits(best, u.prefix[u.n])
+			}
+			u.tail = append(u.tail, best)
+			bestMean := g.bestNextMean(i, r-u.n)
+			if bestMean >= 0 {
+				bestMean += u.mean[u.n]
+			}
+			u.meanTail = append(u.meanTail, bestMean)
+		}
+	}
+	return nil
+}
+
+// addHits returns the element-wise sum of two hit vectors
+func addHits(a []float64, b []float64) []float64 {
+	sum := make([]float64, len(a))
+	for i := range a {
+		sum[i] = a[i] + b[i]
+	}
+	return sum
+}
+
+// subHits returns the element-wise difference of two hit vectors
+func subHits(a []float64, b []float64) []float64 {
+	diff := make([]float64, len(a))
+	for i := range a {
+		diff[i] = a[i] - b[i]
+	}
+	return diff
+}
+
+// searchBound is the outcome of an exhaustive construct search
+type searchBound struct {
+	best       *construct // best construct found - the greedy construct unless a better one was found (nil if none)
+	upperBound float64    // proven upper bound on the objective score of any construct, including one repeating a kmer
+	complete   bool       // whether the search finished, so best is optimal among constructs without a repeated kmer
+	nodes      int        // search nodes expanded
+}
+
+// pathStep is the kmers of one unitig on a search path
+type pathStep struct {
+	unitig, offset, n int
+}
+
+// exhaustiveSearch is the state of a branch-and-bound search over the walks of a kmerGraph
+type exhaustiveSearch struct {
+	g         *kmerGraph
+	goodKmers *kmerTable
+	p         searchParams
+	maxNodes  int
+	factor    float64 // objective's weighted mean bound factor
+	best      *construct
+	bestScore float64
+	openBound float64 // highest bound of a subtree left unexplored when the node budget ran out
+	loopBound float64 // highest bound of a walk left unexplored as it repeats a kmer (re-enters a unitig)
+	truncated bool
+	cancelled bool // whether the search's context was cancelled
+	nodes     int
+	onPath    []bool
+	path      []pathStep
+}
+
+// exhaustiveConstruct finds the construct of only target kmers with the highest objective score, by branch-and-bound
+// over the walks of the target kmers' de Bruijn graph.  A subtree is pruned when its bound can't beat the best
+// construct so far, starting with the greedy construct (nil for none).  The bound is the objective of the most hits
+// each target could get from any walk of the remaining length, capped by the objective's multiple of the most weighted
+// mean hits of a single walk.  The search only builds constructs without a repeated kmer, but a greedy construct can
+// repeat one, so the bound of each walk cut off at a repeated kmer is kept, and the upper bound holds for any construct.
+// If more than maxNodes nodes are needed, or the search's context is cancelled, the search stops with the best
+// construct and upper bound found so far.
+func exhaustiveConstruct(goodKmers *kmerTable, greedy *construct, p searchParams, maxNodes int) (*searchBound, error) {
+	numKmers := p.constructLen - p.kmerLen + 1
+	if numKmers < 1 {
+		return nil, fmt.Errorf("construct length (%d) must be >= kmer length (%d)", p.constructLen, p.kmerLen)
+	}
+	g := newKmerGraph(goodKmers, p)
+	if err := g.boundWalks(numKmers); err != nil {
+		return nil, err
+	}
+	s := &exhaustiveSearch{g: g, goodKmers: goodKmers, p: p, maxNodes: maxNodes, factor: p.obj.meanFactor(p.seqLen),
+		onPath: make([]bool, len(g.unitigs))}
+	if greedy != nil {
+		s.best, s.bestScore = greedy, greedy.score
+	}
+
+	// Every construct starts at some kmer of some unitig - search from the starts with the highest bound first
+	type start struct {
+		step  pathStep
+		bound []float64
+		score float64
+	}
+	var starts []start
+	for i, u := range g.unitigs {
+		for offset := 0; offset < u.n; offset++ {
+			st := start{step: pathStep{i, offset, u.n - offset}}
+			var mean float64
+			if st.step.n >= numKmers {
+				st.step.n = numKmers
+				st.bound = subHits(u.prefix[offset+numKmers], u.prefix[offset])
+				mean = u.mean[offset+numKmers] - u.mean[offset]
+			} else if next := g.bestNext(i, numKmers-st.step.n); next != nil {
+				st.bound = addHits(subHits(u.prefix[u.n], u.prefix[offset]), next)
+				mean = u.mean[u.n] - u.mean[offset] + g.bestNextMean(i, numKmers-st.step.n)
+			} else {
+				continue
+			}
+			st.score = s.boundScore(st.bound, mean)
+			starts = append(starts, st)
+		}
+	}
+	sort.SliceStable(starts, func(i, j int) bool { return starts[i].score > starts[j].score })
+
+	for _, st := range starts {
+		if !s.promising(st.bound, st.score) {
+			continue
+		}
+		u := g.unitigs[st.step.unitig]
+		s.path = []pathStep{st.step}
+		if st.step.n == numKmers {
+			s.leaf()
+			continue
+		}
+		if s.outOfBudget() {
+			s.stop(st.score)
+			continue
+		}
+		s.onPath[st.step.unitig] = true
+		s.extend(st.step.unitig, subHits(u.prefix[u.n], u.prefix[st.step.offset]), numKmers-st.step.n)
+		s.onPath[st.step.unitig] = false
+	}
+
+	upper := s.bestScore
+	for _, bound := range []float64{s.openBound, s.loopBound} {
+		if bound > upper {
+			upper = bound
+		}
+	}
+	return &searchBound{best: s.best, upperBound: upper, complete: !s.truncated, nodes: s.nodes}, nil
+}
+
+// score returns the objective score of hits, or 0 if it can't be scored
+func (s *exhaustiveSearch) score(hits []float64) float64 {
+	score, err := s.p.obj.scoreHits(hits)
+	if err != nil {
+		return 0
+	}
+	return score
+}
+
+// boundScore returns the bound on the objective score of constructs with at most the given hits to each target and
+// weighted mean hits
+func (s *exhaustiveSearch) boundScore(hits []float64, mean float64) float64 {
+	score := s.score(hits)
+	if s.factor > 0 && s.factor*mean < score {
+		return s.factor * mean
+	}
+	return score
+}
+
+// promising reports whether a subtree with the given hit bounds could hold a better construct than the best so far.
+// Min. kmer hits count unweighted hits, so only bound the subtree when hits aren't weighted.
+func (s *exhaustiveSearch) promising(bound []float64, score float64) bool {
+	if score <= s.bestScore {
+		return false
+	}
+	if s.p.kmerWeights == nil {
+		for i, required := range s.p.minHits {
+			if bound[i] < float64(required) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// outOfBudget reports whether the search must stop, as the node budget is spent or the search was cancelled
+func (s *exhaustiveSearch) outOfBudget() bool {
+	return s.nodes >= s.maxNodes || s.cancelled
+}
+
+// stop records a promising subtree left unexplored because the node budget ran out
+func (s *exhaustiveSearch) stop(score float64) {
+	s.truncated = true
+	if score > s.openBound {
+		s.openBound = score
+	}
+}
+
+// extend searches the walks continuing r more kmers from the end of unitig u, with hits so far
+func (s *exhaustiveSearch) extend(u int, hits []float64, r int) {
+	s.nodes++
+	if s.nodes%1024 == 1 && s.p.cancelled() {
+		s.cancelled = true
+	}
+	type option struct {
+		unitig int
+		bound  []float64
+		score  float64
+	}
+	var options []option
+	mean := s.p.obj.weightedMean(hits)
+	for _, v := range s.g.unitigs[u].succ {
+		w := s.g.walk(v, r)
+		if w == nil {
+			continue
+		}
+		bound := addHits(hits, w)
+		score := s.boundScore(bound, mean+s.g.walkMean(v, r))
+		// The start unitig can only be re-entered if the walk ends before its first kmer is repeated
+		if s.onPath[v] && (v != s.path[0].unitig || r > s.path[0].offset) {
+			if s.promising(bound, score) && score > s.loopBound {
+				s.loopBound = score
+			}
+			continue
+		}
+		options = append(options, option{v, bound, score})
+	}
+	sort.SliceStable(options, func(i, j int) bool { return options[i].score > options[j].score })
+
+	for _, o := range options {
+		if !s.promising(o.bound, o.score) {
+			continue
+		}
+		v := s.g.unitigs[o.unitig]
+		if r <= v.n {
+			s.path = append(s.path, pathStep{o.unitig, 0, r})
+			s.leaf()
+			s.path = s.path[:len(s.path)-1]
+			continue
+		}
+		if s.outOfBudget() {
+			s.stop(o.score)
+			continue
+		}
+		s.onPath[o.unitig] = true
+		s.path = append(s.path, pathStep{o.unitig, 0, v.n})
+		s.extend(o.unitig, addHits(hits, v.prefix[v.n]), r-v.n)
+		s.path = s.path[:len(s.path)-1]
+		s.onPath[o.unitig] = false
+	}
+}
+
+// leaf scores the construct spelled by the current path, keeping it if it's the best so far and meets the min. kmer
+// hits and composition constraints
+func (s *exhaustiveSearch) leaf() {
+	first := s.path[0]
+	seq := s.g.unitigs[first.unitig].seq[first.offset : first.offset+first.n+s.g.kmerLen-1]
+	for _, step := range s.path[1:] {
+		seq += s.g.unitigs[step.unitig].seq[s.g.kmerLen-1 : s.g.kmerLen-1+step.n]
+	}
+	c := scoreConstruct(s.goodKmers, seq, s.p)
+	if c.score <= s.bestScore {
+		return
+	}
+	for i, required := range s.p.minHits {
+		if c.kmerHits[i] < required {
+			return
+		}
+	}
+	if !s.p.constraints.satisfied(seq) {
+		return
+	}
+	s.best, s.bestScore = c, c.score
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bruteForceBest returns the best objective score of any construct of kmers from goodKmers with no repeated kmer,
+// by enumerating every path
+func bruteForceBest(goodKmers *kmerTable, p searchParams) float64 {
+	numKmers := p.constructLen - p.kmerLen + 1
+	best := 0.0
+	var walk func(seq string, used map[string]bool)
+	walk = func(seq string, used map[string]bool) {
+		if len(seq) == p.constructLen {
+			c := scoreConstruct(goodKmers, seq, p)
+			for i, required := range p.minHits {
+				if c.kmerHits[i] < required {
+					return
+				}
+			}
+			if c.score > best && p.constraints.satisfied(seq) {
+				best = c.score
+			}
+			return
+		}
+		for _, nuc := range []string{"A", "C", "G", "T"} {
+			kmer := seq[len(seq)-p.kmerLen+1:] + nuc
+			if goodKmers.has(kmer) && !used[kmer] {
+				used[kmer] = true
+				walk(seq+nuc, used)
+				delete(used, kmer)
+			}
+		}
+	}
+	for _, kmer := range goodKmers.kmers() {
+		if numKmers == 1 {
+			walk(kmer, nil)
+			continue
+		}
+		walk(kmer, map[string]bool{kmer: true})
+	}
+	return best
+}
+
+// randomTargets returns n related targets - random mutants of a random sequence
+func randomTargets(r *rand.Rand, n int, length int, mutations int) []*HeaderRef {
+	var base strings.Builder
+	for i := 0; i < length; i++ {
+		base.WriteByte("ACGT"[r.Intn(4)])
+	}
+	ref := make([]*HeaderRef, n)
+	for i := range ref {
+		seq := []byte(base.String())
+		for m := 0; m < mutations; m++ {
+			seq[r.Intn(length)] = "ACGT"[r.Intn(4)]
+		}
+		ref[i] = &HeaderRef{Header: "t" + string(rune('0'+i)), Seq: string(seq)}
+	}
+	return ref
+}
+
+func Test_newKmerGraph(t *testing.T) {
+	// A bubble: two paths from ACG to TC, plus an isolated self-loop
+	ref := []*HeaderRef{{Header: "a", Seq: "ACGTTC"}, {Header: "b", Seq: "ACGATC"}}
+	targetKmers, _ := getKmers(ref, 3)
+	presence := tablePresence(targetKmers)
+	presence["AAA"] = []int{1, 1}
+	goodKmers := testKmerTable(presence)
+	p := searchParams{kmerLen: 3, seqLen: 2, obj: objective{}}
+	g := newKmerGraph(goodKmers, p)
+
+	kmerCount := 0
+	var seqs []string
+	for _, u := range g.unitigs {
+		kmerCount += u.n
+		seqs = append(seqs, u.seq)
+	}
+	if kmerCount != goodKmers.len() {
+		t.Errorf("newKmerGraph() unitigs hold %d kmers, want %d", kmerCount, goodKmers.len())
+	}
+	// ACG branches to CGT and CGA, which both join at TC
+	want := []string{"AAA", "ACG", "CGATC", "CGTTC"}
+	if !reflect.DeepEqual(seqs, want) {
+		t.Errorf("newKmerGraph() unitigs = %v, want %v", seqs, want)
+	}
+	for i, u := range g.unitigs {
+		if u.seq == "ACG" && len(u.succ) != 2 {
+			t.Errorf("unitig ACG has %d successors, want 2", len(u.succ))
+		}
+		if u.seq == "AAA" && (len(u.succ) != 1 || u.succ[0] != i) {
+			t.Errorf("unitig AAA successors = %v, want itself", u.succ)
+		}
+		if got := u.prefix[u.n]; u.seq == "CGATC" && !reflect.DeepEqual(got, []float64{0, 3}) {
+			t.Errorf("unitig CGATC hits = %v, want [0 3]", got)
+		}
+	}
+}
+
+func Test_exhaustiveConstruct(t *testing.T) {
+	tests := []struct {
+		name        string
+		objective   string
+		targets     int
+		mutations   int
+		minHits     []int
+		constraints bool
+		weighted    bool
+	}{
+		{name: "median", objective: "median", targets: 3, mutations: 6},
+		{name: "min", objective: "min", targets: 4, mutations: 8},
+		{name: "geomean", objective: "geomean", targets: 3, mutations: 10},
+		{name: "minHits", objective: "mean", targets: 3, mutations: 6, minHits: []int{5, 5, 5}},
+		{name: "constraints", objective: "median", targets: 3, mutations: 6, constraints: true},
+		{name: "weighted", objective: "median", targets: 3, mutations: 6, weighted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			ref := randomTargets(r, tt.targets, 60, tt.mutations)
+			goodKmers, _ := getKmers(ref, 7)
+			obj, err := newObjective(tt.objective, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := searchParams{kmerLen: 7, seqLen: tt.targets, constructLen: 20, iterations: 5, seed: 1, obj: obj, minHits: tt.minHits}
+			if tt.constraints {
+				if p.constraints, err = newSeqConstraints(2, 50, 0, 100, "", 20); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.weighted {
+				p.kmerWeights = make([]float64, len(goodKmers.keys))
+				for row := range p.kmerWeights {
+					p.kmerWeights[row] = gcContent(goodKmers.kmer(int32(row))) / 100
+				}
+			}
+			greedy := conBestConstruct(goodKmers, kmerAbun(goodKmers, nil), p)
+			sb, err := exhaustiveConstruct(goodKmers, greedy, p, 1000000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := bruteForceBest(goodKmers, p)
+			if !sb.complete || sb.best == nil {
+				t.Fatalf("exhaustiveConstruct() = %+v, want a complete search", sb)
+			}
+			if sb.best.score != want || sb.upperBound != want {
+				t.Errorf("exhaustiveConstruct() score = %v, upper bound = %v, want %v", sb.best.score, sb.upperBound, want)
+			}
+			if greedy != nil && greedy.score > sb.best.score {
+				t.Errorf("exhaustiveConstruct() score %v is below the greedy score %v", sb.best.score, greedy.score)
+			}
+			if len(sb.best.seq) != p.constructLen || !p.constraints.satisfied(sb.best.seq) {
+				t.Errorf("exhaustiveConstruct() construct %s breaks the length or constraints", sb.best.seq)
+			}
+
+			// Without a node budget, the bound still covers the optimum
+			sb, err = exhaustiveConstruct(goodKmers, nil, p, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sb.complete || sb.upperBound < want {
+				t.Errorf("exhaustiveConstruct() with no nodes = %+v, want an incomplete search bounding %v", sb, want)
+			}
+
+			// Nor once the search is cancelled, which stops it within a check interval
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			p.ctx = ctx
+			sb, err = exhaustiveConstruct(goodKmers, nil, p, 1000000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sb.nodes > 1024 || sb.upperBound < want || (sb.complete && sb.best.score != want) {
+				t.Errorf("exhaustiveConstruct() once cancelled = %+v, want a search stopped early bounding %v", sb, want)
+			}
+		})
+	}
+}
+
+func Test_exhaustiveConstructRepeats(t *testing.T) {
+	// The target's kmers form a cycle, so every 9 nt construct repeats a kmer - the search builds none, but the upper
+	// bound still covers them
+	ref := []*HeaderRef{{Header: "t", Seq: "ACGACGACGACGACG"}}
+	goodKmers, _ := getKmers(ref, 3)
+	obj, _ := newObjective("mean", nil)
+	p := searchParams{kmerLen: 3, seqLen: len(ref), constructLen: 9, obj: obj}
+	repeated := scoreConstruct(goodKmers, "ACGACGACG", p)
+	for _, greedy := range []*construct{nil, repeated} {
+		sb, err := exhaustiveConstruct(goodKmers, greedy, p, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sb.complete || sb.upperBound < repeated.score {
+			t.Errorf("exhaustiveConstruct() = %+v, want a complete search bounding %v", sb, repeated.score)
+		}
+	}
+}
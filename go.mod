@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	github.com/adrg/strutil v0.2.3
+	github.com/klauspost/compress v1.15.15
 	github.com/olekukonko/tablewriter v0.0.5
 )
 
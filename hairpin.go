@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultSpacer is the loop of a hairpin cassette when no spacer is given - a synthetic 60 nt sequence without
+// homopolymer runs or inverted repeats that could pair with itself
+const defaultSpacer = "GACCTCATTGCCGTAATAAGAGCCTATGATCTGCTAGTCGCTGGAATCGATTGCTGCTAC"
+
+// hairpin is an ihpRNA cassette - the sense arm, a spacer, and the antisense arm (the sense arm reverse complemented)
+type hairpin struct {
+	seq       string
+	senseLen  int
+	spacerLen int
+}
+
+// assembleHairpin joins the sense arm, spacer and antisense arm into a hairpin cassette
+func assembleHairpin(sense string, spacer string) hairpin {
+	return hairpin{seq: sense + spacer + reverseComplement(sense), senseLen: len(sense), spacerLen: len(spacer)}
+}
+
+// loadSpacer returns the hairpin spacer given as a sequence, or as a FASTA/FASTQ file whose first record is the
+// spacer.  An empty spec gives the default spacer.
+func loadSpacer(spec string) (string, error) {
+	if spec == "" {
+		return defaultSpacer, nil
+	}
+	spacer := spec
+	if _, err := os.Stat(spec); err == nil {
+		records := RefLoad(spec)
+		if len(records) == 0 {
+			return "", fmt.Errorf("spacer file %s has no sequences", spec)
+		}
+		spacer = records[0].Seq
+	}
+	spacer = normalizeCandidate(spacer)
+	if i := strings.IndexFunc(spacer, func(r rune) bool { return !strings.ContainsRune("ACGT", r) }); i >= 0 {
+		return "", fmt.Errorf("spacer has an invalid nucleotide '%c' at position %d", spacer[i], i+1)
+	}
+	if spacer == "" {
+		return "", fmt.Errorf("spacer is empty")
+	}
+	return spacer, nil
+}
+
+// newKmerRegion returns the part of the cassette holding every kmer not already in the sense or antisense arm - the
+// spacer and the kmers spanning its junctions with the arms - and its offset in the cassette
+func (h hairpin) newKmerRegion(kmerLen int) (string, int) {
+	start := h.senseLen - kmerLen + 1
+	if start < 0 {
+		start = 0
+	}
+	end := h.senseLen + h.spacerLen + kmerLen - 1
+	if end > len(h.seq) {
+		end = len(h.seq)
+	}
+	return h.seq[start:end], start
+}
+
+// hairpinFeature is an annotated region of a hairpin cassette, 1-based and inclusive
+type hairpinFeature struct {
+	label      string
+	start, end int
+	complement bool
+}
+
+// features returns the sense arm, spacer and antisense arm of the cassette
+func (h hairpin) features() []hairpinFeature {
+	return []hairpinFeature{
+		{"sense arm", 1, h.senseLen, false},
+		{"spacer", h.senseLen + 1, h.senseLen + h.spacerLen, false},
+		{"antisense arm", h.senseLen + h.spacerLen + 1, len(h.seq), true},
+	}
+}
+
+// writeHairpinFasta writes a hairpin cassette to a FASTA file, 60 nt per line
+func writeHairpinFasta(fileName string, name string, h hairpin) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintf(file, ">%s sense=1-%d spacer=%d-%d antisense=%d-%d\n", name, h.senseLen, h.senseLen+1,
+		h.senseLen+h.spacerLen, h.senseLen+h.spacerLen+1, len(h.seq)); err != nil {
+		return err
+	}
+	for i := 0; i < len(h.seq); i += 60 {
+		end := i + 60
+		if end > len(h.seq) {
+			end = len(h.seq)
+		}
+		if _, err := fmt.Fprintln(file, h.seq[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHairpinGenBank writes a hairpin cassette to a GenBank file, with the sense arm, spacer and antisense arm as
+// misc_feature annotations
+func writeHairpinGenBank(fileName string, name string, h hairpin) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var sb strings.Builder
+	locus := name
+	if len(locus) > 16 {
+		locus = locus[:16]
+	}
+	date := strings.ToUpper(time.Now().Format("02-Jan-2006"))
+	fmt.Fprintf(&sb, "LOCUS       %-16s %11d bp    DNA     linear   SYN %s\n", locus, len(h.seq), date)
+	fmt.Fprintf(&sb, "DEFINITION  dsRNAmax hairpin (ihpRNA) cassette %s.\n", name)
+	sb.WriteString("ACCESSION   .\nVERSION     .\nKEYWORDS    .\nSOURCE      synthetic DNA construct\n")
+	sb.WriteString("  ORGANISM  synthetic DNA construct\n            other sequences; artificial sequences.\n")
+	sb.WriteString("FEATURES             Location/Qualifiers\n")
+	for _, f := range h.features() {
+		location := fmt.Sprintf("%d..%d", f.start, f.end)
+		if f.complement {
+			location = "complement(" + location + ")"
+		}
+		fmt.Fprintf(&sb, "     misc_feature    %s\n                     /label=\"%s\"\n", location, f.label)
+	}
+	sb.WriteString("ORIGIN\n")
+	seq := strings.ToLower(h.seq)
+	for i := 0; i < len(seq); i += 60 {
+		fmt.Fprintf(&sb, "%9d", i+1)
+		for j := i; j < i+60 && j < len(seq); j += 10 {
+			end := j + 10
+			if end > len(seq) {
+				end = len(seq)
+			}
+			sb.WriteString(" " + seq[j:end])
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("//\n")
+	_, err = file.WriteString(sb.String())
+	return err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_assembleHairpin(t *testing.T) {
+	h := assembleHairpin("AACCG", "TTT")
+	if h.seq != "AACCGTTTCGGTT" || h.senseLen != 5 || h.spacerLen != 3 {
+		t.Errorf("assembleHairpin() = %+v, want AACCGTTTCGGTT", h)
+	}
+	want := []hairpinFeature{{"sense arm", 1, 5, false}, {"spacer", 6, 8, false}, {"antisense arm", 9, 13, true}}
+	if got := h.features(); !reflect.DeepEqual(got, want) {
+		t.Errorf("features() = %v, want %v", got, want)
+	}
+	// Kmers spanning the sense arm-spacer junction to the spacer-antisense arm junction
+	region, offset := h.newKmerRegion(4)
+	if region != "CCGTTTCGG" || offset != 2 {
+		t.Errorf("newKmerRegion() = %s, %d, want CCGTTTCGG, 2", region, offset)
+	}
+}
+
+func Test_loadSpacer(t *testing.T) {
+	if got, err := loadSpacer(""); err != nil || got != defaultSpacer {
+		t.Errorf("loadSpacer(\"\") = %s, %v, want the default spacer", got, err)
+	}
+	if got, err := loadSpacer("acgu\nacgt"); err != nil || got != "ACGTACGT" {
+		t.Errorf("loadSpacer() = %s, %v, want ACGTACGT", got, err)
+	}
+	if _, err := loadSpacer("ACGXT"); err == nil {
+		t.Error("loadSpacer() error = nil, want an error for an invalid nucleotide")
+	}
+	file := filepath.Join(t.TempDir(), "spacer.fa")
+	if err := os.WriteFile(file, []byte(">intron\nGTAAGT\nTTTCAG\n>other\nAAAA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadSpacer(file); err != nil || got != "GTAAGTTTTCAG" {
+		t.Errorf("loadSpacer(file) = %s, %v, want GTAAGTTTTCAG", got, err)
+	}
+}
+
+func Test_defaultSpacer(t *testing.T) {
+	if hasInternalRepeat(defaultSpacer) {
+		t.Error("defaultSpacer has an internal repeat")
+	}
+}
+
+func Test_writeHairpin(t *testing.T) {
+	dir := t.TempDir()
+	sense := strings.Repeat("ACGTTGCA", 10)
+	h := assembleHairpin(sense, "GGGAAATTT")
+
+	fastaFile := filepath.Join(dir, "hp.fa")
+	if err := writeHairpinFasta(fastaFile, "hp", h); err != nil {
+		t.Fatal(err)
+	}
+	records := RefLoad(fastaFile)
+	if len(records) != 1 || records[0].Seq != h.seq || !strings.HasPrefix(records[0].Header, "hp sense=1-80 spacer=81-89 antisense=90-169") {
+		t.Errorf("writeHairpinFasta() wrote %+v", records)
+	}
+
+	genBankFile := filepath.Join(dir, "hp.gb")
+	if err := writeHairpinGenBank(genBankFile, "hp", h); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(genBankFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gb := string(data)
+	for _, want := range []string{
+		"LOCUS       hp                       169 bp    DNA     linear   SYN ",
+		"     misc_feature    1..80\n                     /label=\"sense arm\"\n",
+		"     misc_feature    81..89\n                     /label=\"spacer\"\n",
+		"     misc_feature    complement(90..169)\n",
+		"ORIGIN\n        1 acgttgcaac gttgcaacgt tgcaacgttg caacgttgca acgttgcaac gttgcaacgt\n",
+		"      121 ",
+		"\n//\n",
+	} {
+		if !strings.Contains(gb, want) {
+			t.Errorf("writeHairpinGenBank() output missing %q", want)
+		}
+	}
+	// The ORIGIN block holds the whole cassette
+	origin := gb[strings.Index(gb, "ORIGIN\n")+7 : strings.Index(gb, "//")]
+	seq := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return -1
+	}, origin)
+	if seq != h.seq {
+		t.Errorf("writeHairpinGenBank() ORIGIN = %s, want %s", seq, h.seq)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// jsonSchemaVersion is the version of the -json output schema.  It changes whenever a field is renamed or removed, or
+// its meaning changes - new fields may be added without a change.
+const jsonSchemaVersion = "1.0"
+
+// jsonReport is the complete results of a run, as written by -json.  A nil jsonReport discards results.
+type jsonReport struct {
+	SchemaVersion string          `json:"schema_version"`
+	Version       string          `json:"dsrnamax_version"`
+	Mode          string          `json:"mode"` // "design" or "evaluate"
+	Parameters    jsonParameters  `json:"parameters"`
+	Inputs        []jsonInput     `json:"inputs"`
+	Targets       []string        `json:"targets"` // target headers, indexed by the targets of each kmer
+	OffTargets    *jsonOffTargets `json:"off_targets,omitempty"`
+	Search        *jsonSearch     `json:"exhaustive_search,omitempty"`
+	Refinement    *jsonRefinement `json:"refinement,omitempty"`
+	LengthCurve   []jsonLength    `json:"length_curve,omitempty"`   // -constructLen range runs only
+	PanelCoverage []jsonCoverage  `json:"panel_coverage,omitempty"` // -panel runs only, indexed as targets
+	StoppedEarly  string          `json:"stopped_early,omitempty"`  // "timeout" or "interrupted" if the search was stopped early
+	Constructs    []jsonConstruct `json:"constructs"`
+}
+
+// jsonParameters are the run's settings.  Settings that don't apply to the mode are left at their zero value.
+type jsonParameters struct {
+	KmerLength      int     `json:"kmer_length"`
+	OTKmerLength    int     `json:"ot_kmer_length"`
+	OTMismatches    int     `json:"ot_mismatches"`
+	OTPolicy        string  `json:"ot_policy"`
+	OTSeedExtra     int     `json:"ot_seed_extra"`
+	OTWobble        bool    `json:"ot_wobble"`
+	Objective       string  `json:"objective"`
+	SiRNAScore      string  `json:"sirna_score"`
+	SiRNAWeight     bool    `json:"sirna_weight"`
+	ConstructLength string  `json:"construct_length"`
+	LengthStep      int     `json:"length_step"`
+	LengthSelect    string  `json:"length_select"`
+	LengthPenalty   float64 `json:"length_penalty"`
+	Iterations      int     `json:"iterations"`
+	Timeout         string  `json:"timeout"`
+	Search          string  `json:"search"`
+	MaxNodes        int     `json:"max_nodes"`
+	RefineTime      string  `json:"refine_time"`
+	RefineSteps     int     `json:"refine_steps"`
+	RefineT0        float64 `json:"refine_t0"`
+	RefineT1        float64 `json:"refine_t1"`
+	Seed            int64   `json:"seed"`
+	Top             int     `json:"top"`
+	TopMaxShared    float64 `json:"top_max_shared"`
+	MinHits         int     `json:"min_hits"`
+	Panel           int     `json:"panel"`
+	GroupLengths    string  `json:"group_lengths"`
+	BiasHeader      string  `json:"bias_header"`
+	BiasLevel       int     `json:"bias_level"`
+	MaxHomopolymer  int     `json:"max_homopolymer"`
+	GCWindow        int     `json:"gc_window"`
+	GCMin           float64 `json:"gc_min"`
+	GCMax           float64 `json:"gc_max"`
+	ForbidMotifs    string  `json:"forbid_motifs"`
+}
+
+// jsonInput is an input file and its checksum
+type jsonInput struct {
+	Role   string `json:"role"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// jsonOffTargets counts the target kmers removed by off-target filtering
+type jsonOffTargets struct {
+	TargetKmers    int `json:"target_kmers"`
+	RemovedKmers   int `json:"removed_kmers"`
+	RemainingKmers int `json:"remaining_kmers"`
+}
+
+// jsonSearch is the outcome of an exhaustive construct search
+type jsonSearch struct {
+	GreedyScore   *float64 `json:"greedy_score,omitempty"` // omitted if the greedy search found no construct
+	BestScore     *float64 `json:"best_score,omitempty"`
+	UpperBound    float64  `json:"upper_bound"` // bounds constructs repeating a kmer too
+	OptimalityGap *float64 `json:"greedy_optimality_gap,omitempty"`
+	Nodes         int      `json:"nodes"`
+	Complete      bool     `json:"complete"` // best_score is optimal among constructs without a repeated kmer
+}
+
+// jsonRefinement is the outcome of a simulated annealing refinement
+type jsonRefinement struct {
+	InitialScore float64 `json:"initial_score"`
+	FinalScore   float64 `json:"final_score"`
+	Steps        int     `json:"steps"`
+	Accepted     int     `json:"accepted"`
+	Improved     int     `json:"improved"`
+}
+
+// jsonLength is the best construct found at one length of a construct length range
+type jsonLength struct {
+	Length         int      `json:"length"`
+	Score          *float64 `json:"objective_score,omitempty"` // omitted if no construct was found
+	SelectionScore *float64 `json:"selection_score,omitempty"` // score per nt, or penalized score, as set by -lengthSelect
+	Selected       bool     `json:"selected"`
+}
+
+// jsonCoverage is a target's coverage by a panel of constructs, as in the panel coverage table
+type jsonCoverage struct {
+	Header      string `json:"header"`
+	MinKmerHits int    `json:"min_kmer_hits"`
+	KmerHits    []int  `json:"kmer_hits"`  // hits of each panel construct
+	CoveredBy   []int  `json:"covered_by"` // indices of the constructs with at least min_kmer_hits
+}
+
+// jsonConstruct is a designed or evaluated construct
+type jsonConstruct struct {
+	Label          string          `json:"label"`
+	Sequence       string          `json:"sequence"`
+	Length         int             `json:"length"`
+	GC             float64         `json:"gc_pct"`
+	Objective      jsonObjective   `json:"objective"`
+	OffTargetKmers *int            `json:"off_target_kmers,omitempty"` // evaluated constructs with off-targets only
+	Targets        []jsonTargetHit `json:"targets"`
+	Kmers          []jsonKmer      `json:"kmers"`
+}
+
+// jsonObjective is a construct's objective score
+type jsonObjective struct {
+	Name          string  `json:"name"`     // -objective name, e.g. "geomean"
+	Weighted      bool    `json:"weighted"` // targets are weighted by a -weights file
+	Score         float64 `json:"score"`
+	SiRNAWeighted bool    `json:"sirna_weighted"`
+}
+
+// jsonTargetHit is a construct's statistics for one target, as in the results table
+type jsonTargetHit struct {
+	Header           string   `json:"header"`
+	KmerHits         int      `json:"kmer_hits"`
+	SWGSimilarity    float64  `json:"swg_similarity_pct"`
+	KmerMeanGC       float64  `json:"kmer_mean_gc_pct"`
+	Guide5U          float64  `json:"guide_5p_u_pct"`
+	Guide5A          float64  `json:"guide_5p_a_pct"`
+	Guide5C          float64  `json:"guide_5p_c_pct"`
+	AntisenseFavored float64  `json:"antisense_favored_pct"`
+	SiRNAEfficacy    *float64 `json:"sirna_efficacy_mean,omitempty"`
+}
+
+// jsonKmer is a kmer of a construct
+type jsonKmer struct {
+	Position         int      `json:"position"` // 1-based
+	Kmer             string   `json:"kmer"`
+	GC               float64  `json:"gc_pct"`
+	AntisenseFavored bool     `json:"antisense_favored"`
+	SiRNAEfficacy    *float64 `json:"sirna_efficacy,omitempty"`
+	Targets          []int    `json:"targets"` // indices of the targets matched
+}
+
+// newJSONReport returns an empty report for a run, or nil if -json wasn't given
+func newJSONReport(mode string, opts *options, ref []*HeaderRef) (*jsonReport, error) {
+	if opts.json == "" {
+		return nil, nil
+	}
+	r := &jsonReport{
+		SchemaVersion: jsonSchemaVersion,
+		Version:       Version,
+		Mode:          mode,
+		Parameters: jsonParameters{
+			KmerLength: opts.kmerLength, OTKmerLength: opts.otKmerLength, OTMismatches: opts.otMismatches,
+			OTPolicy: opts.otPolicy, OTSeedExtra: opts.otSeedExtra, OTWobble: opts.otWobble, Objective: opts.objective,
+			SiRNAScore: opts.siRNAScore, SiRNAWeight: opts.siRNAWeight, ConstructLength: opts.consLenSpec,
+			LengthStep: opts.lengthStep, LengthSelect: opts.lengthSelect, LengthPenalty: opts.lengthPenal, Iterations: opts.iterations, Timeout: opts.timeout.String(), Search: opts.search,
+			MaxNodes: opts.maxNodes, RefineTime: opts.refineTime.String(), RefineSteps: opts.refineSteps,
+			RefineT0: opts.refineT0, RefineT1: opts.refineT1, Seed: opts.seed,
+			Top: opts.top, TopMaxShared: opts.topMaxShared, MinHits: opts.minHits, Panel: opts.panel,
+			GroupLengths: opts.groupLens, BiasHeader: opts.biasHeader, BiasLevel: opts.biasLvl,
+			MaxHomopolymer: opts.maxHomopol, GCWindow: opts.gcWindow, GCMin: opts.gcMin, GCMax: opts.gcMax,
+			ForbidMotifs: opts.forbidMotifs,
+		},
+		Targets:    make([]string, len(ref)),
+		Constructs: []jsonConstruct{},
+	}
+	for i, hr := range ref {
+		r.Targets[i] = hr.Header
+	}
+	inputs := []struct{ role, paths string }{
+		{"targets", opts.refFile}, {"off_targets", opts.otRefFiles}, {"off_target_kmers", opts.otKmerFile},
+		{"weights", opts.weightsFile}, {"groups", opts.groupsFile}, {"candidates", opts.candidates},
+	}
+	for _, in := range inputs {
+		if in.paths == "" {
+			continue
+		}
+		for _, path := range strings.Split(in.paths, ",") {
+			sum, err := fileSHA256(path)
+			if err != nil {
+				return nil, err
+			}
+			r.Inputs = append(r.Inputs, jsonInput{Role: in.role, Path: path, SHA256: sum})
+		}
+	}
+	return r, nil
+}
+
+// fileSHA256 returns the hex SHA-256 checksum of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// setOffTargetCounts records the no. of target kmers before and after off-target filtering
+func (r *jsonReport) setOffTargetCounts(before int, after int) {
+	if r == nil {
+		return
+	}
+	r.OffTargets = &jsonOffTargets{TargetKmers: before, RemovedKmers: before - after, RemainingKmers: after}
+}
+
+// setSearch records the outcome of an exhaustive search from the greedy construct (nil for none)
+func (r *jsonReport) setSearch(greedy *construct, sb *searchBound) {
+	if r == nil {
+		return
+	}
+	r.Search = &jsonSearch{UpperBound: sb.upperBound, Nodes: sb.nodes, Complete: sb.complete}
+	if greedy != nil {
+		gap := sb.upperBound - greedy.score
+		r.Search.GreedyScore, r.Search.OptimalityGap = &greedy.score, &gap
+	}
+	if sb.best != nil {
+		r.Search.BestScore = &sb.best.score
+	}
+}
+
+// setStoppedEarly records why the construct search was stopped early
+func (r *jsonReport) setStoppedEarly(reason string) {
+	if r == nil {
+		return
+	}
+	r.StoppedEarly = reason
+}
+
+// setRefinement records the outcome of refining a construct to the final score
+func (r *jsonReport) setRefinement(stats refineStats, final float64) {
+	if r == nil {
+		return
+	}
+	r.Refinement = &jsonRefinement{InitialScore: stats.initial, FinalScore: final, Steps: stats.steps, Accepted: stats.accepted, Improved: stats.improved}
+}
+
+// setLengthCurve records the best construct found at each length of a construct length range, and the selected length
+func (r *jsonReport) setLengthCurve(curve []lengthPoint, selected int) {
+	if r == nil {
+		return
+	}
+	r.LengthCurve = make([]jsonLength, len(curve))
+	for i, pt := range curve {
+		r.LengthCurve[i] = jsonLength{Length: pt.length, Selected: i == selected}
+		if pt.construct != nil {
+			score, selScore := pt.construct.score, pt.selScore
+			r.LengthCurve[i].Score, r.LengthCurve[i].SelectionScore = &score, &selScore
+		}
+	}
+}
+
+// setPanelCoverage records the kmer hits of each panel construct to each target, and which constructs cover it
+func (r *jsonReport) setPanelCoverage(panel []*panelConstruct, ref []*HeaderRef, minHits []int) {
+	if r == nil {
+		return
+	}
+	r.PanelCoverage = make([]jsonCoverage, len(ref))
+	for i, hr := range ref {
+		cov := jsonCoverage{Header: hr.Header, MinKmerHits: minHits[i], KmerHits: make([]int, len(panel)), CoveredBy: []int{}}
+		for j, pc := range panel {
+			cov.KmerHits[j] = pc.kmerHits[i]
+			if pc.kmerHits[i] >= minHits[i] {
+				cov.CoveredBy = append(cov.CoveredBy, j)
+			}
+		}
+		r.PanelCoverage[i] = cov
+	}
+}
+
+// addConstruct adds a construct with its per-target statistics and kmers
+func (r *jsonReport) addConstruct(label string, goodKmers *kmerTable, kmerLen int, c *construct, ref []*HeaderRef, obj objective, eff *siRNAEfficacy) {
+	if r == nil {
+		return
+	}
+	jc := jsonConstruct{
+		Label:     label,
+		Sequence:  c.seq,
+		Length:    len(c.seq),
+		GC:        gcContent(c.seq),
+		Objective: jsonObjective{Name: obj.key(), Weighted: obj.weights != nil, Score: c.score, SiRNAWeighted: eff != nil && eff.weighted},
+		Targets:   make([]jsonTargetHit, len(ref)),
+		Kmers:     []jsonKmer{},
+	}
+
+	kmers := kmersPerInput(goodKmers, c.seq, kmerLen, len(ref))
+	meanGC := meanGCforKmers(kmers)
+	stats := kmerStats(kmers)
+	var effMeans []float64
+	if eff != nil {
+		effMeans, _ = efficacyStats(kmers, eff)
+	}
+	for i, hr := range ref {
+		jc.Targets[i] = jsonTargetHit{
+			Header: hr.Header, KmerHits: int(stats[i][3]), SWGSimilarity: swgSimilarity(c.seq, hr.Seq) * 100,
+			KmerMeanGC: zeroNaN(meanGC[i]), Guide5U: stats[i][0] * 100, Guide5A: stats[i][1] * 100, Guide5C: stats[i][2] * 100,
+			AntisenseFavored: stats[i][4] * 100,
+		}
+		if effMeans != nil {
+			jc.Targets[i].SiRNAEfficacy = &effMeans[i]
+		}
+	}
+
+	for i := 0; i <= len(c.seq)-kmerLen; i++ {
+		kmer := c.seq[i : i+kmerLen]
+		jk := jsonKmer{Position: i + 1, Kmer: kmer, GC: gcContent(kmer), AntisenseFavored: antisenseFavored(kmer), Targets: []int{}}
+		if eff != nil {
+			score := eff.kmerScore(kmer)
+			jk.SiRNAEfficacy = &score
+		}
+		jk.Targets = append(jk.Targets, goodKmers.targets(kmer)...)
+		jc.Kmers = append(jc.Kmers, jk)
+	}
+	r.Constructs = append(r.Constructs, jc)
+}
+
+// setOffTargetKmers records the no. of kmers of the last construct added that match an off-target
+func (r *jsonReport) setOffTargetKmers(n int) {
+	if r == nil {
+		return
+	}
+	r.Constructs[len(r.Constructs)-1].OffTargetKmers = &n
+}
+
+// zeroNaN returns 0 for NaN (e.g. the mean of no values), which JSON can't represent
+func zeroNaN(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+// write writes the report to a JSON file
+func (r *jsonReport) write(fileName string) error {
+	if r == nil {
+		return nil
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		file.Close()
+		return err
+	}
+	// A write may only fail on close (e.g. a full disk or network filesystem)
+	return file.Close()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_newJSONReport(t *testing.T) {
+	if r, err := newJSONReport("design", &options{}, nil); r != nil || err != nil {
+		t.Errorf("newJSONReport() = %v, %v, want nil without -json", r, err)
+	}
+	dir := t.TempDir()
+	refFile := filepath.Join(dir, "targets.fa")
+	if err := os.WriteFile(refFile, []byte(">t1\nACGT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &options{json: filepath.Join(dir, "out.json"), refFile: refFile, kmerLength: 21, seed: 7}
+	r, err := newJSONReport("design", opts, []*HeaderRef{{Header: "t1", Seq: "ACGT"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SHA-256 of ">t1\nACGT\n"
+	want := []jsonInput{{"targets", refFile, "df170398fed5bf49723efefd8b0d2dafd7d86410b4f2b64671899a2db4d64115"}}
+	if !reflect.DeepEqual(r.Inputs, want) || !reflect.DeepEqual(r.Targets, []string{"t1"}) || r.Parameters.Seed != 7 {
+		t.Errorf("newJSONReport() = %+v", r)
+	}
+	opts.otRefFiles = filepath.Join(dir, "missing.fa")
+	if _, err := newJSONReport("design", opts, nil); err == nil {
+		t.Error("newJSONReport() error = nil, want an error for a missing input")
+	}
+}
+
+func Test_jsonReport(t *testing.T) {
+	// A nil report discards everything
+	var nilReport *jsonReport
+	nilReport.setOffTargetCounts(2, 1)
+	nilReport.addConstruct("c", nil, 3, &construct{seq: "ACGT"}, nil, objective{}, nil)
+	nilReport.setOffTargetKmers(1)
+	nilReport.setLengthCurve([]lengthPoint{{length: 100}}, -1)
+	nilReport.setPanelCoverage(nil, nil, nil)
+	if err := nilReport.write(filepath.Join(t.TempDir(), "nil.json")); err != nil {
+		t.Error(err)
+	}
+
+	ref := []*HeaderRef{{Header: "t1", Seq: "ACGTTA"}, {Header: "t2", Seq: "GGGGGG"}}
+	goodKmers := testKmerTable(map[string][]int{"ACG": {1, 0}, "CGT": {1, 0}, "GTT": {1, 0}, "TTA": {1, 0}})
+	r := &jsonReport{SchemaVersion: jsonSchemaVersion, Mode: "evaluate", Targets: []string{"t1", "t2"}, Constructs: []jsonConstruct{}}
+	r.setOffTargetCounts(6, 4)
+	obj, _ := newObjective("geomean", []float64{1, 2})
+	r.addConstruct("cand", goodKmers, 3, &construct{seq: "ACGTTA", score: 2}, ref, obj, nil)
+	r.setOffTargetKmers(0)
+	r.setLengthCurve([]lengthPoint{{length: 100}, {length: 200, construct: &construct{score: 10}, selScore: 0.05}}, 1)
+	r.setPanelCoverage([]*panelConstruct{{construct: &construct{kmerHits: []int{4, 0}}}, {construct: &construct{kmerHits: []int{1, 2}}}}, ref, []int{1, 3})
+
+	file := filepath.Join(t.TempDir(), "out.json")
+	if err := r.write(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("/dev/full"); err == nil {
+		if err := r.write("/dev/full"); err == nil {
+			t.Error("write() = nil, want an error for a full device")
+		}
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got jsonReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SchemaVersion != jsonSchemaVersion || *got.OffTargets != (jsonOffTargets{6, 2, 4}) {
+		t.Errorf("write() = %+v", got)
+	}
+	if len(got.LengthCurve) != 2 || got.LengthCurve[0].Score != nil || got.LengthCurve[0].Selected ||
+		*got.LengthCurve[1].Score != 10 || *got.LengthCurve[1].SelectionScore != 0.05 || !got.LengthCurve[1].Selected {
+		t.Errorf("length curve = %+v", got.LengthCurve)
+	}
+	wantCoverage := []jsonCoverage{
+		{Header: "t1", MinKmerHits: 1, KmerHits: []int{4, 1}, CoveredBy: []int{0, 1}},
+		{Header: "t2", MinKmerHits: 3, KmerHits: []int{0, 2}, CoveredBy: []int{}},
+	}
+	if !reflect.DeepEqual(got.PanelCoverage, wantCoverage) {
+		t.Errorf("panel coverage = %+v, want %+v", got.PanelCoverage, wantCoverage)
+	}
+	c := got.Constructs[0]
+	if c.Label != "cand" || c.Length != 6 || c.Objective != (jsonObjective{Name: "geomean", Weighted: true, Score: 2}) || c.OffTargetKmers == nil || *c.OffTargetKmers != 0 {
+		t.Errorf("construct = %+v", c)
+	}
+	if c.Targets[0].KmerHits != 4 || c.Targets[1].KmerHits != 0 || c.Targets[1].KmerMeanGC != 0 || c.Targets[0].SiRNAEfficacy != nil {
+		t.Errorf("construct targets = %+v", c.Targets)
+	}
+	if len(c.Kmers) != 4 || c.Kmers[1].Position != 2 || c.Kmers[1].Kmer != "CGT" || !reflect.DeepEqual(c.Kmers[1].Targets, []int{0}) {
+		t.Errorf("construct kmers = %+v", c.Kmers)
+	}
+}
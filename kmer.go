@@ -31,9 +31,7 @@
 package main
 
 import (
-	"bufio"   // For reading files with a scanner
 	"fmt"     // For printing to the console
-	"os"      // For opening and closing files
 	"strings" // For string manipulation like HasPrefix
 	"sync"    // For using WaitGroup and Mutex
 )
@@ -43,57 +41,64 @@ import (
 // Args:
 //
 //	ref: A slice of HeaderRef structures containing reference sequences.
-//	kmerLen: The length of kmers to extract.
+//	kmerLen: The length of kmers to extract (1 to maxPackedKmerLen).
 //
 // Returns:
 //
-//	A map[string][]int where keys are kmers and values are slices indicating presence (1) or absence (0) of the kmer in each input sequence.
-func getKmers(ref []*HeaderRef, kmerLen int) map[string][]int {
-	refLen := len(ref)
-	kmers := make(map[string][]int)
+//	A kmerTable of the kmers, recording which input sequences each is present in, or an error if kmerLen is out of range.
+//	Kmers spanning a nucleotide other than A, C, G or T (e.g. N) are skipped.
+func getKmers(ref []*HeaderRef, kmerLen int) (*kmerTable, error) {
+	if kmerLen < 1 || kmerLen > maxPackedKmerLen {
+		return nil, fmt.Errorf("kmer length %d must be between 1 and %d", kmerLen, maxPackedKmerLen)
+	}
+	kmers := newKmerTable(kmerLen, len(ref))
 
 	for i, hr := range ref {
-		ref_seq_len := len(hr.Seq)
-		for pos := 0; pos <= ref_seq_len-kmerLen; pos++ {
-			fwd_seq := hr.Seq[pos : pos+kmerLen]
-			kmerIndices, ok := kmers[fwd_seq]
+		var pk packedKmer
+		packed := 0 // no. of A, C, G or T nucleotides in a row ending at pos
+		for pos := 0; pos < len(hr.Seq); pos++ {
+			code, ok := nucCode(hr.Seq[pos])
 			if !ok {
-				// Preallocate a slice with zeroes.
-				kmerIndices = make([]int, refLen)
-				kmers[fwd_seq] = kmerIndices
+				packed = 0
+				continue
+			}
+			pk = pk.push(code, kmerLen)
+			packed++
+			if packed >= kmerLen {
+				// Record the presence of the kmer ending here in the current sequence
+				kmers.add(pk, i)
 			}
-			// Update the presence of k-mer for the current sequence only.
-			kmerIndices[i] = 1
 		}
 	}
+	kmers.sortRows()
 
-	return kmers
+	return kmers, nil
 }
 
-// removeOTKmers removes off-target kmers from the 'goodKmers' map.
+// removeOTKmers removes off-target kmers from the 'goodKmers' table.
 //
 // Args:
 //
-//	goodKmers: A map where keys are target kmers and values are presence/absence slices.
+//	goodKmers: The table of target kmers.
 //	otKmers: A map where keys are identified off-target kmers.
-func removeOTKmers(goodKmers map[string][]int, otKmers map[string]struct{}) {
+func removeOTKmers(goodKmers *kmerTable, otKmers map[string]struct{}) {
 	for key := range otKmers {
-		delete(goodKmers, key)
+		goodKmers.remove(key)
 	}
 }
 
-// removeMappedLongOTKmers removes target kmers from the 'goodKmers' map if they contain any of the provided off-target kmers as substrings.
+// removeMappedLongOTKmers removes target kmers from the 'goodKmers' table if they contain any of the provided off-target kmers as substrings.
 // This helps filter out potential off-target effects even if there's not an exact match.
 //
 // Args:
 //
-//	goodKmers: A map where keys are target kmers and values are presence/absence slices.
+//	goodKmers: The table of target kmers.
 //	otKmers: A map where keys are identified off-target kmers.
-func removeMappedLongOTKmers(goodKmers map[string][]int, otKmers map[string]struct{}) {
+func removeMappedLongOTKmers(goodKmers *kmerTable, otKmers map[string]struct{}) {
 	for ok := range otKmers {
-		for gk := range goodKmers {
+		for _, gk := range goodKmers.kmers() {
 			if strings.Contains(gk, ok) {
-				delete(goodKmers, gk)
+				goodKmers.remove(gk)
 			}
 		}
 	}
@@ -103,14 +108,14 @@ func removeMappedLongOTKmers(goodKmers map[string][]int, otKmers map[string]stru
 //
 // Args:
 //
-//	kmers: A map where keys are target kmers and values are presence/absence slices.
+//	kmers: The table of target kmers.
 //	otRef: A slice of HeaderRef structures containing off-target sequences.
 //	kmerLen: The length of kmers to search for.
 //
 // Returns:
 //
 //	A map[string]struct{} where keys represent off-target kmers found within the provided off-target sequences.
-func conGetOTKmers(kmers map[string][]int, otRef []*HeaderRef, kmerLen int) map[string]struct{} {
+func conGetOTKmers(kmers *kmerTable, otRef []*HeaderRef, kmerLen int) map[string]struct{} {
 	wg := &sync.WaitGroup{}
 	wg.Add(len(otRef))
 	otRefChan := make(chan *HeaderRef, len(otRef))
@@ -135,23 +140,23 @@ func conGetOTKmers(kmers map[string][]int, otRef []*HeaderRef, kmerLen int) map[
 //
 // Args:
 //
-//	kmers: A map where keys are target kmers and values are presence/absence slices.
+//	kmers: The table of target kmers.
 //	otRefChan: A channel receiving HeaderRef structures (off-target sequences).
 //	kmerLen: The length of kmers to search for.
 //	headerKmerChan: A channel for sending maps of identified off-target kmers.
 //	wg: A WaitGroup for synchronization with the main process.
-func workerGo(kmers map[string][]int, otRefChan chan *HeaderRef, kmerLen int, headerKmerChan chan map[string]struct{}, wg *sync.WaitGroup) {
+func workerGo(kmers *kmerTable, otRefChan chan *HeaderRef, kmerLen int, headerKmerChan chan map[string]struct{}, wg *sync.WaitGroup) {
 	otRef := <-otRefChan
 	otKmers := make(map[string]struct{})
 
 	pos := 0
 	for pos <= len(otRef.Seq)-kmerLen {
 		fseq := otRef.Seq[pos : pos+kmerLen]
-		if _, ok := kmers[fseq]; ok {
+		if kmers.has(fseq) {
 			otKmers[fseq] = struct{}{}
 		}
 		rseq := otRef.ReverseSeq[pos : pos+kmerLen]
-		if _, ok := kmers[rseq]; ok {
+		if kmers.has(rseq) {
 			otKmers[rseq] = struct{}{}
 		}
 		pos++
@@ -173,73 +178,79 @@ func compileOTKmers(headerKmerChan chan map[string]struct{}) map[string]struct{}
 	return allOTKmers
 }
 
-// Kmer abundance (max = no. of input_target_sequences) calculated for each target kmer
-func kmerAbun(kmers map[string][]int) map[string]int {
-	kmerCts := make(map[string]int)
-	for k, v := range kmers {
-		tot := 0
-		for _, val := range v {
-			tot += val
+// Kmer abundance (max = total weight of input target sequences) calculated for each target kmer, indexed by row.
+// Each target a kmer is present in adds its weight (nil weights for a weight of 1 each).  A removed kmer's abundance is
+// -1; a negative abundance means the kmer can't start or extend a construct.
+func kmerAbun(kmers *kmerTable, weights []float64) []float64 {
+	kmerCts := make([]float64, len(kmers.keys))
+	for row := range kmerCts {
+		if kmers.removed[row] {
+			kmerCts[row] = -1
+			continue
 		}
-		kmerCts[k] = tot
+		tot := 0.0
+		kmers.forTargets(int32(row), func(i int) {
+			if weights == nil {
+				tot++
+			} else {
+				tot += weights[i]
+			}
+		})
+		kmerCts[row] = tot
 	}
 	return kmerCts
 }
 
-func LoadAndSendSeqs(refFile string, seqChan chan<- string, wg *sync.WaitGroup) {
+// LoadAndSendSeqs sends each record of a sequence file to seqChan, adding the bytes read to prog (nil if not reporting)
+func LoadAndSendSeqs(refFile string, seqChan chan<- seqRecord, wg *sync.WaitGroup, prog *progress) {
 	defer wg.Done()
 
-	f, err := os.Open(refFile)
+	f, err := openSeqFileProgress(refFile, prog)
 	if err != nil {
 		fmt.Println("Problem opening FASTA reference file", refFile)
 		return // or handle error as needed
 	}
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	var refSeq strings.Builder
-
-	for scanner.Scan() {
-		fastaLine := scanner.Text()
-		if strings.HasPrefix(fastaLine, ">") {
-			if refSeq.Len() > 0 {
-				seqChan <- refSeq.String()
-				refSeq.Reset()
-			}
-		} else if len(fastaLine) > 0 {
-			refSeq.WriteString(strings.ToUpper(fastaLine))
+	// FASTA and FASTQ records are both accepted; empty sequences are not sent
+	err = readSeqRecords(f, func(header string, seq string) {
+		if len(seq) > 0 {
+			seqChan <- seqRecord{file: refFile, header: header, seq: seq}
 		}
-	}
-
-	// Send the last sequence if there is one
-	if refSeq.Len() > 0 {
-		seqChan <- refSeq.String()
+	})
+	if err != nil {
+		fmt.Println("Problem reading reference file", refFile+":", err)
 	}
 }
 
 // TODO: setup for smaller OT kmers
-func KmerCheckSeqs(seqChan <-chan string, goodKmers map[string][]int, kmerLen int, wg *sync.WaitGroup, toDeleteChan chan<- map[string]struct{}) {
+func KmerCheckSeqs(seqChan <-chan seqRecord, goodKmers *kmerTable, kmerLen int, wg *sync.WaitGroup, toDeleteChan chan<- map[string]struct{}, rec *otRecorder) {
 	defer wg.Done()
 
 	toDelete := make(map[string]struct{}) // Temporary set to store k-mers to delete
+	var hits []otHit
 
-	for seq := range seqChan {
+	for record := range seqChan {
 		// Compute the reverse complement of the entire sequence once
-		rcSeq := reverseComplement(seq)
+		rcSeq := reverseComplement(record.seq)
 
 		// Iterate over the original sequence and the reverse complement
-		for _, s := range []string{seq, rcSeq} {
-			for pos := 0; pos <= len(s)-kmerLen; pos++ {
-				kmer := s[pos : pos+kmerLen]
+		for strand, s := range []string{record.seq, rcSeq} {
+			for pos, row := range goodKmers.rows(s) {
 				// Check if the k-mer is in goodKmers
-				if _, exists := goodKmers[kmer]; exists {
+				if row >= 0 {
+					kmer := s[pos : pos+kmerLen]
 					toDelete[kmer] = struct{}{}
+					if rec != nil {
+						hits = append(hits, newOTHit(kmer, kmer, record, strand, pos))
+					}
 				}
 			}
 		}
 	}
 
 	// Send the toDelete map to the channel
+	rec.add(hits)
 	toDeleteChan <- toDelete
 }
 
@@ -247,33 +258,41 @@ func KmerCheckSeqs(seqChan <-chan string, goodKmers map[string][]int, kmerLen in
 //
 // Args:
 //
-//	seqChan: A channel receiving DNA sequences.
+//	seqChan: A channel receiving off-target sequence records.
 //	subKmers: A map where keys are sub-kmers and values are lists of their corresponding longer kmers.
 //	subKmerLen: The length of the sub-kmers.
 //	wg: A WaitGroup for synchronization with the main process.
 //	toDeleteChan: A channel for sending maps of sub-kmers (and their associated longer kmers) to be deleted.
-func smallKmerCheckSeqs(seqChan <-chan string, subKmers map[string][]string, subKmerLen int, wg *sync.WaitGroup, toDeleteChan chan map[string][]string) {
+//	rec: Collects each match for the off-target report (nil if not reporting).
+func smallKmerCheckSeqs(seqChan <-chan seqRecord, subKmers map[string][]string, subKmerLen int, wg *sync.WaitGroup, toDeleteChan chan map[string][]string, rec *otRecorder) {
 	defer wg.Done()
 
 	toDelete := make(map[string][]string) // Temporary set to store k-mers to delete
+	var hits []otHit
 
-	for seq := range seqChan {
+	for record := range seqChan {
 		// Compute the reverse complement of the entire sequence once
-		rcSeq := reverseComplement(seq)
+		rcSeq := reverseComplement(record.seq)
 
 		// Iterate over the original sequence and the reverse complement
-		for _, s := range []string{seq, rcSeq} {
+		for strand, s := range []string{record.seq, rcSeq} {
 			for pos := 0; pos <= len(s)-subKmerLen; pos++ {
 				kmer := s[pos : pos+subKmerLen]
 				// Check if the k-mer is in goodKmers
 				if _, exists := subKmers[kmer]; exists {
 					toDelete[kmer] = subKmers[kmer]
+					if rec != nil {
+						for _, longKmer := range subKmers[kmer] {
+							hits = append(hits, newOTHit(longKmer, kmer, record, strand, pos))
+						}
+					}
 				}
 			}
 		}
 	}
 
 	// Send the toDelete map to the channel
+	rec.add(hits)
 	toDeleteChan <- toDelete
 }
 
@@ -282,17 +301,17 @@ func smallKmerCheckSeqs(seqChan <-chan string, subKmers map[string][]string, sub
 //
 // Args:
 //
-//	goodKmers: A map where keys are target kmers and values are presence/absence slices.
+//	goodKmers: The target kmers.
 //	subKmerLen: The desired length of the sub-kmers to be generated.
 //
 // Returns:
 //
 //	A map[string][]string where keys are sub-kmers and values are lists of the original kmers containing them.
-func GenerateSubKmersMap(goodKmers map[string][]int, subKmerLen int) map[string][]string {
+func GenerateSubKmersMap(goodKmers []string, subKmerLen int) map[string][]string {
 	subKmers := make(map[string][]string)
 
-	// Iterate through all k-mers in the input map
-	for kmer := range goodKmers {
+	// Iterate through all k-mers in the input
+	for _, kmer := range goodKmers {
 		if len(kmer) < subKmerLen || subKmerLen == 0 { //TODO: prob should throw an error
 			return subKmers
 		}
@@ -308,19 +327,26 @@ func GenerateSubKmersMap(goodKmers map[string][]int, subKmerLen int) map[string]
 	return subKmers
 }
 
-func ConcurrentlyProcessSequences(refFiles []string, goodKmers map[string][]int, kmerLen int, subKmerLen int) {
-	ori_len := len(goodKmers)
-	seqChan := make(chan string, 100)                         // Buffered channel for better performance
+// ConcurrentlyProcessSequences removes target kmers matching any off-target sequence in the provided FASTA/FASTQ files.
+// The off-target policy sets what is matched (whole kmers, sub-kmers or seed regions) and how many mismatches are tolerated;
+// matches are checked in either orientation.  Each match is added to rec for the off-target report (nil if not reporting).
+func ConcurrentlyProcessSequences(refFiles []string, goodKmers *kmerTable, kmerLen int, policy otPolicy, rec *otRecorder) {
+	ori_len := goodKmers.len()
+	seqChan := make(chan seqRecord, 100)                      // Buffered channel for better performance
 	toDeleteChan := make(chan map[string]struct{}, 20)        // Channel to collect toDelete maps from workers
 	toDeleteSubKmerChan := make(chan map[string][]string, 20) // Channel to collect toDelete maps from workers
-	var subKmers map[string][]string
+	toDeleteMismatchChan := make(chan map[int]struct{}, 20)   // Channel to collect matched seed index ids from workers
+	toDeleteWobbleChan := make(chan wobbleHits, 20)           // Channel to collect exact and wobble matched ids from workers
+	var idx *seedIndex
+	var wobbleIdx *wobbleIndex
 	var producerWG sync.WaitGroup // WaitGroup for producers
 	var consumerWG sync.WaitGroup // WaitGroup for consumers
 
 	// Set up sequence producers
+	prog := newProgress("Off-target screen", fileSizes(refFiles), "bytes")
 	for _, refFile := range refFiles {
 		producerWG.Add(1)
-		go LoadAndSendSeqs(refFile, seqChan, &producerWG)
+		go LoadAndSendSeqs(refFile, seqChan, &producerWG, prog)
 	}
 
 	// Close the sequence channel once all producers are done
@@ -328,51 +354,91 @@ func ConcurrentlyProcessSequences(refFiles []string, goodKmers map[string][]int,
 		producerWG.Wait()
 		close(seqChan)
 	}()
-	if subKmerLen < kmerLen {
-
-		subKmers = GenerateSubKmersMap(goodKmers, subKmerLen)
+	subKmers, subKmerLen := policy.matchKmers(goodKmers, kmerLen)
+	maxMismatches := policy.maxMismatches
+	if maxMismatches > 0 {
+		idx = newSeedIndex(subKmers, subKmerLen, maxMismatches)
+	}
+	if policy.wobble {
+		wobbleIdx = newWobbleIndex(subKmers, subKmerLen)
 	}
 	// Set up sequence consumers
 	numConsumers := 20 // Set the number of workers as needed.
 	for i := 0; i < numConsumers; i++ {
 		consumerWG.Add(1)
-		if subKmerLen == kmerLen {
-			go KmerCheckSeqs(seqChan, goodKmers, kmerLen, &consumerWG, toDeleteChan)
-		} else {
-			go smallKmerCheckSeqs(seqChan, subKmers, subKmerLen, &consumerWG, toDeleteSubKmerChan)
+		switch {
+		case policy.wobble:
+			go wobbleKmerCheckSeqs(seqChan, wobbleIdx, &consumerWG, toDeleteWobbleChan, rec)
+		case maxMismatches > 0:
+			go mismatchKmerCheckSeqs(seqChan, idx, &consumerWG, toDeleteMismatchChan, rec)
+		case subKmers == nil:
+			go KmerCheckSeqs(seqChan, goodKmers, kmerLen, &consumerWG, toDeleteChan, rec)
+		default:
+			go smallKmerCheckSeqs(seqChan, subKmers, subKmerLen, &consumerWG, toDeleteSubKmerChan, rec)
 		}
 	}
 
 	// Wait for all consumers to finish processing
 	consumerWG.Wait()
+	prog.finish()
 
 	// Collect toDelete maps, count and delete the kmers from goodKmers after ensuring all consumers are done
-	if subKmerLen == kmerLen {
+	switch {
+	case policy.wobble:
+		close(toDeleteWobbleChan) // Close the toDelete channel once all consumers are done
+		var wobbleOnly []int
+		for hits := range toDeleteWobbleChan {
+			for id := range hits.exact {
+				for _, longKmer := range wobbleIdx.longKmers[id] {
+					goodKmers.remove(longKmer)
+				}
+			}
+			for id := range hits.wobble {
+				wobbleOnly = append(wobbleOnly, id)
+			}
+		}
+		exactRemoved := ori_len - goodKmers.len()
+		// Kmers with both exact and wobble matches have already been counted as exact
+		for _, id := range wobbleOnly {
+			for _, longKmer := range wobbleIdx.longKmers[id] {
+				goodKmers.remove(longKmer)
+			}
+		}
+		fmt.Printf("Total off-target-matching kmers removed: %d (exact: %d, G:U wobble: %d)\n\n", ori_len-goodKmers.len(), exactRemoved, ori_len-goodKmers.len()-exactRemoved)
+	case maxMismatches > 0:
+		close(toDeleteMismatchChan) // Close the toDelete channel once all consumers are done
+		for toDelete := range toDeleteMismatchChan {
+			for id := range toDelete {
+				for _, longKmer := range idx.longKmers[id] {
+					goodKmers.remove(longKmer)
+				}
+			}
+		}
+		fmt.Printf("Total off-target-matching kmers removed (<= %d mismatches): %d\n\n", maxMismatches, ori_len-goodKmers.len())
+	case subKmers == nil:
 		close(toDeleteChan) // Close the toDelete channel once all consumers are done
 		deletedKmerCount := 0
 		for toDelete := range toDeleteChan {
 			for kmer := range toDelete {
-				if _, exists := goodKmers[kmer]; exists {
-					deletedKmerCount++      // Increment the counter if the kmer is found in goodKmers
-					delete(goodKmers, kmer) // Delete the kmer from goodKmers
+				if goodKmers.remove(kmer) { // Delete the kmer from goodKmers
+					deletedKmerCount++ // Increment the counter if the kmer was found in goodKmers
 				}
 			}
 		}
-		fmt.Printf("Total off-target-matching kmers removed: %d\n\n", ori_len-len(goodKmers))
-	} else {
+		fmt.Printf("Total off-target-matching kmers removed: %d\n\n", ori_len-goodKmers.len())
+	default:
 		close(toDeleteSubKmerChan) // Close the toDelete channel once all consumers are done
 		deletedKmerCount := 0
 		for toDelete := range toDeleteSubKmerChan {
 			for _, longKmers := range toDelete {
 				for _, longKmer := range longKmers {
-					if _, exists := goodKmers[longKmer]; exists {
-						deletedKmerCount++          // Increment the counter if the kmer is found in goodKmers
-						delete(goodKmers, longKmer) // Delete the kmer from goodKmers
+					if goodKmers.remove(longKmer) { // Delete the kmer from goodKmers
+						deletedKmerCount++ // Increment the counter if the kmer was found in goodKmers
 					}
 				}
 			}
 		}
-		fmt.Printf("Total off-target-matching kmers removed: %d\n\n", ori_len-len(goodKmers))
+		fmt.Printf("Total off-target-matching kmers removed: %d\n\n", ori_len-goodKmers.len())
 
 	}
 
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// packedKmer is a kmer of up to maxPackedKmerLen nt packed 2 bits per nucleotide (A=0, C=1, G=2, T=3, as in
+// convertGoodKmersToUint64Set), first nucleotide most significant.  Kmers of up to 32 nt are held in the low word [1];
+// longer kmers continue into the high word [0].
+type packedKmer [2]uint64
+
+// maxPackedKmerLen is the longest kmer that can be packed
+const maxPackedKmerLen = 64
+
+// nucCode returns the 2-bit code of a nucleotide, or false if it isn't A, C, G or T
+func nucCode(b byte) (uint64, bool) {
+	switch b {
+	case 'A':
+		return 0, true
+	case 'C':
+		return 1, true
+	case 'G':
+		return 2, true
+	case 'T':
+		return 3, true
+	}
+	return 0, false
+}
+
+// packKmer packs a kmer, or returns false if it's longer than maxPackedKmerLen or has a nucleotide other than A, C, G
+// or T
+func packKmer(kmer string) (packedKmer, bool) {
+	var pk packedKmer
+	if len(kmer) > maxPackedKmerLen {
+		return pk, false
+	}
+	for i := 0; i < len(kmer); i++ {
+		code, ok := nucCode(kmer[i])
+		if !ok {
+			return pk, false
+		}
+		pk = packedKmer{pk[0]<<2 | pk[1]>>62, pk[1]<<2 | code}
+	}
+	return pk, true
+}
+
+// unpack returns the sequence of a packed kmer of kmerLen nt
+func (pk packedKmer) unpack(kmerLen int) string {
+	seq := make([]byte, kmerLen)
+	for i := kmerLen - 1; i >= 0; i-- {
+		seq[i] = "ACGT"[pk[1]&3]
+		pk = packedKmer{pk[0] >> 2, pk[1]>>2 | pk[0]<<62}
+	}
+	return string(seq)
+}
+
+// push returns the kmer following pk in a sequence, with the nucleotide code appended and pk's first nucleotide
+// dropped
+func (pk packedKmer) push(code uint64, kmerLen int) packedKmer {
+	hi, lo := pk[0]<<2|pk[1]>>62, pk[1]<<2|code
+	if kmerLen <= 32 {
+		return packedKmer{0, lo & lowMask(kmerLen)}
+	}
+	return packedKmer{hi & lowMask(kmerLen-32), lo}
+}
+
+// pushFront returns the kmer preceding pk in a sequence, with the nucleotide code prepended and pk's last nucleotide
+// dropped
+func (pk packedKmer) pushFront(code uint64, kmerLen int) packedKmer {
+	hi, lo := pk[0]>>2, pk[1]>>2|pk[0]<<62
+	if kmerLen <= 32 {
+		return packedKmer{0, lo | code<<(2*uint(kmerLen-1))}
+	}
+	return packedKmer{hi | code<<(2*uint(kmerLen-33)), lo}
+}
+
+// less reports whether pk sorts before other, which for kmers of the same length is sequence order
+func (pk packedKmer) less(other packedKmer) bool {
+	if pk[0] != other[0] {
+		return pk[0] < other[0]
+	}
+	return pk[1] < other[1]
+}
+
+// lowMask returns a mask of the low 2n bits, for n <= 32 nucleotides
+func lowMask(n int) uint64 {
+	if n >= 32 {
+		return ^uint64(0)
+	}
+	return 1<<(2*uint(n)) - 1
+}
+
+// kmerTable is the packed table of target kmers.  Each kmer has a row, in kmer order, holding a bitset of the targets
+// it's present in.  Kmers are keyed by a uint64 when they're up to 32 nt, and by both words of the packed kmer when
+// longer.  A kmer removed from the table (e.g. as an off-target match) keeps its row, so rows stay valid; values kept
+// per row, such as kmer abundances, are indexed by row.
+type kmerTable struct {
+	kmerLen int
+	seqLen  int                  // no. of targets
+	words   int                  // bitset words per row
+	small   map[uint64]int32     // kmer -> row, for kmers of up to 32 nt
+	large   map[packedKmer]int32 // kmer -> row, for longer kmers
+	keys    []packedKmer         // kmer of each row
+	members []uint64             // row r's targets are the bits of members[r*words : (r+1)*words]
+	removed []bool               // whether each row's kmer has been removed
+	live    int                  // no. of kmers not removed
+}
+
+// newKmerTable returns an empty table of kmerLen nt kmers present in seqLen targets
+func newKmerTable(kmerLen int, seqLen int) *kmerTable {
+	t := &kmerTable{kmerLen: kmerLen, seqLen: seqLen, words: (seqLen + 63) / 64}
+	if kmerLen <= 32 {
+		t.small = make(map[uint64]int32)
+	} else {
+		t.large = make(map[packedKmer]int32)
+	}
+	return t
+}
+
+// kmerTableOf returns a table of kmers of kmerLen nt, each present in a single target, or an error if a kmer isn't
+// kmerLen nt.  It's used to screen kmers that aren't target kmers, such as a construct's, against off-targets.  As in
+// getKmers, kmers spanning a nucleotide other than A, C, G or T are left out, so they aren't screened.
+func kmerTableOf(kmers []string, kmerLen int) (*kmerTable, error) {
+	t := newKmerTable(kmerLen, 1)
+	for _, kmer := range kmers {
+		if len(kmer) != kmerLen {
+			return nil, fmt.Errorf("kmer '%s' must be %d nt", kmer, kmerLen)
+		}
+		if pk, ok := packKmer(kmer); ok {
+			t.add(pk, 0)
+		}
+	}
+	t.sortRows()
+	return t, nil
+}
+
+// screenedOut reports whether a kmer of a table built by kmerTableOf was removed by screening, rather than left out
+// of the table
+func (t *kmerTable) screenedOut(kmer string) bool {
+	_, packed := packKmer(kmer)
+	return packed && !t.has(kmer)
+}
+
+// add records a kmer as present in a target, adding a row for it if it's new
+func (t *kmerTable) add(pk packedKmer, target int) {
+	row, ok := t.row(pk)
+	if !ok {
+		row = int32(len(t.keys))
+		t.setRow(pk, row)
+		t.keys = append(t.keys, pk)
+		for w := 0; w < t.words; w++ {
+			t.members = append(t.members, 0)
+		}
+		t.removed = append(t.removed, false)
+		t.live++
+	}
+	t.members[int(row)*t.words+target/64] |= 1 << uint(target%64)
+}
+
+// sortRows puts the rows in kmer order, once every kmer has been added and before any is removed, so rows don't
+// depend on the order the kmers were added in
+func (t *kmerTable) sortRows() {
+	order := make([]int32, len(t.keys))
+	for i := range order {
+		order[i] = int32(i)
+	}
+	sort.Slice(order, func(i, j int) bool { return t.keys[order[i]].less(t.keys[order[j]]) })
+	keys := make([]packedKmer, len(order))
+	members := make([]uint64, len(t.members))
+	for row, old := range order {
+		keys[row] = t.keys[old]
+		copy(members[row*t.words:(row+1)*t.words], t.members[int(old)*t.words:(int(old)+1)*t.words])
+		t.setRow(keys[row], int32(row))
+	}
+	t.keys, t.members = keys, members
+}
+
+// setRow sets the row of a kmer
+func (t *kmerTable) setRow(pk packedKmer, row int32) {
+	if t.small != nil {
+		t.small[pk[1]] = row
+	} else {
+		t.large[pk] = row
+	}
+}
+
+// row returns the row of a kmer, or false if it isn't in the table
+func (t *kmerTable) row(pk packedKmer) (int32, bool) {
+	if t.small != nil {
+		row, ok := t.small[pk[1]]
+		return row, ok
+	}
+	row, ok := t.large[pk]
+	return row, ok
+}
+
+// lookup returns the row of a kmer, or false if it isn't in the table
+func (t *kmerTable) lookup(kmer string) (int32, bool) {
+	if len(kmer) != t.kmerLen {
+		return 0, false
+	}
+	pk, ok := packKmer(kmer)
+	if !ok {
+		return 0, false
+	}
+	return t.row(pk)
+}
+
+// has reports whether a kmer is in the table
+func (t *kmerTable) has(kmer string) bool {
+	_, ok := t.lookup(kmer)
+	return ok
+}
+
+// remove removes a kmer from the table, reporting whether it was there
+func (t *kmerTable) remove(kmer string) bool {
+	row, ok := t.lookup(kmer)
+	if !ok {
+		return false
+	}
+	if t.small != nil {
+		delete(t.small, t.keys[row][1])
+	} else {
+		delete(t.large, t.keys[row])
+	}
+	t.removed[row] = true
+	t.live--
+	return true
+}
+
+// len returns the no. of kmers in the table
+func (t *kmerTable) len() int {
+	return t.live
+}
+
+// kmer returns the sequence of a row's kmer
+func (t *kmerTable) kmer(row int32) string {
+	return t.keys[row].unpack(t.kmerLen)
+}
+
+// kmers returns the kmers in the table, in kmer order (none for a nil table)
+func (t *kmerTable) kmers() []string {
+	if t == nil {
+		return nil
+	}
+	kmers := make([]string, 0, t.live)
+	for row := range t.keys {
+		if !t.removed[row] {
+			kmers = append(kmers, t.kmer(int32(row)))
+		}
+	}
+	return kmers
+}
+
+// rows returns the row of each kmer of seq (-1 for a kmer not in the table)
+func (t *kmerTable) rows(seq string) []int32 {
+	if len(seq) < t.kmerLen {
+		return nil
+	}
+	rows := make([]int32, len(seq)-t.kmerLen+1)
+	var pk packedKmer
+	packed := 0 // no. of A, C, G or T nucleotides in a row ending at i
+	for i := 0; i < len(seq); i++ {
+		code, ok := nucCode(seq[i])
+		if ok {
+			pk = pk.push(code, t.kmerLen)
+			packed++
+		} else {
+			packed = 0
+		}
+		start := i - t.kmerLen + 1
+		if start < 0 {
+			continue
+		}
+		rows[start] = -1
+		if packed >= t.kmerLen {
+			if row, ok := t.row(pk); ok {
+				rows[start] = row
+			}
+		}
+	}
+	return rows
+}
+
+// forTargets calls fn with each target row's kmer is present in, in target order
+func (t *kmerTable) forTargets(row int32, fn func(target int)) {
+	for w, word := range t.members[int(row)*t.words : (int(row)+1)*t.words] {
+		for ; word != 0; word &= word - 1 {
+			fn(w*64 + bits.TrailingZeros64(word))
+		}
+	}
+}
+
+// targets returns the targets a kmer is present in, in target order (none if it isn't in the table)
+func (t *kmerTable) targets(kmer string) []int {
+	var targets []int
+	if row, ok := t.lookup(kmer); ok {
+		t.forTargets(row, func(target int) { targets = append(targets, target) })
+	}
+	return targets
+}
+
+// addHits adds delta to the hits of each target row's kmer is present in
+func (t *kmerTable) addHits(row int32, hits []int, delta int) {
+	for w, word := range t.members[int(row)*t.words : (int(row)+1)*t.words] {
+		for ; word != 0; word &= word - 1 {
+			hits[w*64+bits.TrailingZeros64(word)] += delta
+		}
+	}
+}
+
+// addWeightedHits adds weight to the weighted hits of each target row's kmer is present in
+func (t *kmerTable) addWeightedHits(row int32, weighted []float64, weight float64) {
+	for w, word := range t.members[int(row)*t.words : (int(row)+1)*t.words] {
+		for ; word != 0; word &= word - 1 {
+			weighted[w*64+bits.TrailingZeros64(word)] += weight
+		}
+	}
+}
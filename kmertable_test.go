@@ -0,0 +1,251 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_packKmer(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, kmerLen := range []int{1, 5, 21, 31, 32, 33, 50, 64} {
+		var sb strings.Builder
+		for i := 0; i < kmerLen+20; i++ {
+			sb.WriteByte("ACGT"[r.Intn(4)])
+		}
+		seq := sb.String()
+		first, ok := packKmer(seq[:kmerLen])
+		if !ok {
+			t.Fatalf("packKmer(%s) failed", seq[:kmerLen])
+		}
+		if got := first.unpack(kmerLen); got != seq[:kmerLen] {
+			t.Errorf("unpack() = %s, want %s", got, seq[:kmerLen])
+		}
+		if kmerLen <= 32 && first[0] != 0 {
+			t.Errorf("packKmer(%s) uses the high word, want a %d nt kmer in the low word", seq[:kmerLen], kmerLen)
+		}
+		// Rolling along the sequence either way gives each kmer's packed form
+		pk := first
+		for i := 1; i+kmerLen <= len(seq); i++ {
+			code, _ := nucCode(seq[i+kmerLen-1])
+			pk = pk.push(code, kmerLen)
+			if want, _ := packKmer(seq[i : i+kmerLen]); pk != want {
+				t.Fatalf("push() at %d = %v, want %v (k = %d)", i, pk, want, kmerLen)
+			}
+		}
+		for i := len(seq) - kmerLen - 1; i >= 0; i-- {
+			code, _ := nucCode(seq[i])
+			pk = pk.pushFront(code, kmerLen)
+			if want, _ := packKmer(seq[i : i+kmerLen]); pk != want {
+				t.Fatalf("pushFront() at %d = %v, want %v (k = %d)", i, pk, want, kmerLen)
+			}
+		}
+	}
+
+	for _, kmer := range []string{"ACGNT", strings.Repeat("A", maxPackedKmerLen+1)} {
+		if _, ok := packKmer(kmer); ok {
+			t.Errorf("packKmer(%s) = ok, want false", kmer)
+		}
+	}
+	a, _ := packKmer("ACGT")
+	b, _ := packKmer("AGAA")
+	if !a.less(b) || b.less(a) {
+		t.Error("less() doesn't follow sequence order")
+	}
+}
+
+func Test_kmerTable(t *testing.T) {
+	// More targets than fit in one bitset word; target i has kmer ACGA only if i is a multiple of 7
+	ref := make([]*HeaderRef, 70)
+	for i := range ref {
+		ref[i] = &HeaderRef{Header: "t", Seq: "TTTT"}
+		if i%7 == 0 {
+			ref[i].Seq = "ACGAC"
+		}
+	}
+	table, err := getKmers(ref, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows are in kmer order
+	if want := []string{"ACGA", "CGAC", "TTTT"}; !reflect.DeepEqual(table.kmers(), want) {
+		t.Fatalf("getKmers() kmers = %v, want %v", table.kmers(), want)
+	}
+	if got, want := table.targets("ACGA"), []int{0, 7, 14, 21, 28, 35, 42, 49, 56, 63}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets() = %v, want %v", got, want)
+	}
+	hits := make([]int, len(ref))
+	table.addHits(0, hits, 1)
+	for i, h := range hits {
+		if want := boolToInt(i%7 == 0); h != want {
+			t.Errorf("addHits() target %d = %d, want %d", i, h, want)
+		}
+	}
+	weighted := make([]float64, len(ref))
+	table.addWeightedHits(2, weighted, 0.5)
+	if weighted[1] != 0.5 || weighted[0] != 0 {
+		t.Errorf("addWeightedHits() = %v, want 0.5 for targets with TTTT", weighted)
+	}
+
+	// A removed kmer keeps its row, but is no longer found
+	if !table.remove("CGAC") || table.remove("CGAC") || table.remove("GGGG") {
+		t.Error("remove() should only remove a kmer in the table")
+	}
+	if table.len() != 2 || table.has("CGAC") || !reflect.DeepEqual(table.kmers(), []string{"ACGA", "TTTT"}) {
+		t.Errorf("remove() left %v", table.kmers())
+	}
+	if got, want := kmerAbun(table, nil), []float64{10, -1, 60}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kmerAbun() = %v, want %v", got, want)
+	}
+	if got, want := table.rows("ACGACTTTTNTTTT"), []int32{0, -1, -1, -1, -1, 2, -1, -1, -1, -1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows() = %v, want %v", got, want)
+	}
+	if table.has("ACG") || table.has("ACGAC") || table.has("ACNA") {
+		t.Error("has() = true for a kmer of the wrong length or with a nucleotide other than A, C, G or T")
+	}
+
+	if _, err := kmerTableOf([]string{"ACGT", "ACG"}, 4); err == nil {
+		t.Error("kmerTableOf() = nil, want an error for a kmer of the wrong length")
+	}
+	if kmers, err := kmerTableOf([]string{"ACGT", "ACNT"}, 4); err != nil || !reflect.DeepEqual(kmers.kmers(), []string{"ACGT"}) {
+		t.Errorf("kmerTableOf() = %v, %v, want [ACGT] with ACNT left out", kmers.kmers(), err)
+	} else if kmers.remove("ACGT"); !kmers.screenedOut("ACGT") || kmers.screenedOut("ACNT") {
+		t.Error("screenedOut() should only report kmers removed from the table")
+	}
+	if kmers, err := kmerTableOf([]string{"TTTT", "ACGT", "TTTT"}, 4); err != nil || !reflect.DeepEqual(kmers.kmers(), []string{"ACGT", "TTTT"}) {
+		t.Errorf("kmerTableOf() = %v, %v, want [ACGT TTTT]", kmers.kmers(), err)
+	}
+}
+
+func Test_bestConstructPacked(t *testing.T) {
+	// The sliding bitset counts score each window as counting its kmers' hits one window at a time would
+	r := rand.New(rand.NewSource(5))
+	ref := randomTargets(r, 5, 300, 30)
+	for _, weighted := range []bool{false, true} {
+		goodKmers, _ := getKmers(ref, 9)
+		presence := tablePresence(goodKmers)
+		obj, _ := newObjective("mean", nil)
+		p := searchParams{kmerLen: 9, seqLen: len(ref), constructLen: 60, obj: obj, minHits: []int{1, 0, 0, 0, 0}}
+		if weighted {
+			p.kmerWeights = make([]float64, len(goodKmers.keys))
+			for row := range p.kmerWeights {
+				p.kmerWeights[row] = gcContent(goodKmers.kmer(int32(row))) / 100
+			}
+		}
+		seq := ref[2].Seq
+		got, err := bestConstruct(goodKmers, seq, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bestScore, bestPos := 0.0, 0
+		var bestHits []int
+		for i := 0; i <= len(seq)-p.constructLen; i++ {
+			hits := make([]int, p.seqLen)
+			var weightedHits []float64
+			if weighted {
+				weightedHits = make([]float64, p.seqLen)
+			}
+			for j := i; j <= i+p.constructLen-p.kmerLen; j++ {
+				kmer := seq[j : j+p.kmerLen]
+				row, _ := goodKmers.lookup(kmer)
+				for x, present := range presence[kmer] {
+					hits[x] += present
+					if weighted {
+						weightedHits[x] += float64(present) * p.kmerWeights[row]
+					}
+				}
+			}
+			if score, ok := windowScore(p, hits, weightedHits); ok && score > bestScore {
+				bestScore, bestPos, bestHits = score, i, hits
+			}
+		}
+		if got.score != bestScore || got.seq != seq[bestPos:bestPos+p.constructLen] || !reflect.DeepEqual(got.kmerHits, bestHits) {
+			t.Errorf("bestConstruct() = %v at %s, want %v at %s (weighted %v)", got.score, got.seq, bestScore, seq[bestPos:bestPos+p.constructLen], weighted)
+		}
+	}
+}
+
+func Test_bestConstructWholeConsensus(t *testing.T) {
+	// A consensus exactly the construct length is the construct
+	ref := []*HeaderRef{{Header: "a", Seq: "ACGTTGCA"}, {Header: "b", Seq: "ACGTTG"}}
+	goodKmers, _ := getKmers(ref, 4)
+	obj, _ := newObjective("mean", nil)
+	p := searchParams{kmerLen: 4, seqLen: len(ref), constructLen: 6, obj: obj}
+	got, err := bestConstruct(goodKmers, "ACGTTG", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.seq != "ACGTTG" || got.score != 3 || !reflect.DeepEqual(got.kmerHits, []int{3, 3}) {
+		t.Errorf("bestConstruct() = %s with hits %v (score %v), want ACGTTG with hits [3 3]", got.seq, got.kmerHits, got.score)
+	}
+}
+
+// boolToInt returns 1 for true and 0 for false
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// testKmerTable returns the table of kmers (all the same length) present in each target as in presence, which maps
+// each kmer to its presence/absence in each target (a kmer present in none is left out)
+func testKmerTable(presence map[string][]int) *kmerTable {
+	kmerLen, seqLen := 0, 0
+	for kmer, targets := range presence {
+		kmerLen, seqLen = len(kmer), len(targets)
+	}
+	t := newKmerTable(kmerLen, seqLen)
+	for kmer, targets := range presence {
+		pk, ok := packKmer(kmer)
+		if !ok || len(kmer) != kmerLen {
+			panic("test kmer " + kmer + " can't be packed")
+		}
+		for i, present := range targets {
+			if present > 0 {
+				t.add(pk, i)
+			}
+		}
+	}
+	t.sortRows()
+	return t
+}
+
+// tablePresence returns each kmer of a table mapped to its presence/absence in each target
+func tablePresence(t *kmerTable) map[string][]int {
+	presence := make(map[string][]int)
+	for _, kmer := range t.kmers() {
+		targets := make([]int, t.seqLen)
+		for _, i := range t.targets(kmer) {
+			targets[i] = 1
+		}
+		presence[kmer] = targets
+	}
+	return presence
+}
+
+// kmerValues returns values by kmer as values by row of a table (-1 for a kmer without a value)
+func kmerValues(t *kmerTable, vals map[string]float64) []float64 {
+	rows := make([]float64, len(t.keys))
+	for row := range rows {
+		rows[row] = -1
+		if v, ok := vals[t.kmer(int32(row))]; ok {
+			rows[row] = v
+		}
+	}
+	return rows
+}
+
+// rowValues returns values by row of a table as values by kmer, leaving out removed kmers
+func rowValues(t *kmerTable, rows []float64) map[string]float64 {
+	vals := make(map[string]float64)
+	for row, v := range rows {
+		if !t.removed[row] {
+			vals[t.kmer(int32(row))] = v
+		}
+	}
+	return vals
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseLengthRange returns the construct lengths given by a -constructLen value: a single length, or a min-max range
+// stepped by step (the max. is always included)
+func parseLengthRange(spec string, step int) ([]int, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	minLen, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("construct length '%s' must be an integer or a min-max range", spec)
+	}
+	maxLen := minLen
+	if len(parts) == 2 {
+		if maxLen, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return nil, fmt.Errorf("construct length '%s' must be an integer or a min-max range", spec)
+		}
+	}
+	if minLen < 1 || maxLen < minLen {
+		return nil, fmt.Errorf("construct length range '%s' must have 1 <= min <= max", spec)
+	}
+	if step < 1 {
+		return nil, fmt.Errorf("construct length step (%d) must be >= 1", step)
+	}
+	var lengths []int
+	for l := minLen; l < maxLen; l += step {
+		lengths = append(lengths, l)
+	}
+	return append(lengths, maxLen), nil
+}
+
+// lengthSelectModes are the ways a length is selected from a -constructLen range: the highest objective score per nt,
+// or the highest objective score less -lengthPenalty per nt
+var lengthSelectModes = []string{"perNt", "penalty"}
+
+// lengthPoint is the best construct found at one length of a construct length range
+type lengthPoint struct {
+	length    int
+	construct *construct // nil if no construct was found
+	selScore  float64    // objective score per nt, or less the length penalty, that the length is selected by
+}
+
+// lengthCurve finds the best construct at each length, with the same seed for each so lengths are compared over the
+// same greedy walks.  Each length is scored for selection by mode (one of lengthSelectModes), with penalty the score
+// penalty per nt of the "penalty" mode.
+func lengthCurve(goodKmers *kmerTable, kmerCts []float64, p searchParams, lengths []int, mode string, penalty float64) []lengthPoint {
+	curve := make([]lengthPoint, len(lengths))
+	for i, length := range lengths {
+		p.constructLen = length
+		curve[i] = lengthPoint{length: length}
+		if c := conBestConstruct(goodKmers, kmerCts, p); c != nil {
+			curve[i].construct = c
+			if mode == "perNt" {
+				curve[i].selScore = c.score / float64(length)
+			} else {
+				curve[i].selScore = c.score - penalty*float64(length)
+			}
+		}
+	}
+	return curve
+}
+
+// selectLength returns the index of the point with the highest selection score, preferring shorter constructs on ties,
+// or -1 if no construct was found at any length
+func selectLength(curve []lengthPoint) int {
+	best := -1
+	for i, pt := range curve {
+		if pt.construct != nil && (best < 0 || pt.selScore > curve[best].selScore) {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseLengthRange(t *testing.T) {
+	tests := []struct {
+		spec    string
+		step    int
+		want    []int
+		wantErr bool
+	}{
+		{"300", 50, []int{300}, false},
+		{"200-400", 100, []int{200, 300, 400}, false},
+		{"200-450", 100, []int{200, 300, 400, 450}, false},
+		{" 100 - 100 ", 10, []int{100}, false},
+		{"abc", 50, nil, true},
+		{"200-", 50, nil, true},
+		{"400-200", 50, nil, true},
+		{"0-200", 50, nil, true},
+		{"200-400", 0, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLengthRange(tt.spec, tt.step)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLengthRange(%q, %d) error = %v, wantErr %v", tt.spec, tt.step, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLengthRange(%q, %d) = %v, want %v", tt.spec, tt.step, got, tt.want)
+		}
+	}
+}
+
+func Test_lengthCurve(t *testing.T) {
+	ref := []*HeaderRef{
+		{Header: "ref_1", Seq: "AAAACCCAAGGTTGCA"},
+		{Header: "ref_2", Seq: "AAAACCCAAGGTTGCA"},
+	}
+	goodKmers, _ := getKmers(ref, 4)
+	p := searchParams{kmerLen: 4, seqLen: len(ref), iterations: 10, seed: 1, obj: objective{name: "median"}}
+
+	curve := lengthCurve(goodKmers, kmerAbun(goodKmers, nil), p, []int{6, 10, 40}, "penalty", 0)
+	if curve[0].construct == nil || curve[1].construct == nil || curve[2].construct != nil {
+		t.Fatalf("lengthCurve() constructs found = %v, %v, %v, want 6 and 10 nt only", curve[0].construct != nil, curve[1].construct != nil, curve[2].construct != nil)
+	}
+	if len(curve[1].construct.seq) != 10 || curve[1].construct.score <= curve[0].construct.score {
+		t.Errorf("lengthCurve() 10 nt construct = %s (score %v), want a higher score than at 6 nt (%v)", curve[1].construct.seq, curve[1].construct.score, curve[0].construct.score)
+	}
+	if got := selectLength(curve); got != 1 {
+		t.Errorf("selectLength() = %d, want 1", got)
+	}
+
+	// A steep enough penalty favors the shorter construct
+	curve = lengthCurve(goodKmers, kmerAbun(goodKmers, nil), p, []int{6, 10, 40}, "penalty", 10)
+	if got := selectLength(curve); got != 0 {
+		t.Errorf("selectLength() with penalty = %d, want 0", got)
+	}
+
+	// Scored per nt, a shorter construct of kmers shared by both targets beats a longer one running into a single
+	// target's kmers
+	ref = []*HeaderRef{
+		{Header: "ref_1", Seq: "ACGTTGCAAGCT" + "GGATCCTTAGACCATGTCAA"},
+		{Header: "ref_2", Seq: "ACGTTGCAAGCT" + "TTCGAAGCGCTATTACGGTC"},
+	}
+	goodKmers, _ = getKmers(ref, 6)
+	p = searchParams{kmerLen: 6, seqLen: len(ref), iterations: 10, seed: 1, obj: objective{name: "mean"}}
+	curve = lengthCurve(goodKmers, kmerAbun(goodKmers, nil), p, []int{12, 24}, "perNt", 0)
+	if curve[0].construct == nil || curve[1].construct == nil || curve[1].construct.score <= curve[0].construct.score {
+		t.Fatalf("lengthCurve() = %+v, want a higher objective score at 24 nt", curve)
+	}
+	if got := selectLength(curve); got != 0 {
+		t.Errorf("selectLength() per nt = %d (score per nt %v), want 0", got, []float64{curve[0].selScore, curve[1].selScore})
+	}
+
+	if got := selectLength([]lengthPoint{{length: 100}}); got != -1 {
+		t.Errorf("selectLength() = %d, want -1 when no construct was found", got)
+	}
+}
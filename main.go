@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var Version = "1.1.14"
@@ -45,99 +48,826 @@ func intWithCommas(i int) string {
 	return strings.Join(out, ",")
 }
 
-func clInput() (*string, *string, *int, *string, *int, *int, *int, *string, *int, *string, error) {
-	refFile := flag.String("targets", "", "Path to target FASTA file (required)")
-	otRefFiles := flag.String("offTargets", "", "Comma-separated list of off-target FASTA file/s")
-	otKmerFile := flag.String("offTargetKmers", "", "Path to off-target kmer file (optional)")
-	kmerLength := flag.Int("kmerLen", 21, "Kmer length")
-	otKmerLength := flag.Int("otKmerLen", *kmerLength, "Off-target Kmer length (must be <= kmer length)")
-	consLength := flag.Int("constructLen", 300, "dsRNA sense arm length")
-	iterations := flag.Int("iterations", 100, "No. of iterations")
-	biasHeader := flag.String("biasHeader", "", "Header of target sequence to bias toward")
-	biasLvl := flag.Int("biasLvl", 0, "Level of bias to apply")
-	csv := flag.String("csv", "", "CSV file name (optional)")
+// options holds the command line parameters for a run
+type options struct {
+	refFile      string
+	otRefFiles   string
+	otKmerFile   string
+	kmerLength   int
+	otKmerLength int
+	otKmerLenSet bool // whether -otKmerLen was given
+	otMismatches int
+	otPolicy     string
+	otSeedExtra  int
+	otWobble     bool
+	consLength   int   // construct length, or the shortest of a range
+	consLengths  []int // construct lengths to compare
+	consLenSpec  string
+	lengthStep   int
+	lengthPenal  float64
+	lengthSelect string
+	iterations   int
+	timeout      time.Duration
+	search       string
+	maxNodes     int
+	refineTime   time.Duration
+	refineSteps  int
+	refineT0     float64
+	refineT1     float64
+	seed         int64
+	seedSet      bool // whether -seed was given; if not, the search is seeded from the current time
+	top          int
+	objective    string
+	weightsFile  string
+	minHits      int
+	panel        int
+	groupsFile   string
+	groupLens    string
+	topMaxShared float64
+	biasHeader   string
+	biasLvl      int
+	maxHomopol   int
+	gcWindow     int
+	gcMin        float64
+	gcMax        float64
+	forbidMotifs string
+	primers      bool
+	primerTm     float64
+	primerTarget string
+	hairpin      string
+	spacer       string
+	spacerSeq    string // spacer loaded from -spacer
+	hairpinOT    bool   // write hairpin cassettes even if the spacer or its junctions match an off-target
+	csv          string
+	otReport     string
+	json         string
+	progress     string
+	siRNAScore   string
+	siRNAWeight  bool
+	evalSeq      string
+	candidates   string
+}
+
+// isFlagSet reports whether a flag was given on the command line, rather than taking its default
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// setCommonDefaults sets the defaults of common flags that depend on other flags, once they're parsed
+func setCommonDefaults(fs *flag.FlagSet, opts *options) {
+	if opts.siRNAWeight && !isFlagSet(fs, "siRNAScore") {
+		opts.siRNAScore = siRNAScorerNames[0]
+	}
+	opts.otKmerLenSet = isFlagSet(fs, "otKmerLen")
+}
+
+// addCommonFlags defines the target, off-target and scoring flags shared by design and evaluate runs
+func addCommonFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.refFile, "targets", "", "Path to target FASTA/FASTQ file, optionally gzip/bgzip/zstd compressed (required)")
+	fs.StringVar(&opts.otRefFiles, "offTargets", "", "Comma-separated list of off-target FASTA/FASTQ file/s, optionally gzip/bgzip/zstd compressed")
+	fs.StringVar(&opts.otKmerFile, "offTargetKmers", "", "Path to off-target kmer file (optional)")
+	fs.IntVar(&opts.kmerLength, "kmerLen", 21, "Kmer length (max. 64)")
+	fs.IntVar(&opts.otKmerLength, "otKmerLen", opts.kmerLength, "Off-target Kmer length (must be <= kmer length)")
+	fs.IntVar(&opts.otMismatches, "otMismatches", 0, "Max. mismatches (Hamming distance, 0-2) tolerated for an off-target kmer match (off-target FASTA files only)")
+	fs.StringVar(&opts.otPolicy, "otPolicy", "full", "Off-target matching policy: 'full' (whole kmer) or 'seed' (guide positions 2-8 plus -otSeedExtra 3' positions, both strands)")
+	fs.IntVar(&opts.otSeedExtra, "otSeedExtra", 4, "No. of guide positions 3' of the seed region included in a 'seed' policy off-target match")
+	fs.BoolVar(&opts.otWobble, "otWobble", false, "Also remove kmers matching an off-target with G:U wobble pairing (off-target FASTA files and -otPolicy full only)")
+	fs.StringVar(&opts.objective, "objective", "median", "Construct objective for kmer hits to each target: "+strings.Join(objectiveNames, ", "))
+	fs.StringVar(&opts.weightsFile, "weights", "", "TSV file of target header, weight and (optionally) min. kmer hits for that target")
+	fs.StringVar(&opts.csv, "csv", "", "CSV file name (optional)")
+	fs.StringVar(&opts.siRNAScore, "siRNAScore", "none", "siRNA efficacy scorer adding efficacy columns to the results table: "+strings.Join(siRNAScorerNames, ", ")+" or none (kmers >= 19 nt only)")
+	fs.BoolVar(&opts.siRNAWeight, "siRNAWeight", false, "Weight each kmer's hits in the objective by its siRNA efficacy score (reynolds unless -siRNAScore is set)")
+	fs.StringVar(&opts.json, "json", "", "JSON file of the complete results - parameters, input checksums, constructs, per-target and per-kmer statistics (optional)")
+	fs.StringVar(&opts.progress, "progress", "auto", "Progress reporting for long-running stages: bar, log (a line every 30s), auto (bar if stderr is a terminal, log otherwise) or none")
+	fs.StringVar(&opts.otReport, "otReport", "", "Off-target match report file - file, record, position and strand of each match (JSON if it ends in .json, TSV otherwise)")
+}
+
+func clInput() (*options, error) {
+	opts := &options{}
+	addCommonFlags(flag.CommandLine, opts)
+	flag.StringVar(&opts.consLenSpec, "constructLen", "300", "dsRNA sense arm length, or a min-max range of lengths to compare (e.g. 200-500)")
+	flag.IntVar(&opts.lengthStep, "lengthStep", 50, "Step between the lengths of a -constructLen range")
+	flag.StringVar(&opts.lengthSelect, "lengthSelect", "perNt", "How a length is selected from a -constructLen range: perNt (highest objective score per nt) or penalty (highest score less -lengthPenalty per nt; the default if -lengthPenalty is given)")
+	flag.Float64Var(&opts.lengthPenal, "lengthPenalty", 0, "Objective score penalty per nt when selecting a length from a -constructLen range with -lengthSelect penalty")
+	flag.IntVar(&opts.iterations, "iterations", 100, "No. of iterations")
+	flag.DurationVar(&opts.timeout, "timeout", 0, "Stop the construct search after this long (e.g. 10m) and report the best construct found so far (0 = no limit)")
+	flag.StringVar(&opts.search, "search", "greedy", "Construct search: greedy (random greedy iterations) or exhaustive (branch-and-bound for the optimal construct, reporting the greedy construct's optimality gap)")
+	flag.IntVar(&opts.maxNodes, "maxNodes", 10000000, "Max. nodes expanded by -search exhaustive before stopping with the best construct and upper bound so far")
+	flag.DurationVar(&opts.refineTime, "refine", 0, "Time budget for simulated annealing refinement of the greedy construct (e.g. 30s, 2m; 0 = no refinement)")
+	flag.IntVar(&opts.refineSteps, "refineSteps", 0, "No. of refinement steps - the temperature schedule runs over these steps instead of the -refine time budget, for reproducible results (0 = time budget only)")
+	flag.Float64Var(&opts.refineT0, "refineT0", 5, "Initial refinement temperature, in objective score units")
+	flag.Float64Var(&opts.refineT1, "refineT1", 0.05, "Final refinement temperature, reached by geometric cooling")
+	flag.Int64Var(&opts.seed, "seed", 0, "Random seed for the construct search (any value, including 0; default: seeded from the current time)")
+	flag.IntVar(&opts.top, "top", 1, "No. of distinct constructs to report")
+	flag.Float64Var(&opts.topMaxShared, "topMaxShared", 0.2, "Max. fraction of kmers a reported construct may share with a better-ranked one (-top > 1)")
+	flag.IntVar(&opts.minHits, "minHits", 0, "Min. kmer hits required for every target (per-target minimums can be set with -weights)")
+	flag.IntVar(&opts.panel, "panel", 0, "Design a panel of up to this many constructs so every target reaches its min. kmer hits (0 = single construct)")
+	flag.StringVar(&opts.groupsFile, "groups", "", "TSV file of target header and group name - designs a chimeric construct with a segment per group")
+	flag.StringVar(&opts.groupLens, "groupLens", "", "Comma-separated group=length segment lengths summing to -constructLen (default: an even split)")
+	flag.IntVar(&opts.maxHomopol, "maxHomopolymer", 0, "Max. homopolymer run length in the construct (0 = no limit)")
+	flag.IntVar(&opts.gcWindow, "gcWindow", 50, "Sliding window length for -gcMin and -gcMax")
+	flag.Float64Var(&opts.gcMin, "gcMin", 0, "Min. GC content (%) of every -gcWindow window of the construct")
+	flag.Float64Var(&opts.gcMax, "gcMax", 100, "Max. GC content (%) of every -gcWindow window of the construct")
+	flag.StringVar(&opts.forbidMotifs, "forbidMotifs", "", "Comma-separated IUPAC motifs the construct must not contain on either strand (e.g. restriction sites)")
+	flag.BoolVar(&opts.primers, "primers", false, "Design T7 promoter-tailed PCR primers at the ends of each construct")
+	flag.Float64Var(&opts.primerTm, "primerTm", 60, "Target Tm (°C) of the construct-binding region of each T7 primer")
+	flag.StringVar(&opts.primerTarget, "primerTarget", "", "Header of a target both T7 primer sites must be present in, to amplify the template from its cDNA (implies -primers)")
+	flag.StringVar(&opts.hairpin, "hairpin", "", "Write a hairpin (ihpRNA) cassette of each construct to <prefix>.fa and <prefix>.gb")
+	flag.StringVar(&opts.spacer, "spacer", "", "Hairpin spacer/intron sequence, or a FASTA file of it (default: a 60 nt synthetic loop)")
+	flag.BoolVar(&opts.hairpinOT, "hairpinAllowOffTargets", false, "Write a hairpin cassette even if its spacer or junction kmers match an off-target (an error otherwise)")
+	flag.StringVar(&opts.biasHeader, "biasHeader", "", "Header of target sequence to bias toward")
+	flag.IntVar(&opts.biasLvl, "biasLvl", 0, "Level of bias to apply")
 	flag.Parse()
-	if *refFile == "" {
-		return refFile, otRefFiles, kmerLength, otKmerFile, otKmerLength, consLength, iterations, biasHeader, biasLvl, csv, errors.New("error: no target FASTA file was specificed")
+	if opts.refFile == "" {
+		return opts, errors.New("error: no target FASTA file was specificed")
+	}
+	if err := setProgressMode(opts.progress, os.Stderr); err != nil {
+		return opts, err
+	}
+	lengths, err := parseLengthRange(opts.consLenSpec, opts.lengthStep)
+	if err != nil {
+		return opts, err
+	}
+	opts.consLengths = lengths
+	opts.consLength = lengths[0]
+	if opts.primerTarget != "" {
+		opts.primers = true
 	}
-	return refFile, otRefFiles, kmerLength, otKmerFile, otKmerLength, consLength, iterations, biasHeader, biasLvl, csv, nil
+	setCommonDefaults(flag.CommandLine, opts)
+	if isFlagSet(flag.CommandLine, "lengthPenalty") && !isFlagSet(flag.CommandLine, "lengthSelect") {
+		opts.lengthSelect = "penalty"
+	}
+	if opts.lengthSelect != "perNt" && opts.lengthSelect != "penalty" {
+		return opts, fmt.Errorf("unknown length selection '%s' (one of %s)", opts.lengthSelect, strings.Join(lengthSelectModes, ", "))
+	}
+	opts.seedSet = isFlagSet(flag.CommandLine, "seed")
+	return opts, nil
 }
 
 func main() {
 	log.Printf("dsRNAmax - dsRNA maximizer (Version: %s)\n", Version)
 
-	refFile, otRefFiles, kmerLength, otKmerFile, otKmerLength, consLength, iterations, biasHeader, biasLvl, csv, err := clInput()
+	if len(os.Args) > 1 && os.Args[1] == "evaluate" {
+		runEvaluate(os.Args[2:])
+		return
+	}
+
+	opts, err := clInput()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if *otKmerLength > *kmerLength && *otKmerFile == "" {
-		log.Fatalf("Off-target kmer length (%d) must be <= kmer length (%d)", *otKmerLength, *kmerLength)
+	if opts.top < 1 {
+		log.Fatalf("No. of constructs to report (%d) must be >= 1", opts.top)
+	}
+
+	if opts.kmerLength < 1 || opts.kmerLength > maxPackedKmerLen {
+		log.Fatalf("Kmer length (%d) must be 1-%d", opts.kmerLength, maxPackedKmerLen)
+	}
+
+	if opts.minHits < 0 {
+		log.Fatalf("Min. kmer hits (%d) must be >= 0", opts.minHits)
+	}
+
+	if opts.panel < 0 {
+		log.Fatalf("Max. no. of panel constructs (%d) must be >= 0", opts.panel)
+	}
+
+	if opts.panel > 0 && opts.top > 1 {
+		log.Fatalln("Error: -panel and -top cannot be combined")
+	}
+
+	if opts.groupsFile != "" && (opts.panel > 0 || opts.top > 1) {
+		log.Fatalln("Error: -groups cannot be combined with -panel or -top")
 	}
 
-	if _, err := os.Stat(*refFile); os.IsNotExist(err) {
-		log.Fatalf("Target FASTA file does not exist: %s", *refFile)
+	if len(opts.consLengths) > 1 && (opts.groupsFile != "" || opts.panel > 0 || opts.top > 1) {
+		log.Fatalln("Error: a -constructLen range cannot be combined with -groups, -panel or -top")
 	}
 
-	log.Printf("Target FASTA File: %s", *refFile)
-	if *otRefFiles != "" {
-		log.Printf("Off-target FASTA File: %s", *otRefFiles)
+	if opts.search != "greedy" && opts.search != "exhaustive" {
+		log.Fatalf("Unknown construct search '%s' - must be one of %s", opts.search, strings.Join(searchNames, ", "))
+	}
+
+	if opts.search == "exhaustive" && (opts.groupsFile != "" || opts.panel > 0 || opts.top > 1 || len(opts.consLengths) > 1) {
+		log.Fatalln("Error: -search exhaustive cannot be combined with -groups, -panel, -top or a -constructLen range")
+	}
+
+	if opts.refineTime < 0 || opts.refineSteps < 0 || opts.timeout < 0 {
+		log.Fatalln("Error: -refine, -refineSteps and -timeout must be >= 0")
+	}
+
+	if opts.refineT0 <= 0 || opts.refineT1 <= 0 || opts.refineT1 > opts.refineT0 {
+		log.Fatalf("Refinement temperatures must satisfy 0 < -refineT1 (%g) <= -refineT0 (%g)", opts.refineT1, opts.refineT0)
+	}
+
+	refining := opts.refineTime > 0 || opts.refineSteps > 0
+	if refining && (opts.groupsFile != "" || opts.panel > 0 || opts.top > 1 || len(opts.consLengths) > 1 || opts.search == "exhaustive") {
+		log.Fatalln("Error: refinement cannot be combined with -groups, -panel, -top, a -constructLen range or -search exhaustive")
+	}
+
+	policy, err := offTargetPolicy(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	constraints, err := newSeqConstraints(opts.maxHomopol, opts.gcWindow, opts.gcMin, opts.gcMax, opts.forbidMotifs, opts.consLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.hairpin != "" {
+		if opts.spacerSeq, err = loadSpacer(opts.spacer); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(opts.refFile); os.IsNotExist(err) {
+		log.Fatalf("Target FASTA file does not exist: %s", opts.refFile)
+	}
+
+	log.Printf("Target FASTA File: %s", opts.refFile)
+	if opts.otRefFiles != "" {
+		log.Printf("Off-target FASTA File: %s", opts.otRefFiles)
 	}
 
 	log.Println("Loading target sequences...")
-	ref := RefLoad(*refFile)
+	ref := RefLoad(opts.refFile)
+
+	if opts.primerTarget != "" && findTarget(ref, opts.primerTarget) == nil {
+		log.Fatalf("Primer target '%s' not present in target file", opts.primerTarget)
+	}
+
+	var weights []float64
+	var targetMinHits []int
+	if opts.weightsFile != "" {
+		log.Printf("Loading target weights from %s...", opts.weightsFile)
+		weights, targetMinHits, err = loadTargetWeights(opts.weightsFile, ref)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	if *biasHeader != "" {
-		log.Printf("Applying bias modification to sequence '%s' at level %d...", *biasHeader, *biasLvl)
-		ref, err = biasMod(ref, *biasHeader, *biasLvl)
+	var groups []*targetGroup
+	if opts.groupsFile != "" {
+		log.Printf("Loading target groups from %s...", opts.groupsFile)
+		groups, err = loadTargetGroups(opts.groupsFile, ref)
+		if err == nil {
+			err = setGroupLengths(groups, opts.groupLens, opts.consLength, opts.kmerLength)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
+	if opts.biasHeader != "" {
+		log.Printf("Applying bias modification to sequence '%s' at level %d...", opts.biasHeader, opts.biasLvl)
+		if weights == nil {
+			weights = uniformWeights(len(ref))
+		}
+		if err := biasWeights(weights, ref, opts.biasHeader, opts.biasLvl); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	obj, err := newObjective(opts.objective, weights)
+	if err != nil {
+		log.Fatal(err)
+	}
+	eff, err := newSiRNAEfficacy(opts.siRNAScore, opts.siRNAWeight, opts.kmerLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if eff == nil && opts.siRNAScore != "none" {
+		log.Printf("siRNA efficacy is not scored for kmers shorter than %d nt", siRNACoreLen)
+	}
+
 	log.Println("Getting target sequence kmers...")
-	goodKmers := getKmers(ref, *kmerLength)
-	log.Printf("%s target kmers loaded\n", intWithCommas(len(goodKmers)))
+	goodKmers, err := getKmers(ref, opts.kmerLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s target kmers loaded\n", intWithCommas(goodKmers.len()))
+	totalKmers := goodKmers.len()
+	minHits := combineMinHits(opts.minHits, targetMinHits, len(ref))
+	preFilterCounts := kmersPerTarget(goodKmers, len(ref))
 
-	if *otRefFiles != "" && *otKmerFile != "" {
-		log.Fatalln("Error: both off-target FASTA files and an off-target kmer file specified. Please specify only one.")
+	var rec *otRecorder
+	if opts.otReport != "" {
+		rec = &otRecorder{}
 	}
 
-	if *otRefFiles != "" {
+	if opts.otRefFiles != "" {
 		log.Println("Removing off-target kmers from FASTA files...")
-		files := strings.Split(*otRefFiles, ",")
-		for _, file := range files {
-			if _, err := os.Stat(file); os.IsNotExist(err) {
-				log.Fatalf("Off-target FASTA file does not exist: %s", file)
-			}
+		files := strings.Split(opts.otRefFiles, ",")
+		if policy.seedOnly {
+			log.Printf("Off-target matches to guide positions %d-%d of either strand will be removed", seedRegionStart+1, seedRegionStart+seedRegionLen+policy.seedExtra)
+		}
+		if opts.otWobble {
+			log.Println("Off-target kmers matching with G:U wobble pairing will be removed")
+		}
+		if opts.otMismatches > 0 {
+			log.Printf("Off-target kmers with up to %d mismatch(es) will be removed", opts.otMismatches)
 		}
-		removeOffTargetKmersFromFasta(files, goodKmers, *kmerLength, *otKmerLength)
+		removeOffTargetKmersFromFasta(files, goodKmers, opts.kmerLength, policy, rec)
 	}
 
-	if *otKmerFile != "" {
+	if opts.otKmerFile != "" {
 		log.Println("Removing off-target kmers from kmer file...")
-		err := removeOffTargetKmersFromFile(goodKmers, *otKmerFile, *kmerLength)
+		err := removeOffTargetKmersFromFile(goodKmers, opts.otKmerFile, opts.kmerLength, policy, rec)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	log.Println("Finding best construct...")
-	kmerCts := kmerAbun(goodKmers)
-	selConstruct := conBestConstruct(goodKmers, kmerCts, *kmerLength, len(ref), *consLength, *iterations)
-	if selConstruct != nil {
+	if rec != nil {
+		if err := writeOTReport(opts.otReport, rec.sortedHits()); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Off-target report (%s matches) written to %s", intWithCommas(len(rec.hits)), opts.otReport)
+	}
 
-		outputResults(goodKmers, kmerLength, selConstruct, ref, *csv)
-	} else {
+	var kmerWeights []float64
+	if eff != nil && eff.weighted {
+		log.Printf("Weighting kmer hits by %s siRNA efficacy...", eff.scorer.name())
+		kmerWeights = eff.kmerWeights(goodKmers)
+	}
+
+	if !opts.seedSet {
+		opts.seed = time.Now().UnixNano()
+	}
+	report, err := newJSONReport("design", opts, ref)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.otRefFiles != "" || opts.otKmerFile != "" {
+		report.setOffTargetCounts(totalKmers, goodKmers.len())
+	}
+	ctx, cancel := searchContext(opts.timeout)
+	defer cancel()
+	log.Printf("Finding best construct (objective: %s, seed: %d)...", opts.objective, opts.seed)
+	fmt.Printf("Random seed: %d (-seed %d reproduces this run)\n", opts.seed, opts.seed)
+	kmerCts := kmerAbun(goodKmers, weights)
+	if groups != nil {
+		designChimeraConstruct(ctx, goodKmers, weights, minHits, kmerWeights, constraints, ref, obj, eff, opts, policy, groups, report)
+		writeJSONReport(report, opts.json)
+		return
+	}
+	if opts.panel > 0 {
+		if minHits == nil {
+			log.Fatalln("Error: panel design (-panel) requires -minHits and/or per-target min. kmer hits in a -weights file")
+		}
+		designPanelConstructs(ctx, goodKmers, weights, kmerWeights, constraints, ref, obj, eff, opts, policy, minHits, report)
+		writeJSONReport(report, opts.json)
+		return
+	}
+	params := searchParams{
+		kmerLen:      opts.kmerLength,
+		seqLen:       len(ref),
+		constructLen: opts.consLength,
+		iterations:   opts.iterations,
+		seed:         opts.seed,
+		obj:          obj,
+		minHits:      minHits,
+		kmerWeights:  kmerWeights,
+		constraints:  constraints,
+		ctx:          ctx,
+	}
+	if len(opts.consLengths) > 1 {
+		designLengthRange(goodKmers, kmerCts, params, ref, obj, eff, opts, policy, report)
+		writeJSONReport(report, opts.json)
+		return
+	}
+	selConstructs := conTopConstructs(goodKmers, kmerCts, params, opts.top, opts.topMaxShared)
+	if opts.search == "exhaustive" {
+		selConstructs = searchExhaustive(goodKmers, selConstructs, params, opts.maxNodes, report)
+	}
+	if refining && len(selConstructs) > 0 {
+		selConstructs[0] = refineSelected(goodKmers, kmerCts, ref, selConstructs[0], params, opts, report)
+	}
+	logSearchStopped(ctx, report)
+	if len(selConstructs) == 0 && (minHits != nil || constraints != nil) {
+		unconstrained := params
+		unconstrained.minHits = nil
+		unconstrained.constraints = nil
+		best := conBestConstruct(goodKmers, kmerCts, unconstrained)
+		if constraints != nil && best != nil {
+			if issues := constraints.unmet(best.seq); len(issues) > 0 {
+				log.Println("Could not identify a dsRNA sense arm sequence meeting the composition constraints - the best unconstrained construct breaks:")
+				for _, issue := range issues {
+					log.Println("  " + issue)
+				}
+			}
+		}
+		if minHits != nil {
+			log.Println("Could not identify a dsRNA sense arm sequence meeting the min. kmer hits for every target:")
+			for _, issue := range diagnoseCoverage(ref, goodKmers, preFilterCounts, params, best) {
+				log.Println("  " + issue)
+			}
+		}
+		os.Exit(1)
+	}
+	if len(selConstructs) == 0 {
 		log.Println("Could not identify a dsRNA sense arm sequence. Check input format, increase OT kmer length, and/or try a shorter construct length")
 		os.Exit(1)
 	}
+	if minHits != nil {
+		log.Println("Min. kmer hits met for every target")
+	}
+	if constraints != nil {
+		log.Println("Composition constraints met")
+	}
+	if len(selConstructs) < opts.top {
+		log.Printf("Only %d distinct construct(s) found - try more iterations and/or a higher -topMaxShared", len(selConstructs))
+	}
+	for i, selConstruct := range selConstructs {
+		if len(selConstructs) > 1 {
+			fmt.Printf("\n=== Construct %d of %d ===\n", i+1, len(selConstructs))
+		}
+		outputResults(goodKmers, &opts.kmerLength, selConstruct, ref, obj, eff, numberedFileName(opts.csv, i, len(selConstructs)))
+		reportConstruct(selConstruct.seq, i, len(selConstructs), ref, opts, policy)
+		report.addConstruct("construct "+strconv.Itoa(i+1), goodKmers, opts.kmerLength, selConstruct, ref, obj, eff)
+	}
+	writeJSONReport(report, opts.json)
+}
+
+// designLengthRange finds the best construct at each length of a -constructLen range, reports the length-vs-score
+// curve, and outputs the construct of the length with the best -lengthSelect score
+func designLengthRange(goodKmers *kmerTable, kmerCts []float64, params searchParams, ref []*HeaderRef, obj objective, eff *siRNAEfficacy, opts *options, policy otPolicy, report *jsonReport) {
+	log.Printf("Comparing %d construct lengths from %d to %d nt...", len(opts.consLengths), opts.consLengths[0], opts.consLengths[len(opts.consLengths)-1])
+	curve := lengthCurve(goodKmers, kmerCts, params, opts.consLengths, opts.lengthSelect, opts.lengthPenal)
+	logSearchStopped(params.ctx, report)
+	selected := selectLength(curve)
+	outputLengthCurve(curve, selected, opts.lengthSelect)
+	report.setLengthCurve(curve, selected)
+	if selected < 0 {
+		log.Println("Could not identify a dsRNA sense arm sequence at any length. Check input format, increase OT kmer length, and/or try shorter construct lengths")
+		os.Exit(1)
+	}
+	log.Printf("Selected construct length: %d nt", curve[selected].length)
+	outputResults(goodKmers, &opts.kmerLength, curve[selected].construct, ref, obj, eff, opts.csv)
+	reportConstruct(curve[selected].construct.seq, 0, 1, ref, opts, policy)
+	report.addConstruct("construct "+strconv.Itoa(curve[selected].length)+" nt", goodKmers, opts.kmerLength, curve[selected].construct, ref, obj, eff)
+}
+
+// designPanelConstructs designs and outputs a panel of constructs covering every target (see designPanel).  Coverage
+// counts unweighted kmer hits, with any kmer weights only used to report each construct's objective score.
+func designPanelConstructs(ctx context.Context, goodKmers *kmerTable, weights []float64, kmerWeights []float64, constraints *seqConstraints, ref []*HeaderRef, obj objective, eff *siRNAEfficacy, opts *options, policy otPolicy, minHits []int, report *jsonReport) {
+	params := searchParams{
+		kmerLen:      opts.kmerLength,
+		seqLen:       len(ref),
+		constructLen: opts.consLength,
+		iterations:   opts.iterations,
+		seed:         opts.seed,
+		constraints:  constraints,
+		ctx:          ctx,
+	}
+	panel, uncovered := designPanel(goodKmers, weights, params, minHits, opts.panel)
+	logSearchStopped(ctx, report)
+	if len(panel) == 0 {
+		log.Println("Could not identify a dsRNA sense arm sequence covering any target. Check input format, increase OT kmer length, lower -minHits and/or try a shorter construct length")
+		os.Exit(1)
+	}
+	scoreParams := searchParams{kmerLen: opts.kmerLength, seqLen: len(ref), obj: obj, kmerWeights: kmerWeights}
+	for i, pc := range panel {
+		// Report each construct by the run's objective across all targets
+		pc.score = scoreConstruct(goodKmers, pc.seq, scoreParams).score
+		fmt.Printf("\n=== Panel construct %d of %d ===\n", i+1, len(panel))
+		outputResults(goodKmers, &opts.kmerLength, pc.construct, ref, obj, eff, numberedFileName(opts.csv, i, len(panel)))
+		reportConstruct(pc.seq, i, len(panel), ref, opts, policy)
+		report.addConstruct("panel construct "+strconv.Itoa(i+1), goodKmers, opts.kmerLength, pc.construct, ref, obj, eff)
+	}
+	outputPanelCoverage(panel, ref, minHits)
+	report.setPanelCoverage(panel, ref, minHits)
+	if len(uncovered) > 0 {
+		headers := make([]string, len(uncovered))
+		for i, idx := range uncovered {
+			headers[i] = ref[idx].Header
+		}
+		log.Printf("%d target(s) not covered by a panel of %d construct(s): %s", len(uncovered), len(panel), strings.Join(headers, ", "))
+		log.Println("Try a larger -panel, a lower -minHits, looser composition constraints and/or more iterations")
+	}
+}
+
+// chimeraCandidates is the no. of candidate segments designed for each group of a chimeric construct
+const chimeraCandidates = 5
+
+// designChimeraConstruct designs a segment for each target group, then joins them into a chimeric construct whose
+// junction-spanning kmers don't match any off-target.
+func designChimeraConstruct(ctx context.Context, goodKmers *kmerTable, weights []float64, minHits []int, kmerWeights []float64, constraints *seqConstraints, ref []*HeaderRef, obj objective, eff *siRNAEfficacy, opts *options, policy otPolicy, groups []*targetGroup, report *jsonReport) {
+	candidates := make([][]*construct, len(groups))
+	for g, group := range groups {
+		kmers := groupKmers(goodKmers, group.members)
+		if kmers.len() == 0 {
+			log.Fatalf("No kmers remain for group '%s' after off-target filtering", group.name)
+		}
+		groupWeights := subsetFloats(weights, group.members)
+		groupObj, err := newObjective(opts.objective, groupWeights)
+		if err != nil {
+			log.Fatal(err)
+		}
+		params := searchParams{
+			kmerLen:      opts.kmerLength,
+			seqLen:       len(group.members),
+			constructLen: group.length,
+			iterations:   opts.iterations,
+			seed:         opts.seed,
+			obj:          groupObj,
+			minHits:      subsetInts(minHits, group.members),
+			constraints:  constraints,
+			ctx:          ctx,
+		}
+		if kmerWeights != nil {
+			params.kmerWeights = eff.kmerWeights(kmers)
+		}
+		// Alternatives are only excluded when all their kmers are shared, so segments shifted by a few nt remain candidates
+		maxShared := 1 - 0.5/float64(group.length-opts.kmerLength+1)
+		candidates[g] = conTopConstructs(kmers, kmerAbun(kmers, groupWeights), params, chimeraCandidates, maxShared)
+		if len(candidates[g]) == 0 {
+			log.Fatalf("Could not identify a %d nt segment for group '%s'", group.length, group.name)
+		}
+		log.Printf("Group '%s': %d candidate %d nt segment(s) for %d target(s)", group.name, len(candidates[g]), group.length, len(group.members))
+	}
+	logSearchStopped(ctx, report)
+
+	otJunctionKmers := make(map[string]struct{})
+	if opts.otRefFiles != "" || opts.otKmerFile != "" {
+		log.Println("Checking segment junction kmers against off-targets...")
+		junctionKmers := chimeraJunctionKmers(candidates, opts.kmerLength)
+		remaining, err := kmerTableOf(junctionKmers, opts.kmerLength)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := removeOffTargets(remaining, opts, policy, nil); err != nil {
+			log.Fatal(err)
+		}
+		for _, kmer := range junctionKmers {
+			if remaining.screenedOut(kmer) {
+				otJunctionKmers[kmer] = struct{}{}
+			}
+		}
+	}
+
+	chim := assembleChimera(candidates, otJunctionKmers, constraints, opts.kmerLength)
+	if chim == nil {
+		log.Println("Every combination of group segments has a junction kmer matching an off-target or breaks a composition constraint. Try other -groupLens, a different -seed and/or more iterations")
+		os.Exit(1)
+	}
+	scoreParams := searchParams{kmerLen: opts.kmerLength, seqLen: len(ref), obj: obj, kmerWeights: kmerWeights}
+	selConstruct := scoreConstruct(goodKmers, chim.seq, scoreParams)
+	outputResults(goodKmers, &opts.kmerLength, selConstruct, ref, obj, eff, opts.csv)
+	outputChimeraSegments(groups, candidates, chim)
+	reportConstruct(chim.seq, 0, 1, ref, opts, policy)
+	report.addConstruct("chimeric construct", goodKmers, opts.kmerLength, selConstruct, ref, obj, eff)
+}
+
+// searchContext returns the context of the construct search, cancelled by the first SIGINT (Ctrl-C) or once timeout
+// (0 for none) has passed.  Once it's done, SIGINT quits as usual.
+func searchContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		select {
+		case <-sigs:
+			log.Println("Interrupted - stopping the construct search (Ctrl-C again to quit)")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
+
+// logSearchStopped logs whether the construct search was stopped early, so only the best construct(s) found so far are
+// reported
+func logSearchStopped(ctx context.Context, report *jsonReport) {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		log.Println("Construct search timed out (-timeout) - reporting the best found so far")
+		report.setStoppedEarly("timeout")
+	case context.Canceled:
+		log.Println("Construct search interrupted - reporting the best found so far")
+		report.setStoppedEarly("interrupted")
+	}
+}
+
+// searchExhaustive runs the exhaustive construct search from the greedy construct (if any), reports the greedy
+// construct's optimality gap, and returns the best construct found
+func searchExhaustive(goodKmers *kmerTable, greedy []*construct, params searchParams, maxNodes int, report *jsonReport) []*construct {
+	log.Println("Searching the target kmer graph exhaustively...")
+	var incumbent *construct
+	if len(greedy) > 0 {
+		incumbent = greedy[0]
+	}
+	sb, err := exhaustiveConstruct(goodKmers, incumbent, params, maxNodes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !sb.complete {
+		log.Printf("Exhaustive search stopped after %s nodes - increase -maxNodes to prove the best construct optimal", intWithCommas(sb.nodes))
+	}
+	outputSearchBound(incumbent, sb)
+	report.setSearch(incumbent, sb)
+	if sb.best == nil {
+		return nil
+	}
+	return []*construct{sb.best}
+}
+
+// refineSelected refines the greedy construct by simulated annealing and reports the change in score
+func refineSelected(goodKmers *kmerTable, kmerCts []float64, ref []*HeaderRef, greedy *construct, params searchParams, opts *options, report *jsonReport) *construct {
+	sched := annealSchedule{t0: opts.refineT0, t1: opts.refineT1, budget: opts.refineTime, steps: opts.refineSteps}
+	log.Printf("Refining the construct by simulated annealing (temperature %g to %g)...", sched.t0, sched.t1)
+	refined, stats := refineConstruct(goodKmers, kmerCts, ref, greedy, params, sched)
+	fmt.Printf("\nRefinement: objective score %.1f -> %.1f (%s steps, %s accepted, %s improvements)\n", stats.initial,
+		refined.score, intWithCommas(stats.steps), intWithCommas(stats.accepted), intWithCommas(stats.improved))
+	report.setRefinement(stats, refined.score)
+	return refined
+}
+
+// writeJSONReport writes the -json results, if requested
+func writeJSONReport(report *jsonReport, fileName string) {
+	if report == nil {
+		return
+	}
+	if err := report.write(fileName); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("JSON results written to", fileName)
+}
+
+// reportConstruct outputs the requested T7 primers and hairpin cassette for construct i of n
+func reportConstruct(seq string, i int, n int, ref []*HeaderRef, opts *options, policy otPolicy) {
+	reportPrimers(seq, ref, opts)
+	reportHairpin(seq, i, n, opts, policy)
+}
+
+// reportHairpin writes the hairpin cassette of construct i of n, if requested, after checking the spacer and its
+// junctions with the arms for off-target kmers.  A cassette with off-target kmers is an error, unless allowed with
+// -hairpinAllowOffTargets.
+func reportHairpin(seq string, i int, n int, opts *options, policy otPolicy) {
+	if opts.hairpin == "" {
+		return
+	}
+	h := assembleHairpin(seq, opts.spacerSeq)
+	fmt.Printf("\nHairpin cassette - %d nt (sense arm 1-%d, spacer %d-%d, antisense arm %d-%d)\n", len(h.seq), h.senseLen,
+		h.senseLen+1, h.senseLen+h.spacerLen, h.senseLen+h.spacerLen+1, len(h.seq))
+	if opts.otRefFiles != "" || opts.otKmerFile != "" {
+		region, offset := h.newKmerRegion(opts.kmerLength)
+		regionHits, _, err := offTargetKmerHits([]string{region}, opts, policy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hits := regionHits[0]
+		for j := range hits {
+			hits[j].pos += offset
+		}
+		fmt.Print("Spacer and junction kmers - ")
+		outputOffTargetHits(hits, region, opts.kmerLength)
+		switch {
+		case len(hits) > 0 && !opts.hairpinOT:
+			log.Fatalf("Error: the hairpin spacer and its junctions add %d kmer(s) matching an off-target - not writing the cassette. Try another -spacer, or -hairpinAllowOffTargets to write it anyway", len(hits))
+		case len(hits) > 0:
+			log.Printf("Warning: the hairpin spacer and its junctions add %d kmer(s) matching an off-target (-hairpinAllowOffTargets)", len(hits))
+		}
+	}
+	name := "dsRNAmax_hairpin"
+	if n > 1 {
+		name += "_" + strconv.Itoa(i+1)
+	}
+	fastaFile := numberedFileName(opts.hairpin+".fa", i, n)
+	genBankFile := numberedFileName(opts.hairpin+".gb", i, n)
+	if err := writeHairpinFasta(fastaFile, name, h); err != nil {
+		log.Fatal(err)
+	}
+	if err := writeHairpinGenBank(genBankFile, name, h); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Hairpin cassette written to", fastaFile, "and", genBankFile)
+}
+
+// reportPrimers designs and outputs T7 primers for a construct, if requested
+func reportPrimers(seq string, ref []*HeaderRef, opts *options) {
+	if !opts.primers {
+		return
+	}
+	var target *HeaderRef
+	if opts.primerTarget != "" {
+		target = findTarget(ref, opts.primerTarget)
+	}
+	primers, err := designT7Primers(seq, target, opts.primerTm)
+	if err != nil {
+		log.Printf("Could not design T7 primers: %v", err)
+		return
+	}
+	outputPrimers(primers)
 }
 
-func removeOffTargetKmersFromFasta(files []string, goodKmers map[string][]int, kmerLength int, otKmerLength int) {
-	ConcurrentlyProcessSequences(files, goodKmers, kmerLength, otKmerLength)
+// findTarget returns the first target sequence with the given header, or nil if there is none
+func findTarget(ref []*HeaderRef, header string) *HeaderRef {
+	for _, hr := range ref {
+		if hr.Header == header {
+			return hr
+		}
+	}
+	return nil
 }
 
-func removeOffTargetKmersFromFile(goodKmers map[string][]int, otKmerFile string, kmerLength int) error {
-	return removeOffTargetKmersFromGoodKmers(goodKmers, otKmerFile, kmerLength)
+// offTargetPolicy validates the off-target options and returns the off-target matching policy they describe
+func offTargetPolicy(opts *options) (otPolicy, error) {
+	if opts.otRefFiles != "" && opts.otKmerFile != "" {
+		return otPolicy{}, errors.New("error: both off-target FASTA files and an off-target kmer file specified. Please specify only one")
+	}
+	if opts.otKmerLength > opts.kmerLength && opts.otKmerFile == "" {
+		return otPolicy{}, fmt.Errorf("off-target kmer length (%d) must be <= kmer length (%d)", opts.otKmerLength, opts.kmerLength)
+	}
+	if opts.otMismatches < 0 || opts.otMismatches > maxOTMismatches {
+		return otPolicy{}, fmt.Errorf("off-target mismatches (%d) must be between 0 and %d", opts.otMismatches, maxOTMismatches)
+	}
+	if opts.otMismatches > 0 && opts.otKmerFile != "" {
+		return otPolicy{}, errors.New("error: mismatch-tolerant off-target screening (-otMismatches) is only supported for off-target FASTA files")
+	}
+	if opts.otWobble && opts.otKmerFile != "" {
+		return otPolicy{}, errors.New("error: G:U wobble off-target matching (-otWobble) is only supported for off-target FASTA files")
+	}
+	if opts.otWobble && opts.otMismatches > 0 {
+		return otPolicy{}, errors.New("error: -otWobble and -otMismatches cannot be combined")
+	}
+	if opts.otWobble && opts.otPolicy == "seed" {
+		// Seed regions are matched in guide orientation, but wobble pairs are judged on target-strand kmers
+		return otPolicy{}, errors.New("error: -otWobble and -otPolicy seed cannot be combined")
+	}
+
+	policy := otPolicy{kmerLen: opts.otKmerLength, maxMismatches: opts.otMismatches, wobble: opts.otWobble}
+	switch opts.otPolicy {
+	case "full":
+	case "seed":
+		if err := validateSeedRegion(opts.kmerLength, opts.otSeedExtra); err != nil {
+			return otPolicy{}, err
+		}
+		if opts.otKmerLenSet && opts.otRefFiles != "" {
+			// Seed regions are matched whole against off-target FASTA files, whatever the off-target kmer length
+			return otPolicy{}, errors.New("error: -otKmerLen doesn't apply to -otPolicy seed with off-target FASTA files - set the seed match length with -otSeedExtra")
+		}
+		policy.seedOnly = true
+		policy.seedExtra = opts.otSeedExtra
+	default:
+		return otPolicy{}, fmt.Errorf("unknown off-target policy '%s' - must be 'full' or 'seed'", opts.otPolicy)
+	}
+
+	if _, matchLen := policy.matchKmers(nil, opts.kmerLength); opts.otWobble && matchLen > maxWobbleKmerLen {
+		return otPolicy{}, fmt.Errorf("off-target match length (%d) must be <= %d for G:U wobble off-target matching", matchLen, maxWobbleKmerLen)
+	}
+
+	if opts.otRefFiles != "" {
+		for _, file := range strings.Split(opts.otRefFiles, ",") {
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				return otPolicy{}, fmt.Errorf("off-target FASTA file does not exist: %s", file)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// removeOffTargets removes kmers matching the run's off-target FASTA files or kmer file (if any) from the table.  Each match
+// is added to rec for the off-target report (nil if not reporting).
+func removeOffTargets(kmers *kmerTable, opts *options, policy otPolicy, rec *otRecorder) error {
+	if opts.otRefFiles != "" {
+		removeOffTargetKmersFromFasta(strings.Split(opts.otRefFiles, ","), kmers, opts.kmerLength, policy, rec)
+	}
+	if opts.otKmerFile != "" {
+		return removeOffTargetKmersFromFile(kmers, opts.otKmerFile, opts.kmerLength, policy, rec)
+	}
+	return nil
+}
+
+func removeOffTargetKmersFromFasta(files []string, goodKmers *kmerTable, kmerLength int, policy otPolicy, rec *otRecorder) {
+	ConcurrentlyProcessSequences(files, goodKmers, kmerLength, policy, rec)
+}
+
+func removeOffTargetKmersFromFile(goodKmers *kmerTable, otKmerFile string, kmerLength int, policy otPolicy, rec *otRecorder) error {
+	var before []string
+	if rec != nil {
+		before = goodKmers.kmers()
+	}
+	var err error
+	if policy.seedOnly {
+		err = removeOffTargetSeedKmersFromGoodKmers(goodKmers, otKmerFile, policy.seedExtra)
+	} else {
+		err = removeOffTargetKmersFromGoodKmers(goodKmers, otKmerFile, kmerLength)
+	}
+	if err == nil && rec != nil {
+		rec.recordRemovedKmers(before, goodKmers, otKmerFile)
+	}
+	return err
 }
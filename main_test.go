@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
 	"fmt"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestRefLoad(t *testing.T) {
@@ -40,6 +48,83 @@ func TestRefLoad(t *testing.T) {
 	}
 }
 
+func TestRefLoadFastq(t *testing.T) {
+	want := []*HeaderRef{
+		{"read_1 sample", "ACGTACGT", "ACGTACGT"},
+		{"read_2", "GGGGCCCC", "GGGGCCCC"},
+	}
+	if got := RefLoad("./testData/testRef.fq"); !reflect.DeepEqual(got, want) {
+		t.Errorf("RefLoad() = %v, want %v", got, want)
+	}
+}
+
+// TestRefLoadCompressed checks that gzip and zstd compressed FASTA files are detected and decompressed
+func TestRefLoadCompressed(t *testing.T) {
+	content, err := os.ReadFile("./testData/testRef.fa")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	want := RefLoad("./testData/testRef.fa")
+
+	var gzBuf bytes.Buffer
+	gz := gzip.NewWriter(&gzBuf)
+	gz.Write(content)
+	gz.Close()
+
+	var zstdBuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zstdBuf)
+	zw.Write(content)
+	zw.Close()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "gzip", data: gzBuf.Bytes()},
+		{name: "zstd", data: zstdBuf.Bytes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "ref.fa."+tt.name)
+			if err := os.WriteFile(fileName, tt.data, 0644); err != nil {
+				t.Fatalf("Failed to write temp file: %v", err)
+			}
+			if got := RefLoad(fileName); !reflect.DeepEqual(got, want) {
+				t.Errorf("RefLoad() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_readSeqRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "fasta", input: ">a\nAC\ngt\n>b\n", want: []string{"a", "ACGT", "b", ""}},
+		{name: "fastaCRLF", input: ">a\r\nAC\r\n", want: []string{"a", "AC"}},
+		{name: "fastq", input: "\n@a\nACGT\n+\n@@@@\n", want: []string{"a", "ACGT"}},
+		{name: "truncatedFastq", input: "@a\nACGT\n+\n", want: nil, wantErr: true},
+		{name: "malformedFastq", input: "@a\nACGT\nIIII\n", want: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := readSeqRecords(strings.NewReader(tt.input), func(header string, seq string) {
+				got = append(got, header, seq)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readSeqRecords() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readSeqRecords() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_reverseComplement(t *testing.T) {
 	type args struct {
 		seq string
@@ -79,9 +164,10 @@ func Test_getKmers(t *testing.T) {
 		nt  int
 	}
 	tests := []struct {
-		name string
-		args args
-		want map[string][]int
+		name    string
+		args    args
+		want    map[string][]int
+		wantErr bool
 	}{
 		{
 			name: "getKmersSuccess",
@@ -91,11 +177,42 @@ func Test_getKmers(t *testing.T) {
 			},
 			want: map[string][]int{"ACGT": {1, 1}, "CGTA": {1, 0}},
 		},
+		{
+			name: "getKmersLong",
+			args: args{
+				ref: []*HeaderRef{{"test", strings.Repeat("ACGT", 9), ""}},
+				nt:  33,
+			},
+			want: map[string][]int{
+				strings.Repeat("ACGT", 8) + "A": {1}, "C" + strings.Repeat("GTAC", 8): {1},
+				"GT" + strings.Repeat("ACGT", 7) + "ACG": {1}, "T" + strings.Repeat("ACGT", 8): {1},
+			},
+		},
+		{
+			name: "getKmersNonACGT",
+			args: args{
+				ref: []*HeaderRef{{"test", "ACGTA", "TACGT"}, {"test2", "ACNTACGTNA", ""}},
+				nt:  4,
+			},
+			want: map[string][]int{"ACGT": {1, 1}, "CGTA": {1, 0}, "TACG": {0, 1}},
+		},
+		{
+			name: "getKmersTooLong",
+			args: args{
+				ref: []*HeaderRef{{"test", strings.Repeat("A", 70), ""}},
+				nt:  maxPackedKmerLen + 1,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := getKmers(tt.args.ref, tt.args.nt); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("getKmers() = %v, want %v", got, tt.want)
+			got, err := getKmers(tt.args.ref, tt.args.nt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getKmers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(tablePresence(got), tt.want) {
+				t.Errorf("getKmers() = %v, want %v", tablePresence(got), tt.want)
 			}
 		})
 	}
@@ -124,7 +241,7 @@ func Test_conGetOTKmers(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := conGetOTKmers(tt.args.kmers, tt.args.otRef, tt.args.kmerLen); !reflect.DeepEqual(got, tt.want) {
+			if got := conGetOTKmers(testKmerTable(tt.args.kmers), tt.args.otRef, tt.args.kmerLen); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("conGetOTKmers() = %v, want %v", got, tt.want)
 			}
 		})
@@ -144,17 +261,18 @@ func Test_removeOTKmers(t *testing.T) {
 		{
 			name: "removeKmerSuccess",
 			args: args{
-				kmers:   map[string][]int{"ACGT": {1, 1}, "CGTA": {1, 0}, "GTC": {0, 1}, "AATC": {1, 1}},
-				otKmers: map[string]struct{}{"ACGT": {}, "CGTA": {}, "GTC": {}},
+				kmers:   map[string][]int{"ACGT": {1, 1}, "CGTA": {1, 0}, "GTCA": {0, 1}, "AATC": {1, 1}},
+				otKmers: map[string]struct{}{"ACGT": {}, "CGTA": {}, "GTCA": {}, "TTTT": {}},
 			},
 			want: map[string][]int{"AATC": {1, 1}},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			removeOTKmers(tt.args.kmers, tt.args.otKmers)
-			if !reflect.DeepEqual(tt.args.kmers, tt.want) {
-				t.Errorf("removeOTKmers() got = %v, want %v", tt.args.kmers, tt.want)
+			kmers := testKmerTable(tt.args.kmers)
+			removeOTKmers(kmers, tt.args.otKmers)
+			if got := tablePresence(kmers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removeOTKmers() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -162,24 +280,34 @@ func Test_removeOTKmers(t *testing.T) {
 
 func Test_kmerAbun(t *testing.T) {
 	type args struct {
-		kmers map[string][]int
+		kmers   map[string][]int
+		weights []float64
 	}
 	tests := []struct {
 		name string
 		args args
-		want map[string]int
+		want map[string]float64
 	}{
 		{
 			name: "kmerAbunSuccess",
 			args: args{
 				kmers: map[string][]int{"ACGT": {1, 1}, "CGTA": {1, 0}, "AATC": {1, 1}},
 			},
-			want: map[string]int{"ACGT": 2, "CGTA": 1, "AATC": 2},
+			want: map[string]float64{"ACGT": 2, "CGTA": 1, "AATC": 2},
+		},
+		{
+			name: "kmerAbunWeighted",
+			args: args{
+				kmers:   map[string][]int{"ACGT": {1, 1}, "CGTA": {1, 0}, "AATC": {0, 1}},
+				weights: []float64{2.5, 0.5},
+			},
+			want: map[string]float64{"ACGT": 3, "CGTA": 2.5, "AATC": 0.5},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := kmerAbun(tt.args.kmers); !reflect.DeepEqual(got, tt.want) {
+			kmers := testKmerTable(tt.args.kmers)
+			if got := rowValues(kmers, kmerAbun(kmers, tt.args.weights)); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("kmerAbun() = %v, want %v", got, tt.want)
 			}
 		})
@@ -189,11 +317,12 @@ func Test_kmerAbun(t *testing.T) {
 func Test_conBestConstruct(t *testing.T) {
 	type args struct {
 		goodKmers    map[string][]int
-		kmerCts      map[string]int
+		kmerCts      map[string]float64
 		kmerLen      int
 		seqLen       int
 		constructLen int
 		iterations   int
+		seed         int64
 	}
 	tests := []struct {
 		name string
@@ -204,24 +333,188 @@ func Test_conBestConstruct(t *testing.T) {
 			name: "conBestConstructSuccess",
 			args: args{
 				goodKmers:    map[string][]int{"ACGT": {1, 1}, "CGTA": {1, 1}, "GTAC": {1, 0}},
-				kmerCts:      map[string]int{"ACGT": 2, "CGTA": 2, "GTAC": 1},
+				kmerCts:      map[string]float64{"ACGT": 2, "CGTA": 2, "GTAC": 1},
 				kmerLen:      4,
 				seqLen:       2,
 				constructLen: 5,
 				iterations:   2,
+				seed:         1,
 			},
 			want: &construct{[]int{2, 2}, 2.0, "ACGTA"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := conBestConstruct(tt.args.goodKmers, tt.args.kmerCts, tt.args.kmerLen, tt.args.seqLen, tt.args.constructLen, tt.args.iterations); !reflect.DeepEqual(got, tt.want) {
+			goodKmers := testKmerTable(tt.args.goodKmers)
+			if got := conBestConstruct(goodKmers, kmerValues(goodKmers, tt.args.kmerCts), searchParams{kmerLen: tt.args.kmerLen, seqLen: tt.args.seqLen, constructLen: tt.args.constructLen, iterations: tt.args.iterations, seed: tt.args.seed}); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("conBestConstruct() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+// TestConBestConstructSeeded checks the same seed always gives the same construct
+func TestConBestConstructSeeded(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	var ref []*HeaderRef
+	for i := 0; i < 3; i++ {
+		seq := make([]byte, 400)
+		for j := range seq {
+			seq[j] = "ACGT"[r.Intn(4)]
+		}
+		ref = append(ref, &HeaderRef{fmt.Sprint(i), string(seq), reverseComplement(string(seq))})
+	}
+	goodKmers, _ := getKmers(ref, 9)
+	kmerCts := kmerAbun(goodKmers, nil)
+
+	params := searchParams{kmerLen: 9, seqLen: len(ref), constructLen: 100, iterations: 50, seed: 7}
+	first := conBestConstruct(goodKmers, kmerCts, params)
+	for i := 0; i < 5; i++ {
+		if got := conBestConstruct(goodKmers, kmerCts, params); !reflect.DeepEqual(got, first) {
+			t.Fatalf("conBestConstruct() = %v, want %v", got, first)
+		}
+	}
+}
+
+// TestLaunchIterations checks the worker pool runs each iteration once, and none once the search is cancelled
+func TestLaunchIterations(t *testing.T) {
+	ref := []*HeaderRef{{Header: "a", Seq: "ACGTTGCATGTCGCATGATGCATGAGAGCT"}, {Header: "b", Seq: "ACGTTGCATGTCGCATCATGCATGAGAGCT"}}
+	goodKmers, _ := getKmers(ref, 5)
+	kmerCts := kmerAbun(goodKmers, nil)
+	params := searchParams{kmerLen: 5, seqLen: len(ref), constructLen: 12, iterations: 3, seed: 1}
+	n := 0
+	for range launchIterations(goodKmers, kmerCts, params) {
+		n++
+	}
+	if n != params.iterations {
+		t.Errorf("launchIterations() sent %d constructs, want %d", n, params.iterations)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	params.ctx = ctx
+	params.iterations = 1000
+	if got := conBestConstruct(goodKmers, kmerCts, params); got != nil {
+		t.Errorf("conBestConstruct() = %v once cancelled, want nil", got)
+	}
+}
+
+func Test_compileConsSeqs(t *testing.T) {
+	tests := []struct {
+		name       string
+		constructs []*construct
+		want       *construct
+	}{
+		{
+			name:       "highestScore",
+			constructs: []*construct{{[]int{1}, 1.0, "TTT"}, {[]int{2}, 2.0, "GGG"}},
+			want:       &construct{[]int{2}, 2.0, "GGG"},
+		},
+		{
+			name:       "tieBrokenBySequence",
+			constructs: []*construct{{[]int{2}, 2.0, "TTT"}, {[]int{2}, 2.0, "CCC"}, {[]int{2}, 2.0, "GGG"}},
+			want:       &construct{[]int{2}, 2.0, "CCC"},
+		},
+		{
+			name:       "noHits",
+			constructs: []*construct{{[]int{0}, 0.0, "TTT"}},
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consSeqsChan := make(chan *construct, len(tt.constructs))
+			for _, c := range tt.constructs {
+				consSeqsChan <- c
+			}
+			close(consSeqsChan)
+			if got := compileConsSeqs(consSeqsChan, nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compileConsSeqs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compileTopConsSeqs(t *testing.T) {
+	constructs := []*construct{
+		{[]int{3}, 3.0, "AAAAAAAC"},
+		{[]int{4}, 4.0, "AAAAAAAA"},
+		{[]int{2}, 2.0, "CCGGCCGG"},
+		{[]int{1}, 1.0, "ACGTTGCA"},
+		{[]int{0}, 0.0, "TTTTTTTT"},
+	}
+	tests := []struct {
+		name      string
+		n         int
+		maxShared float64
+		want      []string
+	}{
+		{name: "best", n: 1, maxShared: 0.2, want: []string{"AAAAAAAA"}},
+		{name: "skipRedundant", n: 2, maxShared: 0.2, want: []string{"AAAAAAAA", "CCGGCCGG"}},
+		{name: "allowRedundant", n: 2, maxShared: 1.0, want: []string{"AAAAAAAA", "AAAAAAAC"}},
+		{name: "fewerThanRequested", n: 10, maxShared: 0.2, want: []string{"AAAAAAAA", "CCGGCCGG", "ACGTTGCA"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consSeqsChan := make(chan *construct, len(constructs))
+			for _, c := range constructs {
+				consSeqsChan <- c
+			}
+			close(consSeqsChan)
+			var got []string
+			for _, c := range compileTopConsSeqs(consSeqsChan, tt.n, tt.maxShared, 4, nil) {
+				got = append(got, c.seq)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compileTopConsSeqs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sharedKmerFraction(t *testing.T) {
+	tests := []struct {
+		name  string
+		seq   string
+		other string
+		want  float64
+	}{
+		{name: "identical", seq: "ACGTAC", other: "ACGTAC", want: 1.0},
+		{name: "reverseComplement", seq: "AAACCC", other: "GGGTTT", want: 1.0},
+		{name: "partial", seq: "AAAACCCC", other: "AAAAGGGG", want: 0.4}, // AAAA and CCCC (reverse complement of GGGG)
+		{name: "none", seq: "AAAAA", other: "CCCCC", want: 0.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sharedKmerFraction(tt.seq, constructKmerSet(tt.other, 4), 4); got != tt.want {
+				t.Errorf("sharedKmerFraction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_numberedFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		i        int
+		total    int
+		want     string
+	}{
+		{name: "single", fileName: "out.csv", i: 0, total: 1, want: "out.csv"},
+		{name: "multiple", fileName: "out.csv", i: 1, total: 3, want: "out_2.csv"},
+		{name: "noExtension", fileName: "out", i: 0, total: 2, want: "out_1"},
+		{name: "empty", fileName: "", i: 0, total: 2, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := numberedFileName(tt.fileName, tt.i, tt.total); got != tt.want {
+				t.Errorf("numberedFileName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_mean(t *testing.T) {
 	type args struct {
 		input []int
@@ -308,9 +601,10 @@ func TestRemoveMappedLongOTKmers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			removeMappedLongOTKmers(tt.goodKmers, tt.otKmers)
-			if !reflect.DeepEqual(tt.goodKmers, tt.expected) {
-				t.Errorf("removeMappedLongOTKmers() got = %v, want %v", tt.goodKmers, tt.expected)
+			goodKmers := testKmerTable(tt.goodKmers)
+			removeMappedLongOTKmers(goodKmers, tt.otKmers)
+			if got := tablePresence(goodKmers); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("removeMappedLongOTKmers() got = %v, want %v", got, tt.expected)
 			}
 		})
 	}
@@ -334,12 +628,12 @@ func TestLoadAndSendSeqs(t *testing.T) {
 	tmpFile.Close()
 
 	// Set up the channel and waitgroup
-	seqChan := make(chan string) // unbuffered channel
+	seqChan := make(chan seqRecord) // unbuffered channel
 	var wg sync.WaitGroup
 	wg.Add(1)
 
 	// Invoke LoadAndSendSeqs in a goroutine
-	go LoadAndSendSeqs(tmpFile.Name(), seqChan, &wg)
+	go LoadAndSendSeqs(tmpFile.Name(), seqChan, &wg, nil)
 
 	// Prepare a set to track received sequences
 	receivedSeqs := make(map[string]struct{})
@@ -351,8 +645,8 @@ func TestLoadAndSendSeqs(t *testing.T) {
 	}()
 
 	// Collect sequences from the channel
-	for seq := range seqChan {
-		receivedSeqs[seq] = struct{}{}
+	for record := range seqChan {
+		receivedSeqs[record.seq] = struct{}{}
 	}
 
 	// Define the expected sequences as a set
@@ -379,10 +673,10 @@ func TestLoadAndSendSeqs(t *testing.T) {
 // mock data for testing
 
 // Mock LoadAndSendSeqs to preload sequences instead of reading from a file
-func MockLoadAndSendSeqs(preloadedSequences []string, seqChan chan<- string, wg *sync.WaitGroup) {
+func MockLoadAndSendSeqs(preloadedSequences []string, seqChan chan<- seqRecord, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for _, seq := range preloadedSequences {
-		seqChan <- seq
+		seqChan <- seqRecord{seq: seq}
 	}
 }
 
@@ -403,17 +697,17 @@ func createTempFastaFile(sequences []string, t *testing.T) string {
 }
 
 func TestKmerCheckSeqs(t *testing.T) {
-	seqChan := make(chan string, 10)                   // Buffered for sending test sequences without blocking.
+	seqChan := make(chan seqRecord, 10)                // Buffered for sending test sequences without blocking.
 	toDeleteChan := make(chan map[string]struct{}, 10) // Buffered to receive toDelete maps without blocking.
 	wg := &sync.WaitGroup{}
 
 	// Define the goodKmers map with example data.
-	goodKmers := map[string][]int{
+	goodKmers := testKmerTable(map[string][]int{
 		"ATGC": {1},
 		"GCAT": {1}, // reverse complement of ATGC
 		"CGTA": {1},
 		"TTTT": {1},
-	}
+	})
 
 	// Define the input sequences containing the kmers.
 	inputSequences := []string{
@@ -425,11 +719,11 @@ func TestKmerCheckSeqs(t *testing.T) {
 
 	// Start the KmerCheckSeqs in a separate goroutine.
 	wg.Add(1)
-	go KmerCheckSeqs(seqChan, goodKmers, 4, wg, toDeleteChan)
+	go KmerCheckSeqs(seqChan, goodKmers, 4, wg, toDeleteChan, nil)
 
 	// Send the sequences to the channel and close it.
 	for _, seq := range inputSequences {
-		seqChan <- seq
+		seqChan <- seqRecord{seq: seq}
 	}
 	close(seqChan)
 
@@ -440,7 +734,7 @@ func TestKmerCheckSeqs(t *testing.T) {
 	// Process the toDelete maps and update the goodKmers map accordingly.
 	for toDelete := range toDeleteChan {
 		for kmer := range toDelete {
-			delete(goodKmers, kmer)
+			goodKmers.remove(kmer)
 		}
 	}
 
@@ -450,12 +744,12 @@ func TestKmerCheckSeqs(t *testing.T) {
 	}
 	fmt.Println(goodKmers)
 	// Check if the goodKmers map has been updated correctly.
-	if len(goodKmers) != len(expectedGoodKmers) {
-		t.Errorf("KmerCheckSeqs failed: expected %d good kmers, got %d", len(expectedGoodKmers), len(goodKmers))
+	if goodKmers.len() != len(expectedGoodKmers) {
+		t.Errorf("KmerCheckSeqs failed: expected %d good kmers, got %d", len(expectedGoodKmers), goodKmers.len())
 	}
 
 	for kmer, count := range expectedGoodKmers {
-		if actualCount, exists := goodKmers[kmer]; !exists || actualCount[0] != count[0] {
+		if targets := goodKmers.targets(kmer); len(targets) != count[0] {
 			t.Errorf("KmerCheckSeqs failed: kmer '%s' was not processed correctly", kmer)
 		}
 	}
@@ -473,16 +767,16 @@ func TestConcurrentlyProcessSequences(t *testing.T) {
 	refFile := createTempFastaFile(refSequences, t)
 	defer os.Remove(refFile) // clean up
 
-	goodKmers := map[string][]int{
+	goodKmers := testKmerTable(map[string][]int{
 		"ATCG": {1},
 		"GCTA": {1},
-	}
+	})
 
 	kmerLen := 4
 	otKmerLen := 4
 
 	// Act
-	ConcurrentlyProcessSequences([]string{refFile}, goodKmers, kmerLen, otKmerLen)
+	ConcurrentlyProcessSequences([]string{refFile}, goodKmers, kmerLen, otPolicy{kmerLen: otKmerLen}, nil)
 
 	// Assert
 	expectedRemainingKmers := map[string][]int{
@@ -490,12 +784,12 @@ func TestConcurrentlyProcessSequences(t *testing.T) {
 		// if they were present in the input sequences.
 	}
 
-	if len(goodKmers) != len(expectedRemainingKmers) {
-		t.Errorf("got %d goodKmers; want %d", len(goodKmers), len(expectedRemainingKmers))
+	if goodKmers.len() != len(expectedRemainingKmers) {
+		t.Errorf("got %d goodKmers; want %d", goodKmers.len(), len(expectedRemainingKmers))
 	}
 
 	for kmer := range expectedRemainingKmers {
-		if _, exists := goodKmers[kmer]; !exists {
+		if !goodKmers.has(kmer) {
 			t.Errorf("expected kmer %s to be present; it was not", kmer)
 		}
 	}
@@ -505,14 +799,13 @@ func TestConcurrentlyProcessSequences(t *testing.T) {
 func TestGenerateSubKmersMap(t *testing.T) {
 	tests := []struct {
 		name       string
-		goodKmers  map[string][]int // Assuming the type should be map[string]struct{} as per original function
+		goodKmers  []string
 		subKmerLen int
 		want       map[string][]string
 	}{
 		{
-			name: "single k-mer",
-			goodKmers: map[string][]int{
-				"ACGTACGTACGT": {1}}, // Corrected here
+			name:       "single k-mer",
+			goodKmers:  []string{"ACGTACGTACGT"},
 			subKmerLen: 10,
 			want: map[string][]string{
 				"ACGTACGTAC": {"ACGTACGTACGT"},
@@ -521,9 +814,8 @@ func TestGenerateSubKmersMap(t *testing.T) {
 			},
 		},
 		{
-			name: "subKmerLen longer than k-mer",
-			goodKmers: map[string][]int{
-				"ACGT": {1}}, // Assuming this is the intended type
+			name:       "subKmerLen longer than k-mer",
+			goodKmers:  []string{"ACGT"},
 			subKmerLen: 5,
 			want:       map[string][]string{},
 		},
@@ -537,3 +829,81 @@ func TestGenerateSubKmersMap(t *testing.T) {
 		})
 	}
 }
+
+func Test_setCommonDefaults(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "none"},
+		{[]string{"-siRNAWeight"}, "reynolds"},
+		{[]string{"-siRNAWeight", "-siRNAScore", "uitei"}, "uitei"},
+		{[]string{"-siRNAScore", "uitei"}, "uitei"},
+	}
+	for _, tt := range tests {
+		opts := &options{}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addCommonFlags(fs, opts)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		setCommonDefaults(fs, opts)
+		if opts.siRNAScore != tt.want {
+			t.Errorf("setCommonDefaults(%v) siRNAScore = %s, want %s", tt.args, opts.siRNAScore, tt.want)
+		}
+		if opts.otKmerLenSet {
+			t.Errorf("setCommonDefaults(%v) otKmerLenSet = true, want false", tt.args)
+		}
+	}
+
+	opts := &options{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	addCommonFlags(fs, opts)
+	if err := fs.Parse([]string{"-otKmerLen", "21"}); err != nil {
+		t.Fatal(err)
+	}
+	if setCommonDefaults(fs, opts); !opts.otKmerLenSet {
+		t.Error("setCommonDefaults(-otKmerLen 21) otKmerLenSet = false, want true")
+	}
+}
+
+func Test_isFlagSet(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var seed int64
+	fs.Int64Var(&seed, "seed", 0, "")
+	if err := fs.Parse(nil); err != nil || isFlagSet(fs, "seed") {
+		t.Errorf("isFlagSet() = true with no -seed, want false")
+	}
+	if err := fs.Parse([]string{"-seed", "0"}); err != nil || !isFlagSet(fs, "seed") {
+		t.Errorf("isFlagSet() = false with -seed 0, want true")
+	}
+}
+
+func Test_offTargetPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    options
+		want    otPolicy
+		wantErr bool
+	}{
+		{"full", options{kmerLength: 21, otKmerLength: 21, otPolicy: "full"}, otPolicy{kmerLen: 21}, false},
+		{"seed", options{kmerLength: 21, otKmerLength: 21, otPolicy: "seed", otSeedExtra: 4}, otPolicy{kmerLen: 21, seedOnly: true, seedExtra: 4}, false},
+		{"wobble", options{kmerLength: 21, otKmerLength: 21, otPolicy: "full", otWobble: true}, otPolicy{kmerLen: 21, wobble: true}, false},
+		{"wobble seed", options{kmerLength: 21, otKmerLength: 21, otPolicy: "seed", otSeedExtra: 4, otWobble: true}, otPolicy{}, true},
+		{"wobble mismatches", options{kmerLength: 21, otKmerLength: 21, otPolicy: "full", otWobble: true, otMismatches: 1}, otPolicy{}, true},
+		{"seed otKmerLen", options{otRefFiles: "ot.fa", kmerLength: 21, otKmerLength: 11, otKmerLenSet: true, otPolicy: "seed", otSeedExtra: 4}, otPolicy{}, true},
+		{"seed otKmerLen kmer file", options{otKmerFile: "ot.kmer", kmerLength: 21, otKmerLength: 11, otKmerLenSet: true, otPolicy: "seed", otSeedExtra: 4}, otPolicy{kmerLen: 11, seedOnly: true, seedExtra: 4}, false},
+		{"unknown policy", options{kmerLength: 21, otKmerLength: 21, otPolicy: "partial"}, otPolicy{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := offTargetPolicy(&tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("offTargetPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("offTargetPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sync"
+)
+
+// maxOTMismatches is the largest Hamming distance supported for mismatch-tolerant off-target screening
+const maxOTMismatches = 2
+
+// seedIndex is a pigeonhole index of target (sub)kmers for mismatch-tolerant off-target screening.
+// Each indexed kmer is split into maxMismatches+1 segments.  Any off-target kmer within maxMismatches
+// of an indexed kmer must match it exactly in at least one segment, so only kmers sharing a segment
+// with the off-target kmer need to be compared base-by-base.
+type seedIndex struct {
+	kmers         []string           // indexed (sub)kmers
+	longKmers     [][]string         // target kmers containing each indexed (sub)kmer
+	segStarts     []int              // start position of each segment, plus the kmer length
+	seeds         []map[string][]int // for each segment, segment sequence -> ids of indexed kmers
+	maxMismatches int
+}
+
+// newSeedIndex builds a seedIndex from a map of sub-kmers to the target kmers containing them (see GenerateSubKmersMap).
+//
+// Args:
+//
+//	subKmers: A map where keys are sub-kmers and values are lists of the original kmers containing them.
+//	subKmerLen: The length of the sub-kmers.
+//	maxMismatches: The maximum Hamming distance for an off-target match.
+//
+// Returns:
+//
+//	A pointer to the populated seedIndex.
+func newSeedIndex(subKmers map[string][]string, subKmerLen int, maxMismatches int) *seedIndex {
+	nSegs := maxMismatches + 1
+	idx := &seedIndex{
+		seeds:         make([]map[string][]int, nSegs),
+		maxMismatches: maxMismatches,
+	}
+	for s := 0; s <= nSegs; s++ {
+		idx.segStarts = append(idx.segStarts, s*subKmerLen/nSegs)
+	}
+	for s := range idx.seeds {
+		idx.seeds[s] = make(map[string][]int)
+	}
+	for subKmer, longKmers := range subKmers {
+		id := len(idx.kmers)
+		idx.kmers = append(idx.kmers, subKmer)
+		idx.longKmers = append(idx.longKmers, longKmers)
+		for s := 0; s < nSegs; s++ {
+			seg := subKmer[idx.segStarts[s]:idx.segStarts[s+1]]
+			idx.seeds[s][seg] = append(idx.seeds[s][seg], id)
+		}
+	}
+	return idx
+}
+
+// lookup adds the ids of all indexed kmers within maxMismatches of the query kmer to found.
+// The query must be the same length as the indexed kmers.
+func (idx *seedIndex) lookup(query string, found map[int]struct{}) {
+	for s := 0; s < len(idx.seeds); s++ {
+		for _, id := range idx.seeds[s][query[idx.segStarts[s]:idx.segStarts[s+1]]] {
+			if _, ok := found[id]; ok {
+				continue
+			}
+			if withinHamming(query, idx.kmers[id], idx.maxMismatches) {
+				found[id] = struct{}{}
+			}
+		}
+	}
+}
+
+// withinHamming reports whether two equal-length sequences differ at no more than maxMismatches positions
+func withinHamming(a string, b string, maxMismatches int) bool {
+	mismatches := 0
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			mismatches++
+			if mismatches > maxMismatches {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mismatchKmerCheckSeqs scans off-target sequences (and their reverse complements) for kmers within the seed index's
+// mismatch tolerance of a target (sub)kmer.  The ids of matched indexed kmers are sent through a channel.
+//
+// Args:
+//
+//	seqChan: A channel receiving off-target sequence records.
+//	idx: The seedIndex of target (sub)kmers.
+//	wg: A WaitGroup for synchronization with the main process.
+//	toDeleteChan: A channel for sending the set of matched seed index ids.
+//	rec: Collects each match for the off-target report (nil if not reporting).
+func mismatchKmerCheckSeqs(seqChan <-chan seqRecord, idx *seedIndex, wg *sync.WaitGroup, toDeleteChan chan<- map[int]struct{}, rec *otRecorder) {
+	defer wg.Done()
+
+	toDelete := make(map[int]struct{}) // Temporary set to store matched seed index ids
+	kmerLen := idx.segStarts[len(idx.segStarts)-1]
+	var hits []otHit
+	found := toDelete
+	if rec != nil {
+		// Matches are looked up per position, into a set reused at each, so each can be reported
+		found = make(map[int]struct{})
+	}
+
+	for record := range seqChan {
+		// Compute the reverse complement of the entire sequence once
+		rcSeq := reverseComplement(record.seq)
+
+		// Iterate over the original sequence and the reverse complement
+		for strand, s := range []string{record.seq, rcSeq} {
+			for pos := 0; pos <= len(s)-kmerLen; pos++ {
+				idx.lookup(s[pos:pos+kmerLen], found)
+				if rec == nil || len(found) == 0 {
+					continue
+				}
+				for id := range found {
+					toDelete[id] = struct{}{}
+					for _, longKmer := range idx.longKmers[id] {
+						hits = append(hits, newOTHit(longKmer, s[pos:pos+kmerLen], record, strand, pos))
+					}
+					delete(found, id)
+				}
+			}
+		}
+	}
+
+	// Send the toDelete map to the channel
+	rec.add(hits)
+	toDeleteChan <- toDelete
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_withinHamming(t *testing.T) {
+	tests := []struct {
+		name          string
+		a             string
+		b             string
+		maxMismatches int
+		want          bool
+	}{
+		{name: "identical", a: "ACGTACGT", b: "ACGTACGT", maxMismatches: 0, want: true},
+		{name: "oneMismatch", a: "ACGTACGT", b: "ACGAACGT", maxMismatches: 1, want: true},
+		{name: "twoMismatchesOneAllowed", a: "ACGTACGT", b: "TCGAACGT", maxMismatches: 1, want: false},
+		{name: "twoMismatchesTwoAllowed", a: "ACGTACGT", b: "TCGAACGT", maxMismatches: 2, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinHamming(tt.a, tt.b, tt.maxMismatches); got != tt.want {
+				t.Errorf("withinHamming() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_seedIndexLookup(t *testing.T) {
+	goodKmers := testKmerTable(map[string][]int{
+		"AAAAAAAAA": {1},
+		"CCCCCCCCC": {1},
+		"ACGTACGTA": {1},
+	})
+	tests := []struct {
+		name          string
+		query         string
+		maxMismatches int
+		want          []string
+	}{
+		{name: "exact", query: "CCCCCCCCC", maxMismatches: 1, want: []string{"CCCCCCCCC"}},
+		{name: "oneMismatchEachSegment", query: "ACGTTCGTA", maxMismatches: 1, want: []string{"ACGTACGTA"}},
+		{name: "twoMismatches", query: "TAAAAAAAT", maxMismatches: 2, want: []string{"AAAAAAAAA"}},
+		{name: "tooManyMismatches", query: "TAAAAAAAT", maxMismatches: 1, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newSeedIndex(GenerateSubKmersMap(goodKmers.kmers(), 9), 9, tt.maxMismatches)
+			found := make(map[int]struct{})
+			idx.lookup(tt.query, found)
+			got := []string{}
+			for id := range found {
+				got = append(got, idx.kmers[id])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConcurrentlyProcessSequencesMismatch checks kmers within the mismatch tolerance of an off-target are removed in either orientation
+func TestConcurrentlyProcessSequencesMismatch(t *testing.T) {
+	refFile := createTempFastaFile([]string{
+		">ot1",
+		"TATATACGTTCGTATATAT", // ACGTACGTA with 1 mismatch
+		">ot2",
+		"GCGCGCTTTGTTTTGCGCG", // reverse complement of AAAAAAAAA with 2 mismatches (AAAACAAAG)
+	}, t)
+	defer os.Remove(refFile)
+
+	tests := []struct {
+		name          string
+		subKmerLen    int
+		maxMismatches int
+		want          []string
+	}{
+		{name: "oneMismatch", subKmerLen: 9, maxMismatches: 1, want: []string{"AAAAAAAAAA", "CCCCCCCCCC"}},
+		{name: "twoMismatches", subKmerLen: 9, maxMismatches: 2, want: []string{"CCCCCCCCCC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodKmers := testKmerTable(map[string][]int{
+				"AAAAAAAAAA": {1},
+				"CCCCCCCCCC": {1},
+				"ACGTACGTAC": {1},
+			})
+			ConcurrentlyProcessSequences([]string{refFile}, goodKmers, 10, otPolicy{kmerLen: tt.subKmerLen, maxMismatches: tt.maxMismatches}, nil)
+			if goodKmers.len() != len(tt.want) {
+				t.Errorf("got %d goodKmers; want %d", goodKmers.len(), len(tt.want))
+			}
+			for _, kmer := range tt.want {
+				if !goodKmers.has(kmer) {
+					t.Errorf("expected kmer %s to be present; it was not", kmer)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// objectiveNames lists the supported construct objectives
+var objectiveNames = []string{"median", "geomean", "min", "mean", "weighted"}
+
+// objective scores a construct from the no. of its kmers matching each target sequence.
+// Targets are weighted by weights (nil for a weight of 1 each) - an integer weight counts the target as that many
+// copies of it would, and targets with a weight of 0 are ignored.  The zero value is the unweighted median objective.
+type objective struct {
+	name    string
+	weights []float64 // per-target weights
+	minHits []int     // per-target kmer hits for a target to count as covered ("coverage" objective only)
+}
+
+// newObjective returns the named objective, with optional per-target weights
+func newObjective(name string, weights []float64) (objective, error) {
+	switch name {
+	case "median", "geomean", "min", "mean", "weighted":
+		return objective{name: name, weights: weights}, nil
+	default:
+		return objective{}, fmt.Errorf("unknown objective '%s' - must be one of %s", name, strings.Join(objectiveNames, ", "))
+	}
+}
+
+// String describes the objective for output
+func (o objective) String() string {
+	desc := "Median"
+	switch o.name {
+	case "geomean":
+		desc = "Geometric mean (+1 pseudocount)"
+	case "min":
+		desc = "Minimum"
+	case "mean":
+		desc = "Mean"
+	case "weighted":
+		return "Weighted sum"
+	case "coverage":
+		return "Targets covered"
+	}
+	if o.weights != nil {
+		desc = "Weighted " + strings.ToLower(desc[:1]) + desc[1:]
+	}
+	return desc
+}
+
+// key returns the objective's name as given to -objective, e.g. "geomean"
+func (o objective) key() string {
+	if o.name == "" {
+		return "median"
+	}
+	return o.name
+}
+
+// weight returns the weight of the ith target sequence
+func (o objective) weight(i int) float64 {
+	if o.weights == nil {
+		return 1
+	}
+	return o.weights[i]
+}
+
+// score returns the objective value for the kmer hits to each target sequence.
+// If the slice is empty, its length doesn't match the weights, or all weights are zero, it returns an error.
+func (o objective) score(hits []int) (float64, error) {
+	if o.weights == nil && (o.name == "" || o.name == "median") {
+		return calculateMedian(hits)
+	}
+	floatHits := make([]float64, len(hits))
+	for i, h := range hits {
+		floatHits[i] = float64(h)
+	}
+	return o.scoreHits(floatHits)
+}
+
+// scoreHits returns the objective value for (possibly fractional, e.g. efficacy-weighted) kmer hits to each target
+// sequence.  Errors are as for score.
+func (o objective) scoreHits(hits []float64) (float64, error) {
+	if len(hits) == 0 {
+		return 0, errors.New("slice is empty")
+	}
+	if o.weights != nil && len(o.weights) != len(hits) {
+		return 0, fmt.Errorf("%d target weights for %d target sequences", len(o.weights), len(hits))
+	}
+	totalWeight := 0.0
+	for i := range hits {
+		totalWeight += o.weight(i)
+	}
+	if totalWeight == 0 {
+		return 0, errors.New("all target weights are zero")
+	}
+	switch o.name {
+	case "geomean":
+		// A pseudocount of 1 stops a single target with no hits zeroing every score
+		logSum := 0.0
+		for i, h := range hits {
+			logSum += o.weight(i) * math.Log(h+1)
+		}
+		return math.Exp(logSum/totalWeight) - 1, nil
+	case "coverage":
+		// Total weight of covered targets, with the weighted mean hits (m / (m + 1) < 1) breaking ties
+		if len(o.minHits) != len(hits) {
+			return 0, fmt.Errorf("%d target min. kmer hits for %d target sequences", len(o.minHits), len(hits))
+		}
+		covered, total := 0.0, 0.0
+		for i, h := range hits {
+			if o.weight(i) > 0 && h >= float64(o.minHits[i]) {
+				covered += o.weight(i)
+			}
+			total += o.weight(i) * h
+		}
+		mean := total / totalWeight
+		return covered + mean/(mean+1), nil
+	case "min":
+		lowest := -1.0
+		for i, h := range hits {
+			if o.weight(i) > 0 && (lowest < 0 || h < lowest) {
+				lowest = h
+			}
+		}
+		return lowest, nil
+	case "mean", "weighted":
+		total := 0.0
+		for i, h := range hits {
+			total += o.weight(i) * h
+		}
+		if o.name == "weighted" {
+			return total, nil
+		}
+		return total / totalWeight, nil
+	default:
+		return o.weightedMedian(hits, totalWeight), nil
+	}
+}
+
+// meanFactor returns a factor f where score(hits) <= f * the weighted mean of hits, for any n non-negative hits, or 0
+// if the score has no such bound.  The min. and geometric mean (by AM-GM) never exceed the mean, and at least half the
+// weight has hits >= the median, so the median is at most twice the mean.
+func (o objective) meanFactor(n int) float64 {
+	switch o.name {
+	case "", "median":
+		return 2
+	case "geomean", "min", "mean":
+		return 1
+	case "weighted":
+		totalWeight := 0.0
+		for i := 0; i < n; i++ {
+			totalWeight += o.weight(i)
+		}
+		return totalWeight
+	default:
+		return 0
+	}
+}
+
+// weightedMean returns the mean of hits with each value counted by its target's weight (0 if all weights are zero)
+func (o objective) weightedMean(hits []float64) float64 {
+	total, totalWeight := 0.0, 0.0
+	for i, h := range hits {
+		total += o.weight(i) * h
+		totalWeight += o.weight(i)
+	}
+	if totalWeight == 0 {
+		return 0
+	}
+	return total / totalWeight
+}
+
+// weightedMedian returns the median of hits with each value counted by its target's weight.  As for an unweighted
+// median, the result is the average of the lower and upper weighted medians, so integer weights give the same result
+// as repeating each value weight times.
+func (o objective) weightedMedian(hits []float64, totalWeight float64) float64 {
+	order := make([]int, len(hits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return hits[order[a]] < hits[order[b]] })
+	lower, upper := -1.0, -1.0
+	cumWeight := 0.0
+	for _, i := range order {
+		cumWeight += o.weight(i)
+		if lower < 0 && cumWeight >= totalWeight/2 {
+			lower = hits[i]
+		}
+		if cumWeight > totalWeight/2 {
+			upper = hits[i]
+			break
+		}
+	}
+	return (lower + upper) / 2.0
+}
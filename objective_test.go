@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_objectiveScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     objective
+		hits    []int
+		want    float64
+		wantErr bool
+	}{
+		{name: "defaultMedian", obj: objective{}, hits: []int{0, 0, 10, 10}, want: 5.0},
+		{name: "median", obj: objective{name: "median"}, hits: []int{3, 1, 2}, want: 2.0},
+		{name: "geomean", obj: objective{name: "geomean"}, hits: []int{0, 3}, want: 1.0},
+		{name: "min", obj: objective{name: "min"}, hits: []int{4, 1, 9}, want: 1.0},
+		{name: "mean", obj: objective{name: "mean"}, hits: []int{1, 2, 6}, want: 3.0},
+		{name: "weighted", obj: objective{name: "weighted", weights: []float64{2, 0.5}}, hits: []int{3, 4}, want: 8.0},
+		{name: "unweightedSum", obj: objective{name: "weighted"}, hits: []int{3, 4}, want: 7.0},
+		{name: "weightedMedian", obj: objective{name: "median", weights: []float64{2, 1}}, hits: []int{5, 1}, want: 5.0},
+		{name: "weightedMedianEven", obj: objective{name: "median", weights: []float64{1, 1, 2}}, hits: []int{1, 3, 10}, want: 6.5},
+		{name: "fractionalWeightedMedian", obj: objective{name: "median", weights: []float64{0.4, 0.6}}, hits: []int{1, 9}, want: 9.0},
+		{name: "weightedGeomean", obj: objective{name: "geomean", weights: []float64{1, 0}}, hits: []int{3, 0}, want: 3.0},
+		{name: "weightedMinIgnoresZeroWeight", obj: objective{name: "min", weights: []float64{0, 1}}, hits: []int{0, 4}, want: 4.0},
+		{name: "weightedMean", obj: objective{name: "mean", weights: []float64{3, 1}}, hits: []int{4, 0}, want: 3.0},
+		{name: "coverage", obj: objective{name: "coverage", weights: []float64{1, 2, 0}, minHits: []int{2, 5, 1}}, hits: []int{3, 1, 8}, want: 1.625},
+		{name: "coverageLengthMismatch", obj: objective{name: "coverage", minHits: []int{1}}, hits: []int{3, 4}, wantErr: true},
+		{name: "allZeroWeights", obj: objective{name: "mean", weights: []float64{0, 0}}, hits: []int{4, 0}, wantErr: true},
+		{name: "weightedLengthMismatch", obj: objective{name: "weighted", weights: []float64{1}}, hits: []int{3, 4}, wantErr: true},
+		{name: "empty", obj: objective{name: "mean"}, hits: []int{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.obj.score(tt.hits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("score() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newObjective(t *testing.T) {
+	tests := []struct {
+		name    string
+		objName string
+		weights []float64
+		wantErr bool
+	}{
+		{name: "median", objName: "median", wantErr: false},
+		{name: "weighted", objName: "weighted", weights: []float64{1, 2}, wantErr: false},
+		{name: "weightedNoWeights", objName: "weighted", wantErr: false},
+		{name: "unknown", objName: "max", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newObjective(tt.objName, tt.weights); (err != nil) != tt.wantErr {
+				t.Errorf("newObjective() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Test_bestConstructObjective checks the window is chosen by the objective - with two targets, the median
+// favours the window with the most hits to either target, while min requires hits to both
+func Test_bestConstructObjective(t *testing.T) {
+	goodKmers := testKmerTable(map[string][]int{
+		"AAAA": {1, 0},
+		"AAAC": {1, 0},
+		"AACC": {1, 0},
+		"ACCG": {0, 1},
+		"CCGT": {0, 1},
+	})
+	tests := []struct {
+		name string
+		obj  objective
+		want string
+	}{
+		{name: "median", obj: objective{name: "median"}, want: "AAAAC"},
+		{name: "min", obj: objective{name: "min"}, want: "AACCG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := searchParams{kmerLen: 4, seqLen: 2, constructLen: 5, obj: tt.obj}
+			got, err := bestConstruct(goodKmers, "AAAACCGTT", p)
+			if err != nil {
+				t.Fatalf("bestConstruct() error = %v", err)
+			}
+			if got.seq != tt.want {
+				t.Errorf("bestConstruct() = %v, want %v", got.seq, tt.want)
+			}
+		})
+	}
+}
+
+func Test_objectiveMeanFactor(t *testing.T) {
+	hitSets := [][]float64{{0, 0, 10, 10}, {3, 1, 2}, {0, 50, 50}, {7, 7}, {0, 0, 9}, {1, 100, 100, 100}}
+	for _, obj := range []objective{
+		{}, {name: "median", weights: []float64{1, 3, 0.5, 2}}, {name: "geomean"}, {name: "min", weights: []float64{0, 1, 1, 2}},
+		{name: "mean"}, {name: "weighted", weights: []float64{2, 0.5, 1, 1}},
+	} {
+		for _, hits := range hitSets {
+			o := obj
+			if o.weights != nil {
+				o.weights = o.weights[:len(hits)]
+			}
+			score, err := o.scoreHits(hits)
+			if err != nil {
+				continue
+			}
+			if bound := o.meanFactor(len(hits)) * o.weightedMean(hits); score > bound+1e-9 {
+				t.Errorf("%s objective score %v of %v exceeds its mean bound %v", o, score, hits, bound)
+			}
+		}
+	}
+	if got := (objective{name: "coverage"}).meanFactor(2); got != 0 {
+		t.Errorf("meanFactor() = %v, want 0 for the coverage objective", got)
+	}
+}
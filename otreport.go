@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// seqRecord is a sequence read from an off-target file, with its source for the off-target report
+type seqRecord struct {
+	file   string
+	header string
+	seq    string
+}
+
+// otHit is an off-target match of a target kmer.  Matches from an off-target kmer file have no header, position or strand.
+type otHit struct {
+	kmer   string // target kmer removed by the match
+	match  string // off-target sequence matched (whole kmer, sub-kmer or seed region) on the matching strand
+	file   string
+	header string
+	pos    int  // 1-based start on the forward strand of the off-target record
+	strand byte // '+' or '-'
+}
+
+// newOTHit returns the match of a target kmer to the off-target record at pos of the given strand (0 forward,
+// 1 reverse complement), with the position converted to forward strand coordinates
+func newOTHit(kmer string, match string, record seqRecord, strand int, pos int) otHit {
+	if strand == 0 {
+		return otHit{kmer: kmer, match: match, file: record.file, header: record.header, pos: pos + 1, strand: '+'}
+	}
+	return otHit{kmer: kmer, match: match, file: record.file, header: record.header, pos: len(record.seq) - pos - len(match) + 1, strand: '-'}
+}
+
+// otRecorder collects off-target matches from concurrent workers for the off-target report.  A nil otRecorder
+// discards matches.
+type otRecorder struct {
+	mu   sync.Mutex
+	hits []otHit
+}
+
+// add appends a worker's matches
+func (r *otRecorder) add(hits []otHit) {
+	if r == nil || len(hits) == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.hits = append(r.hits, hits...)
+	r.mu.Unlock()
+}
+
+// sortedHits returns the recorded matches ordered by target kmer, then file, header, position and strand
+func (r *otRecorder) sortedHits() []otHit {
+	hits := append([]otHit(nil), r.hits...)
+	sortOTHits(hits)
+	return hits
+}
+
+// sortOTHits orders matches by target kmer, then file, header, position and strand
+func sortOTHits(hits []otHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		switch {
+		case a.kmer != b.kmer:
+			return a.kmer < b.kmer
+		case a.file != b.file:
+			return a.file < b.file
+		case a.header != b.header:
+			return a.header < b.header
+		case a.pos != b.pos:
+			return a.pos < b.pos
+		default:
+			return a.strand < b.strand
+		}
+	})
+}
+
+// recordRemovedKmers adds a match without a header, position or strand for each kmer in before that is missing
+// from after.  This covers off-target kmer files, which don't record where their kmers came from.
+func (r *otRecorder) recordRemovedKmers(before []string, after *kmerTable, file string) {
+	var hits []otHit
+	for _, kmer := range before {
+		if !after.has(kmer) {
+			hits = append(hits, otHit{kmer: kmer, match: kmer, file: file})
+		}
+	}
+	r.add(hits)
+}
+
+// otReportRow is an off-target match as written to a JSON off-target report
+type otReportRow struct {
+	Kmer     string `json:"kmer"`
+	Match    string `json:"match"`
+	File     string `json:"file"`
+	Header   string `json:"header,omitempty"`
+	Position int    `json:"position,omitempty"`
+	Strand   string `json:"strand,omitempty"`
+}
+
+// writeOTReport writes off-target matches to a JSON file if the file name ends in .json, or a TSV file otherwise
+func writeOTReport(fileName string, hits []otHit) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		rows := make([]otReportRow, len(hits))
+		for i, h := range hits {
+			rows[i] = otReportRow{Kmer: h.kmer, Match: h.match, File: h.file, Header: h.header, Position: h.pos}
+			if h.strand != 0 {
+				rows[i].Strand = string(h.strand)
+			}
+		}
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	if _, err := fmt.Fprintln(file, "kmer\tmatch\tfile\theader\tposition\tstrand"); err != nil {
+		return err
+	}
+	for _, h := range hits {
+		header, pos, strand := "-", "-", "-"
+		if h.strand != 0 {
+			header, pos, strand = h.header, strconv.Itoa(h.pos), string(h.strand)
+		}
+		if _, err := fmt.Fprintf(file, "%s\t%s\t%s\t%s\t%s\t%s\n", h.kmer, h.match, h.file, header, pos, strand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// otRecordSummary is an off-target record sharing kmers with an evaluated sequence
+type otRecordSummary struct {
+	file    string
+	header  string
+	kmers   int    // no. of distinct kmers of the evaluated sequence matching the record
+	strands string // strands of the record matched
+}
+
+// summarizeOTRecords groups off-target matches by record, ordered by the no. of kmers shared (most first)
+func summarizeOTRecords(hits []otHit) []otRecordSummary {
+	type recordKey struct{ file, header string }
+	kmers := make(map[recordKey]map[string]struct{})
+	strands := make(map[recordKey]map[byte]struct{})
+	for _, h := range hits {
+		key := recordKey{h.file, h.header}
+		if kmers[key] == nil {
+			kmers[key] = make(map[string]struct{})
+			strands[key] = make(map[byte]struct{})
+		}
+		kmers[key][h.kmer] = struct{}{}
+		if h.strand != 0 {
+			strands[key][h.strand] = struct{}{}
+		}
+	}
+	var summaries []otRecordSummary
+	for key, kmerSet := range kmers {
+		strand := "-"
+		_, plus := strands[key]['+']
+		_, minus := strands[key]['-']
+		switch {
+		case plus && minus:
+			strand = "+/-"
+		case plus:
+			strand = "+"
+		case minus:
+			strand = "-"
+		}
+		summaries = append(summaries, otRecordSummary{file: key.file, header: key.header, kmers: len(kmerSet), strands: strand})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		switch {
+		case a.kmers != b.kmers:
+			return a.kmers > b.kmers
+		case a.file != b.file:
+			return a.file < b.file
+		default:
+			return a.header < b.header
+		}
+	})
+	return summaries
+}
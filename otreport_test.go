@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_newOTHit(t *testing.T) {
+	record := seqRecord{file: "ot.fa", header: "ot_1", seq: "AACCGGTTTA"}
+	want := otHit{kmer: "CCGG", match: "CCGG", file: "ot.fa", header: "ot_1", pos: 3, strand: '+'}
+	if got := newOTHit("CCGG", "CCGG", record, 0, 2); got != want {
+		t.Errorf("newOTHit() = %v, want %v", got, want)
+	}
+	// AAAC is at position 1 of the reverse complement (TAAACCGGTT), covering forward positions 6-9 (GTTT)
+	want = otHit{kmer: "AAACC", match: "AAAC", file: "ot.fa", header: "ot_1", pos: 6, strand: '-'}
+	if got := newOTHit("AAACC", "AAAC", record, 1, 1); got != want {
+		t.Errorf("newOTHit() = %v, want %v", got, want)
+	}
+}
+
+// TestConcurrentlyProcessSequencesReport checks each policy records the record, position and strand of its matches
+func TestConcurrentlyProcessSequencesReport(t *testing.T) {
+	refFile := createTempFastaFile([]string{">ot_1", "TTTTTACGTACGGA"}, t)
+	defer os.Remove(refFile)
+	tests := []struct {
+		name   string
+		kmer   string
+		policy otPolicy
+		want   []otHit
+	}{
+		{name: "exact", kmer: "ACGTACGG", policy: otPolicy{kmerLen: 8},
+			want: []otHit{{kmer: "ACGTACGG", match: "ACGTACGG", file: refFile, header: "ot_1", pos: 6, strand: '+'}}},
+		// CGTACG is palindromic, so matches both strands at the same position
+		{name: "subKmer", kmer: "CCGTACGT", policy: otPolicy{kmerLen: 6},
+			want: []otHit{
+				{kmer: "CCGTACGT", match: "GTACGT", file: refFile, header: "ot_1", pos: 6, strand: '-'},
+				{kmer: "CCGTACGT", match: "CGTACG", file: refFile, header: "ot_1", pos: 7, strand: '+'},
+				{kmer: "CCGTACGT", match: "CGTACG", file: refFile, header: "ot_1", pos: 7, strand: '-'},
+				{kmer: "CCGTACGT", match: "CCGTAC", file: refFile, header: "ot_1", pos: 8, strand: '-'},
+			}},
+		{name: "mismatch", kmer: "ACGTACGC", policy: otPolicy{kmerLen: 8, maxMismatches: 1},
+			want: []otHit{{kmer: "ACGTACGC", match: "ACGTACGG", file: refFile, header: "ot_1", pos: 6, strand: '+'}}},
+		{name: "wobble", kmer: "ACGTACGA", policy: otPolicy{kmerLen: 8, wobble: true},
+			want: []otHit{{kmer: "ACGTACGA", match: "ACGTACGG", file: refFile, header: "ot_1", pos: 6, strand: '+'}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodKmers := testKmerTable(map[string][]int{tt.kmer: {1}, "GGGGGGGG": {1}})
+			rec := &otRecorder{}
+			ConcurrentlyProcessSequences([]string{refFile}, goodKmers, 8, tt.policy, rec)
+			if got := rec.sortedHits(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recorded hits = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeOTReport(t *testing.T) {
+	hits := []otHit{
+		{kmer: "ACGT", match: "ACGT", file: "ot.fa", header: "ot_1", pos: 5, strand: '-'},
+		{kmer: "CCCC", match: "CCCC", file: "ot.kmer"},
+	}
+	dir := t.TempDir()
+
+	tsvFile := filepath.Join(dir, "report.tsv")
+	if err := writeOTReport(tsvFile, hits); err != nil {
+		t.Fatalf("writeOTReport() error = %v", err)
+	}
+	got, _ := os.ReadFile(tsvFile)
+	want := "kmer\tmatch\tfile\theader\tposition\tstrand\nACGT\tACGT\tot.fa\tot_1\t5\t-\nCCCC\tCCCC\tot.kmer\t-\t-\t-\n"
+	if string(got) != want {
+		t.Errorf("writeOTReport() TSV = %q, want %q", got, want)
+	}
+
+	jsonFile := filepath.Join(dir, "report.json")
+	if err := writeOTReport(jsonFile, hits); err != nil {
+		t.Fatalf("writeOTReport() error = %v", err)
+	}
+	content, _ := os.ReadFile(jsonFile)
+	var rows []otReportRow
+	if err := json.Unmarshal(content, &rows); err != nil {
+		t.Fatalf("Failed to parse JSON report: %v", err)
+	}
+	wantRows := []otReportRow{
+		{Kmer: "ACGT", Match: "ACGT", File: "ot.fa", Header: "ot_1", Position: 5, Strand: "-"},
+		{Kmer: "CCCC", Match: "CCCC", File: "ot.kmer"},
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("writeOTReport() JSON = %v, want %v", rows, wantRows)
+	}
+}
+
+func Test_summarizeOTRecords(t *testing.T) {
+	hits := []otHit{
+		{kmer: "AAAA", file: "ot.fa", header: "ot_1", pos: 1, strand: '+'},
+		{kmer: "AAAA", file: "ot.fa", header: "ot_2", pos: 9, strand: '+'},
+		{kmer: "AAAC", file: "ot.fa", header: "ot_2", pos: 2, strand: '-'},
+		{kmer: "AAAC", file: "ot.fa", header: "ot_2", pos: 20, strand: '-'},
+	}
+	want := []otRecordSummary{
+		{file: "ot.fa", header: "ot_2", kmers: 2, strands: "+/-"},
+		{file: "ot.fa", header: "ot_1", kmers: 1, strands: "+"},
+	}
+	if got := summarizeOTRecords(hits); !reflect.DeepEqual(got, want) {
+		t.Errorf("summarizeOTRecords() = %v, want %v", got, want)
+	}
+}
+
+func Test_recordRemovedKmers(t *testing.T) {
+	rec := &otRecorder{}
+	rec.recordRemovedKmers([]string{"AAAA", "CCCC"}, testKmerTable(map[string][]int{"AAAA": {1}}), "ot.kmer")
+	want := []otHit{{kmer: "CCCC", match: "CCCC", file: "ot.kmer"}}
+	if got := rec.sortedHits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("recordRemovedKmers() = %v, want %v", got, want)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/adrg/strutil"
 	"github.com/adrg/strutil/metrics"
@@ -12,9 +14,10 @@ import (
 )
 
 // Output results to commandline and a CSV file for each input sequence and the dsRNA sense arm itself
-func outputResults(goodKmers map[string][]int, kmerLength *int, selConstruct *construct, ref []*HeaderRef, csvFileName string) {
+// eff sets the siRNA efficacy columns (nil for none).
+func outputResults(goodKmers *kmerTable, kmerLength *int, selConstruct *construct, ref []*HeaderRef, obj objective, eff *siRNAEfficacy, csvFileName string) {
 	fmt.Println("\nResults:")
-	modKmerHits, rowData := outputTable(goodKmers, kmerLength, selConstruct, ref) // outputTable will now also return rowData for CSV
+	modKmerHits, rowData := outputTable(goodKmers, kmerLength, selConstruct, ref, eff) // outputTable will now also return rowData for CSV
 
 	if csvFileName != "" {
 		err := writeToCSV(csvFileName, rowData, selConstruct.seq)
@@ -31,6 +34,11 @@ func outputResults(goodKmers map[string][]int, kmerLength *int, selConstruct *co
 	} else {
 		fmt.Println("\nMedian of kmer hits to each target sequence:", median)
 	}
+	hitsDesc := "kmer hits"
+	if eff != nil && eff.weighted {
+		hitsDesc = "siRNA efficacy-weighted kmer hits"
+	}
+	fmt.Println("Objective - "+obj.String()+" of "+hitsDesc+" to each target sequence:", strconv.FormatFloat(selConstruct.score, 'f', 1, 64))
 
 	// Other output information
 	fmt.Println("\ndsRNA sense-arm sequence - " + strconv.FormatFloat(gcContent(selConstruct.seq), 'f', 1, 64) + "% GC content")
@@ -75,8 +83,17 @@ func writeToCSV(filename string, data [][]string, seq string) error {
 	return nil // returns nil if everything was written successfully
 }
 
+// numberedFileName adds the construct number (1-based) before the file extension when more than one construct is reported
+func numberedFileName(fileName string, i int, total int) string {
+	if fileName == "" || total == 1 {
+		return fileName
+	}
+	ext := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, ext) + "_" + strconv.Itoa(i+1) + ext
+}
+
 // Generate table and prepare data for CSV
-func outputTable(goodKmers map[string][]int, kmerLength *int, selConstruct *construct, ref []*HeaderRef) ([]int, [][]string) {
+func outputTable(goodKmers *kmerTable, kmerLength *int, selConstruct *construct, ref []*HeaderRef, eff *siRNAEfficacy) ([]int, [][]string) {
 	kmerLenStr := strconv.Itoa(*kmerLength)
 	kmers := kmersPerInput(goodKmers, selConstruct.seq, *kmerLength, len(ref))
 	meanGC := meanGCforKmers(kmers)
@@ -88,9 +105,16 @@ func outputTable(goodKmers map[string][]int, kmerLength *int, selConstruct *cons
 		"Kmer mean GC (%)",
 		"5'U (%)",
 		"5'A (%)",
-		"5'C (%)"}
+		"5'C (%)",
+		"Antisense favored (%)"}
+	var extraHeaders []string
+	var extraCols [][]string
+	if eff != nil {
+		extraHeaders, extraCols = efficacyColumns(kmers, eff)
+	}
+	headers = append(headers, extraHeaders...)
 	table.SetHeader(headers)
-	modKmerHits, csvData := generateRowData(kmerStats, meanGC, selConstruct, ref, table, *kmerLength)
+	modKmerHits, csvData := generateRowData(kmerStats, meanGC, extraHeaders, extraCols, selConstruct, ref, table, *kmerLength)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.Render()
 	return modKmerHits, csvData
@@ -98,24 +122,24 @@ func outputTable(goodKmers map[string][]int, kmerLength *int, selConstruct *cons
 
 // Returns the kmers that match each input sequence
 // Use only after the best construct has been returned
-func kmersPerInput(goodKmers map[string][]int, bestConstruct string, kmerLen int, headerNo int) [][]string {
+func kmersPerInput(goodKmers *kmerTable, bestConstruct string, kmerLen int, headerNo int) [][]string {
 	kmersForInput := make([][]string, headerNo)
 	for i := 0; i < len(bestConstruct)-kmerLen+1; i++ {
 		kmer := bestConstruct[i : i+kmerLen]
-		for index, count := range goodKmers[kmer] {
-			if count == 1 {
-				kmersForInput[index] = append(kmersForInput[index], kmer)
-			}
+		for _, index := range goodKmers.targets(kmer) {
+			kmersForInput[index] = append(kmersForInput[index], kmer)
 		}
 	}
 	return kmersForInput
 }
 
+// kmerStats returns, for each input's kmers, the fraction giving a guide strand with a 5'U, 5'A and 5'C, the no. of
+// kmers, and the fraction whose antisense strand is thermodynamically favored (see endAsymmetry)
 func kmerStats(kmersPerInput [][]string) [][]float64 {
 	var results [][]float64
 	// result := []float64{0, 0, 0}
 	for _, kmers := range kmersPerInput {
-		result := []float64{0, 0, 0, 0}
+		result := []float64{0, 0, 0, 0, 0}
 		for _, kmer := range kmers {
 			switch kmer[len(kmer)-1:] {
 			case "A":
@@ -126,6 +150,9 @@ func kmerStats(kmersPerInput [][]string) [][]float64 {
 				result[2] += 1.0 / float64(len(kmers))
 			}
 			result[3] += 1.0
+			if antisenseFavored(kmer) {
+				result[4] += 1.0 / float64(len(kmers))
+			}
 		}
 		results = append(results, result)
 	}
@@ -133,20 +160,13 @@ func kmerStats(kmersPerInput [][]string) [][]float64 {
 	return results
 }
 
-// generateRowData prepares data for the output table and CSV export
-func generateRowData(kmerStats [][]float64, meanGC []float64, selConstruct *construct, ref []*HeaderRef, table *tablewriter.Table, kmerLength int) ([]int, [][]string) {
+// generateRowData prepares data for the output table and CSV export.  extraHeaders and extraCols (one row of values per
+// target) add optional columns after the standard ones.
+func generateRowData(kmerStats [][]float64, meanGC []float64, extraHeaders []string, extraCols [][]string, selConstruct *construct, ref []*HeaderRef, table *tablewriter.Table, kmerLength int) ([]int, [][]string) {
 	headerMap := make(map[string]bool)
 	var modKmerHits []int
 	var csvData [][]string // Initialize slice to hold CSV data rows
 
-	// Initialize the Smith-Waterman-Gotoh algorithm parameters
-	swg := metrics.NewSmithWatermanGotoh()
-	swg.GapPenalty = -2
-	swg.Substitution = metrics.MatchMismatch{
-		Match:    1,
-		Mismatch: -2,
-	}
-
 	// Prepare headers for the CSV output
 	csvHeaders := []string{
 		"Target sequence header",
@@ -156,22 +176,29 @@ func generateRowData(kmerStats [][]float64, meanGC []float64, selConstruct *cons
 		"5'U (%)",
 		"5'A (%)",
 		"5'C (%)",
+		"Antisense favored (%)",
 	}
+	csvHeaders = append(csvHeaders, extraHeaders...)
 	csvData = append(csvData, csvHeaders) // Append headers to the CSV data slice
 
 	// Iterate over each target sequence to prepare data for output and CSV
 	for i := range selConstruct.kmerHits {
 		if _, ok := headerMap[ref[i].Header]; !ok {
+			similarity := strconv.FormatFloat(swgSimilarity(selConstruct.seq, ref[i].Seq)*100, 'f', 1, 64)
 			// Prepare row data for the terminal table output
 			modKmerHits = append(modKmerHits, int(kmerStats[i][3])) // Collect modified kmer hit counts
 			tableRow := []string{
 				ref[i].Header,
 				strconv.FormatFloat(kmerStats[i][3], 'f', 0, 64),
-				strconv.FormatFloat(strutil.Similarity(selConstruct.seq, ref[i].Seq, swg)*100, 'f', 1, 64),
+				similarity,
 				strconv.FormatFloat(meanGC[i], 'f', 1, 64),
 				strconv.FormatFloat(kmerStats[i][0]*100, 'f', 1, 64),
 				strconv.FormatFloat(kmerStats[i][1]*100, 'f', 1, 64),
 				strconv.FormatFloat(kmerStats[i][2]*100, 'f', 1, 64),
+				strconv.FormatFloat(kmerStats[i][4]*100, 'f', 1, 64),
+			}
+			if extraCols != nil {
+				tableRow = append(tableRow, extraCols[i]...)
 			}
 			table.Append(tableRow) // Append row data to the terminal table
 
@@ -179,11 +206,15 @@ func generateRowData(kmerStats [][]float64, meanGC []float64, selConstruct *cons
 			csvRow := []string{
 				ref[i].Header,
 				strconv.FormatFloat(kmerStats[i][3], 'f', 0, 64),
-				strconv.FormatFloat(strutil.Similarity(selConstruct.seq, ref[i].Seq, swg)*100, 'f', 1, 64),
+				similarity,
 				strconv.FormatFloat(meanGC[i], 'f', 1, 64),
 				strconv.FormatFloat(kmerStats[i][0]*100, 'f', 1, 64),
 				strconv.FormatFloat(kmerStats[i][1]*100, 'f', 1, 64),
 				strconv.FormatFloat(kmerStats[i][2]*100, 'f', 1, 64),
+				strconv.FormatFloat(kmerStats[i][4]*100, 'f', 1, 64),
+			}
+			if extraCols != nil {
+				csvRow = append(csvRow, extraCols[i]...)
 			}
 			csvData = append(csvData, csvRow) // Append row data to the CSV data slice
 
@@ -194,6 +225,17 @@ func generateRowData(kmerStats [][]float64, meanGC []float64, selConstruct *cons
 	return modKmerHits, csvData // Return the modified kmer hits and the CSV data for export
 }
 
+// swgSimilarity returns the Smith-Waterman-Gotoh similarity (0-1) of a construct to a target sequence
+func swgSimilarity(seq string, target string) float64 {
+	swg := metrics.NewSmithWatermanGotoh()
+	swg.GapPenalty = -2
+	swg.Substitution = metrics.MatchMismatch{
+		Match:    1,
+		Mismatch: -2,
+	}
+	return strutil.Similarity(seq, target, swg)
+}
+
 func meanGCforKmers(kmersForInput [][]string) []float64 {
 	var meanGC []float64
 	gc := 0.0
@@ -217,3 +259,160 @@ func gcContent(kmer string) float64 {
 	}
 	return gc * 100 / float64(len(kmer))
 }
+
+// outputPanelCoverage prints the kmer hits of each panel construct to each target, and which constructs cover it
+func outputPanelCoverage(panel []*panelConstruct, ref []*HeaderRef, minHits []int) {
+	fmt.Println("\nPanel coverage:")
+	table := tablewriter.NewWriter(os.Stdout)
+	headers := []string{"Target sequence header", "Min kmer hits"}
+	for i := range panel {
+		headers = append(headers, "Construct "+strconv.Itoa(i+1)+" hits")
+	}
+	headers = append(headers, "Covered by")
+	table.SetHeader(headers)
+	for i, hr := range ref {
+		row := []string{hr.Header, strconv.Itoa(minHits[i])}
+		var coveredBy []string
+		for j, pc := range panel {
+			row = append(row, strconv.Itoa(pc.kmerHits[i]))
+			if pc.kmerHits[i] >= minHits[i] {
+				coveredBy = append(coveredBy, strconv.Itoa(j+1))
+			}
+		}
+		if len(coveredBy) == 0 {
+			coveredBy = []string{"-"}
+		}
+		row = append(row, strings.Join(coveredBy, ","))
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+}
+
+// outputChimeraSegments prints the position of each group's segment in a chimeric construct
+func outputChimeraSegments(groups []*targetGroup, candidates [][]*construct, chim *chimera) {
+	fmt.Println("Chimeric construct segments:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Group", "Targets", "Start", "End", "Segment score"})
+	start := 1
+	for _, g := range chim.order {
+		segment := candidates[g][chim.choice[g]]
+		end := start + len(segment.seq) - 1
+		table.Append([]string{groups[g].name, strconv.Itoa(len(groups[g].members)), strconv.Itoa(start), strconv.Itoa(end),
+			strconv.FormatFloat(segment.score, 'f', 1, 64)})
+		start = end + 1
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+	fmt.Println("")
+}
+
+// outputOffTargetHits prints the kmers of an evaluated sequence that match an off-target
+func outputOffTargetHits(hits []otKmerHit, seq string, kmerLen int) {
+	fmt.Printf("Off-target matching kmers: %d of %d\n", len(hits), len(seq)-kmerLen+1)
+	if len(hits) > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Position", "Kmer"})
+		for _, hit := range hits {
+			table.Append([]string{strconv.Itoa(hit.pos + 1), hit.kmer})
+		}
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.Render()
+	}
+	fmt.Println("")
+}
+
+// outputOffTargetRecords prints the off-target records sharing kmers with an evaluated sequence
+func outputOffTargetRecords(records []otRecordSummary) {
+	if len(records) == 0 {
+		return
+	}
+	fmt.Println("Off-target records sharing kmers:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Off-target file", "Record header", "Shared kmers", "Strand"})
+	for _, r := range records {
+		header := r.header
+		if header == "" {
+			header = "-"
+		}
+		table.Append([]string{r.file, header, strconv.Itoa(r.kmers), r.strands})
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+	fmt.Println("")
+}
+
+// outputLengthCurve prints the best objective score found at each construct length and the score the length is selected
+// by (-lengthSelect mode), marking the selected length
+func outputLengthCurve(curve []lengthPoint, selected int, mode string) {
+	fmt.Println("\nConstruct length curve:")
+	table := tablewriter.NewWriter(os.Stdout)
+	selHeader, prec := "Score per nt", 3
+	if mode == "penalty" {
+		selHeader, prec = "Penalized score", 1
+	}
+	table.SetHeader([]string{"Length (nt)", "Objective score", selHeader, "Selected"})
+	for i, pt := range curve {
+		row := []string{strconv.Itoa(pt.length), "-", "-"}
+		if pt.construct != nil {
+			row[1] = strconv.FormatFloat(pt.construct.score, 'f', 1, 64)
+			row[2] = strconv.FormatFloat(pt.selScore, 'f', prec, 64)
+		}
+		mark := ""
+		if i == selected {
+			mark = "*"
+		}
+		table.Append(append(row, mark))
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+}
+
+// outputSearchBound prints the greedy construct's score against the best construct and upper bound of the exhaustive
+// search
+func outputSearchBound(greedy *construct, sb *searchBound) {
+	fmt.Println("\nExhaustive search:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Greedy score", "Best score", "Upper bound", "Greedy optimality gap", "Search nodes", "Complete"})
+	greedyScore, bestScore, gap := "-", "-", "-"
+	if greedy != nil {
+		greedyScore = strconv.FormatFloat(greedy.score, 'f', 1, 64)
+		gap = strconv.FormatFloat(sb.upperBound-greedy.score, 'f', 1, 64)
+		if sb.upperBound > 0 {
+			gap += fmt.Sprintf(" (%.1f%%)", (sb.upperBound-greedy.score)/sb.upperBound*100)
+		}
+	}
+	if sb.best != nil {
+		bestScore = strconv.FormatFloat(sb.best.score, 'f', 1, 64)
+	}
+	complete := "yes"
+	if !sb.complete {
+		complete = "no"
+	}
+	table.Append([]string{greedyScore, bestScore, strconv.FormatFloat(sb.upperBound, 'f', 1, 64), gap, intWithCommas(sb.nodes), complete})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+}
+
+// outputPrimers prints a pair of T7-tailed primers and the T7-flanked template they amplify
+func outputPrimers(p *t7Primers) {
+	fmt.Println("\nT7 primers:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Primer", "Sequence (5'-3', T7 tail lowercase)", "Construct site", "Length (nt)", "Binding Tm (°C)"})
+	for _, row := range []struct {
+		name string
+		site primerSite
+	}{{"Forward", p.fwd}, {"Reverse", p.rev}} {
+		table.Append([]string{row.name, strings.ToLower(t7Promoter) + row.site.primer,
+			strconv.Itoa(row.site.start+1) + "-" + strconv.Itoa(row.site.end), strconv.Itoa(len(row.site.tailed())),
+			strconv.FormatFloat(row.site.tm, 'f', 1, 64)})
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+	if p.source != "" {
+		fmt.Printf("\nT7-flanked template amplified from '%s' (%d nt):\n", p.source, len(p.template))
+	} else {
+		fmt.Printf("\nT7-flanked template (%d nt):\n", len(p.template))
+	}
+	fmt.Println(p.template)
+}
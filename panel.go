@@ -0,0 +1,85 @@
+package main
+
+// panelConstruct is a construct in a multi-dsRNA panel, with the targets it was selected to cover
+type panelConstruct struct {
+	*construct
+	covers []int // indices of targets first covered by this construct
+}
+
+// designPanel greedily designs up to maxConstructs constructs so every target reaches its min. kmer hits.  Each round
+// runs conBestConstruct over the targets not yet covered, choosing the construct covering the most of them (by weight,
+// ties broken by mean kmer hits), then removes the targets it covers.  Targets with a weight or min. kmer hits of 0 don't
+// need covering.  Design stops early when every target is covered or no further target can be.
+//
+// Args:
+//
+//	goodKmers: Target kmers remaining after off-target filtering.
+//	weights: Per-target weights (nil for a weight of 1 each).
+//	p: The construct search parameters (p.obj and p.minHits are replaced each round).
+//	minHits: The min. kmer hits for each target to count as covered.
+//	maxConstructs: The max. no. of constructs in the panel.
+//
+// Returns:
+//
+//	The panel constructs in the order designed, and the indices of any targets left uncovered.
+func designPanel(goodKmers *kmerTable, weights []float64, p searchParams, minHits []int, maxConstructs int) ([]*panelConstruct, []int) {
+	uncovered := make([]bool, p.seqLen)
+	for i := range uncovered {
+		uncovered[i] = minHits[i] > 0 && (weights == nil || weights[i] > 0)
+	}
+	var panel []*panelConstruct
+	for len(panel) < maxConstructs {
+		roundWeights := make([]float64, p.seqLen)
+		remaining := 0
+		for i := range roundWeights {
+			if uncovered[i] {
+				roundWeights[i] = 1
+				if weights != nil {
+					roundWeights[i] = weights[i]
+				}
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			break
+		}
+		// Only kmers present in an uncovered target are used to seed and extend constructs
+		kmerCts := kmerAbun(goodKmers, roundWeights)
+		usable := 0
+		for row, v := range kmerCts {
+			if v == 0 {
+				kmerCts[row] = -1
+			} else if v > 0 {
+				usable++
+			}
+		}
+		if usable == 0 {
+			break
+		}
+		roundParams := p
+		roundParams.obj = objective{name: "coverage", weights: roundWeights, minHits: minHits}
+		roundParams.minHits = nil
+		selConstruct := conBestConstruct(goodKmers, kmerCts, roundParams)
+		if selConstruct == nil {
+			break
+		}
+		var covers []int
+		for i, hits := range selConstruct.kmerHits {
+			if uncovered[i] && hits >= minHits[i] {
+				covers = append(covers, i)
+				uncovered[i] = false
+			}
+		}
+		if len(covers) == 0 {
+			break
+		}
+		panel = append(panel, &panelConstruct{construct: selConstruct, covers: covers})
+	}
+	var left []int
+	for i, u := range uncovered {
+		if u {
+			left = append(left, i)
+		}
+	}
+	return panel, left
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_designPanel(t *testing.T) {
+	ref := []*HeaderRef{
+		{Header: "ref_1", Seq: "AAAACCCAAGG"},
+		{Header: "ref_2", Seq: "AAAACCCAAGG"},
+		{Header: "ref_3", Seq: "GTGTCTCTTGA"},
+	}
+	goodKmers, _ := getKmers(ref, 4)
+	p := searchParams{kmerLen: 4, seqLen: len(ref), constructLen: 8, iterations: 20, seed: 1}
+
+	panel, uncovered := designPanel(goodKmers, nil, p, []int{5, 5, 5}, 3)
+	if len(panel) != 2 || len(uncovered) != 0 {
+		t.Fatalf("designPanel() = %d constructs, %v uncovered, want 2 constructs, none uncovered", len(panel), uncovered)
+	}
+	if !reflect.DeepEqual(panel[0].covers, []int{0, 1}) || !reflect.DeepEqual(panel[1].covers, []int{2}) {
+		t.Errorf("designPanel() covers = %v, %v, want [0 1], [2]", panel[0].covers, panel[1].covers)
+	}
+
+	panel, uncovered = designPanel(goodKmers, nil, p, []int{5, 5, 5}, 1)
+	if len(panel) != 1 || !reflect.DeepEqual(uncovered, []int{2}) {
+		t.Errorf("designPanel() = %d constructs, %v uncovered, want 1 construct, [2] uncovered", len(panel), uncovered)
+	}
+
+	// A target with a weight of 0 doesn't need covering
+	panel, uncovered = designPanel(goodKmers, []float64{1, 1, 0}, p, []int{5, 5, 5}, 3)
+	if len(panel) != 1 || len(uncovered) != 0 {
+		t.Errorf("designPanel() = %d constructs, %v uncovered, want 1 construct, none uncovered", len(panel), uncovered)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// t7Promoter is the T7 RNA polymerase promoter added to the 5' end of each primer, ending in the GGG that starts
+// transcription
+const t7Promoter = "TAATACGACTCACTATAGGG"
+
+// Primer design limits
+const (
+	primerMinLen   = 18
+	primerMaxLen   = 28
+	primerMaxShift = 30   // max. distance (nt) of a primer site from its end of the construct
+	primerShiftTm  = 0.05 // Tm difference (°C) worth moving a primer site 1 nt further from the construct end
+	primerMinGC    = 30.0 // GC content (%) limits of the construct-binding region
+	primerMaxGC    = 70.0
+)
+
+// Tm conditions for primers - 50 mM Na+ and 250 nM of each primer
+const (
+	primerNa   = 0.05
+	primerConc = 250e-9
+)
+
+// dnaNNParams is the enthalpy (kcal/mol) and entropy (cal/K/mol) of each DNA/DNA nearest-neighbor stack, keyed by the
+// 5'->3' dinucleotide of one strand.  Values are the unified parameters of SantaLucia (1998).
+var dnaNNParams = map[string][2]float64{
+	"AA": {-7.9, -22.2}, "TT": {-7.9, -22.2},
+	"AT": {-7.2, -20.4},
+	"TA": {-7.2, -21.3},
+	"CA": {-8.5, -22.7}, "TG": {-8.5, -22.7},
+	"GT": {-8.4, -22.4}, "AC": {-8.4, -22.4},
+	"CT": {-7.8, -21.0}, "AG": {-7.8, -21.0},
+	"GA": {-8.2, -22.2}, "TC": {-8.2, -22.2},
+	"CG": {-10.6, -27.2},
+	"GC": {-9.8, -24.4},
+	"GG": {-8.0, -19.9}, "CC": {-8.0, -19.9},
+}
+
+// primerTm returns the nearest-neighbor melting temperature (°C) of a primer bound to its perfect complement
+func primerTm(seq string) float64 {
+	dH, dS := 0.0, 0.0
+	// Initiation at each terminal pair
+	for _, end := range []byte{seq[0], seq[len(seq)-1]} {
+		if isWeak(end) {
+			dH, dS = dH+2.3, dS+4.1
+		} else {
+			dH, dS = dH+0.1, dS-2.8
+		}
+	}
+	for i := 0; i < len(seq)-1; i++ {
+		p := dnaNNParams[seq[i:i+2]]
+		dH, dS = dH+p[0], dS+p[1]
+	}
+	dS += 0.368 * float64(len(seq)-1) * math.Log(primerNa)
+	return dH*1000/(dS+1.987*math.Log(primerConc/4)) - 273.15
+}
+
+// hasGCClamp reports whether a primer ends in G or C, without more than 3 G/C in its last 5 nt
+func hasGCClamp(primer string) bool {
+	if isWeak(primer[len(primer)-1]) {
+		return false
+	}
+	strong := 0
+	for i := len(primer) - 5; i < len(primer); i++ {
+		if !isWeak(primer[i]) {
+			strong++
+		}
+	}
+	return strong <= 3
+}
+
+// primerSite is a primer's binding site on the construct
+type primerSite struct {
+	start, end int    // 0-based site on the construct, end exclusive
+	primer     string // construct-binding region of the primer, 5'->3'
+	tm         float64
+}
+
+// t7Primers is a pair of T7-tailed primers and the dsRNA template they amplify
+type t7Primers struct {
+	fwd, rev primerSite
+	template string // T7-flanked template, sense strand
+	source   string // header of the target the template is amplified from ("" for the construct itself)
+}
+
+// tailed returns the primer with its T7 promoter tail
+func (s primerSite) tailed() string {
+	return t7Promoter + s.primer
+}
+
+// primerCandidates returns the sites within primerMaxShift nt of the start (or end, for reverse primers) of seq with a
+// GC clamp and acceptable GC content
+func primerCandidates(seq string, reverse bool) []primerSite {
+	var sites []primerSite
+	for shift := 0; shift <= primerMaxShift; shift++ {
+		for length := primerMinLen; length <= primerMaxLen; length++ {
+			start, end := shift, shift+length
+			if reverse {
+				start, end = len(seq)-shift-length, len(seq)-shift
+			}
+			// Keep the two primers' sites apart
+			if start < 0 || end > len(seq) || (reverse && start < len(seq)/2) || (!reverse && end > len(seq)/2) {
+				continue
+			}
+			primer := seq[start:end]
+			if reverse {
+				primer = reverseComplement(primer)
+			}
+			if gc := gcContent(primer); gc < primerMinGC || gc > primerMaxGC || !hasGCClamp(primer) {
+				continue
+			}
+			sites = append(sites, primerSite{start: start, end: end, primer: primer, tm: primerTm(primer)})
+		}
+	}
+	return sites
+}
+
+// designT7Primers designs forward and reverse primers at the ends of a construct, with T7 promoter tails, choosing the
+// pair closest to the target Tm and to each other, and to the construct ends.  If target isn't nil, both
+// primer sites must be present in that target sequence, in order on the same strand, so the template can be amplified
+// from cDNA - the template is then the target's sequence between the primers.
+func designT7Primers(seq string, target *HeaderRef, targetTm float64) (*t7Primers, error) {
+	fwds := primerCandidates(seq, false)
+	revs := primerCandidates(seq, true)
+	if len(fwds) == 0 || len(revs) == 0 {
+		return nil, fmt.Errorf("no primer sites with a 3' GC clamp and %.0f-%.0f%% GC within %d nt of the construct ends", primerMinGC, primerMaxGC, primerMaxShift)
+	}
+
+	// Positions of each site on both strands of the target
+	var strands []string
+	var fPos, rPos [][2]int
+	if target != nil {
+		strands = []string{target.Seq, reverseComplement(target.Seq)}
+		fPos = make([][2]int, len(fwds))
+		for i, f := range fwds {
+			for j, s := range strands {
+				fPos[i][j] = strings.Index(s, seq[f.start:f.end])
+			}
+		}
+		rPos = make([][2]int, len(revs))
+		for i, r := range revs {
+			for j, s := range strands {
+				rPos[i][j] = strings.LastIndex(s, seq[r.start:r.end])
+			}
+		}
+	}
+	var best *t7Primers
+	bestCost := math.Inf(1)
+	for i, f := range fwds {
+		for j, r := range revs {
+			shift := f.start + len(seq) - r.end
+			cost := math.Abs(f.tm-r.tm) + (math.Abs(f.tm-targetTm)+math.Abs(r.tm-targetTm))/2 + primerShiftTm*float64(shift)
+			if cost >= bestCost {
+				continue
+			}
+			amplicon := seq[f.start:r.end]
+			if target != nil {
+				amplicon = ""
+				for k, s := range strands {
+					if fPos[i][k] >= 0 && rPos[j][k] >= fPos[i][k] {
+						amplicon = s[fPos[i][k] : rPos[j][k]+r.end-r.start]
+						break
+					}
+				}
+				if amplicon == "" {
+					continue
+				}
+			}
+			best = &t7Primers{fwd: f, rev: r, template: t7Promoter + amplicon + reverseComplement(t7Promoter)}
+			if target != nil {
+				best.source = target.Header
+			}
+			bestCost = cost
+		}
+	}
+	if best == nil {
+		return nil, errors.New("no primer pair with both sites present in order in target '" + target.Header + "'")
+	}
+	return best, nil
+}
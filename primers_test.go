@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func Test_primerTm(t *testing.T) {
+	// A primer and its reverse complement form the same duplex
+	seq := "AGCATAGCGGCAAAGCACTCTG"
+	if a, b := primerTm(seq), primerTm(reverseComplement(seq)); math.Abs(a-b) > 1e-9 {
+		t.Errorf("primerTm() = %v for the primer, %v for its reverse complement, want equal", a, b)
+	}
+	if tm := primerTm(seq); tm < 55 || tm > 65 {
+		t.Errorf("primerTm(%s) = %v, want 55-65", seq, tm)
+	}
+	if primerTm("GCGCGGCCGCGC") <= primerTm("ATATTAATATAT") {
+		t.Error("primerTm() of a GC-rich primer should exceed that of an AT-rich primer")
+	}
+	if primerTm(seq+"GCA") <= primerTm(seq) {
+		t.Error("primerTm() should increase with primer length")
+	}
+}
+
+func Test_hasGCClamp(t *testing.T) {
+	tests := []struct {
+		primer string
+		want   bool
+	}{
+		{"AAAAAAATTAG", true},
+		{"AAAAAAATTGC", true},
+		{"AAAAAAAGCGC", false}, // too many G/C in the last 5 nt
+		{"AAAAAAACCGA", false}, // no 3' G/C
+	}
+	for _, tt := range tests {
+		if got := hasGCClamp(tt.primer); got != tt.want {
+			t.Errorf("hasGCClamp(%s) = %v, want %v", tt.primer, got, tt.want)
+		}
+	}
+}
+
+func Test_designT7Primers(t *testing.T) {
+	seq := "TTCGATGTACAACTCTCCCATAGCTTAAAGCATAGCGGCAAAGCACTCTGACTACCTTTATCTGATTTGCTAGGGTGTCACGGCTCCCACTCACACTTCAATTGT" +
+		"AACTATTACCATTCCGAGAAGGTGTCGAGGGAATAAAAAACATACGCTGTGATGTATCTATGTCTGCCTTCTTGGCTTACCATAAGCAATTGGAACTAGGATACCAC" +
+		"CAACGCCTGCTCAAAAACGAATTCATGTTAGTTCAATGAGGCTAGTACCGAGCTTAGCGCCTTTGCTTTTAGACAACGATACCGTTAG"
+	p, err := designT7Primers(seq, nil, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.fwd.primer != seq[p.fwd.start:p.fwd.end] || p.rev.primer != reverseComplement(seq[p.rev.start:p.rev.end]) {
+		t.Errorf("designT7Primers() primers %s, %s don't match their construct sites", p.fwd.primer, p.rev.primer)
+	}
+	if !hasGCClamp(p.fwd.primer) || !hasGCClamp(p.rev.primer) || math.Abs(p.fwd.tm-p.rev.tm) > 2 {
+		t.Errorf("designT7Primers() = %s (Tm %.1f), %s (Tm %.1f), want GC clamps and matched Tms", p.fwd.primer, p.fwd.tm, p.rev.primer, p.rev.tm)
+	}
+	want := t7Promoter + seq[p.fwd.start:p.rev.end] + reverseComplement(t7Promoter)
+	if p.template != want || p.source != "" {
+		t.Errorf("designT7Primers() template = %s, want %s", p.template, want)
+	}
+	if !strings.HasPrefix(p.template, p.fwd.tailed()) || !strings.HasPrefix(reverseComplement(p.template), p.rev.tailed()) {
+		t.Error("designT7Primers() template isn't amplified by the tailed primers")
+	}
+
+	// The target carries the construct reverse complemented, with a change in the middle
+	targetSeq := []byte("GGGG" + seq + "AAAA")
+	targetSeq[150] = 'C'
+	target := &HeaderRef{Header: "target", Seq: reverseComplement(string(targetSeq))}
+	p, err = designT7Primers(seq, target, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.source != "target" || p.template != t7Promoter+string(targetSeq[p.fwd.start+4:p.rev.end+4])+reverseComplement(t7Promoter) {
+		t.Errorf("designT7Primers() template = %s from '%s', want the target's amplicon", p.template, p.source)
+	}
+
+	// Neither end of the construct is present in the target
+	target = &HeaderRef{Header: "target", Seq: seq[60 : len(seq)-60]}
+	if _, err := designT7Primers(seq, target, 60); err == nil {
+		t.Error("designT7Primers() error = nil, want an error for primer sites missing from the target")
+	}
+}
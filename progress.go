@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressModes are the -progress settings
+var progressModes = []string{"auto", "bar", "log", "none"}
+
+// Where and how long-running stages report progress, set once from -progress before any stage runs.  A nil
+// progressOutput (the default, as in tests) reports nothing.
+var (
+	progressOutput      io.Writer
+	progressAsBar       bool                     // draw a progress bar, rather than logging a line periodically
+	progressBarInterval = 200 * time.Millisecond // how often the bar is redrawn
+	progressLogInterval = 30 * time.Second       // how often a progress line is logged
+)
+
+// progressBarWidth is the no. of characters in a progress bar
+const progressBarWidth = 30
+
+// setProgressMode sets how progress is reported to stderr: "bar" draws a progress bar, "log" logs a progress line
+// periodically, "auto" draws a bar if stderr is a terminal and logs otherwise, and "none" reports nothing
+func setProgressMode(mode string, stderr *os.File) error {
+	switch mode {
+	case "auto":
+		progressOutput, progressAsBar = stderr, isTerminal(stderr)
+	case "bar":
+		progressOutput, progressAsBar = stderr, true
+	case "log":
+		progressOutput, progressAsBar = stderr, false
+	case "none":
+		progressOutput = nil
+	default:
+		return fmt.Errorf("unknown progress mode '%s' (one of %s)", mode, strings.Join(progressModes, ", "))
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a terminal (character device)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progress reports how far through a long-running stage the run is, with an ETA.  A nil *progress reports nothing, so
+// stages can report unconditionally.
+type progress struct {
+	label string // stage name, e.g. "Off-target screen"
+	unit  string // what's counted ("bytes" formats as a size)
+	total int64  // 0 if unknown
+	done  int64  // updated atomically
+
+	mu   sync.Mutex
+	note string // extra detail, e.g. the best score so far
+
+	out      io.Writer
+	bar      bool
+	start    time.Time
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+// newProgress starts reporting the progress of a stage of total units, or returns nil if progress isn't reported
+func newProgress(label string, total int64, unit string) *progress {
+	if progressOutput == nil {
+		return nil
+	}
+	p := &progress{label: label, unit: unit, total: total, out: progressOutput, bar: progressAsBar, start: time.Now(),
+		stop: make(chan struct{}), finished: make(chan struct{})}
+	interval := progressLogInterval
+	if p.bar {
+		interval = progressBarInterval
+	}
+	go p.run(interval)
+	return p
+}
+
+// add records n more units done
+func (p *progress) add(n int64) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.done, n)
+}
+
+// setNote sets the detail reported after the counts
+func (p *progress) setNote(note string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.note = note
+	p.mu.Unlock()
+}
+
+// finish stops reporting, once the stage is done
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.finished
+}
+
+// run reports progress every interval until the stage finishes.  If any progress was reported, a bar is then cleared
+// so later output starts on a clean line, or a last line is logged.
+func (p *progress) run(interval time.Duration) {
+	defer close(p.finished)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	logger := log.New(p.out, "", log.LstdFlags)
+	reported := false
+	for {
+		select {
+		case <-p.stop:
+			switch {
+			case !reported:
+			case p.bar:
+				fmt.Fprint(p.out, "\r\033[K")
+			default:
+				logger.Println(p.logLine(time.Since(p.start)))
+			}
+			return
+		case <-ticker.C:
+			elapsed := time.Since(p.start)
+			if p.bar {
+				fmt.Fprint(p.out, "\r\033[K"+p.barLine(elapsed))
+			} else {
+				logger.Println(p.logLine(elapsed))
+			}
+			reported = true
+		}
+	}
+}
+
+// status returns the units done, the fraction of the total done (-1 if the total is unknown), the ETA (-1 if not yet
+// known) and the note
+func (p *progress) status(elapsed time.Duration) (int64, float64, time.Duration, string) {
+	done := atomic.LoadInt64(&p.done)
+	p.mu.Lock()
+	note := p.note
+	p.mu.Unlock()
+	if p.total <= 0 {
+		return done, -1, -1, note
+	}
+	fraction := float64(done) / float64(p.total)
+	if fraction > 1 {
+		fraction = 1
+	}
+	eta := time.Duration(-1)
+	if done > 0 {
+		eta = time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+	}
+	return done, fraction, eta, note
+}
+
+// barLine returns a progress bar line, e.g. "Construct search [#####.....] 50.0% 500/1,000 iterations ETA 12s"
+func (p *progress) barLine(elapsed time.Duration) string {
+	done, fraction, eta, note := p.status(elapsed)
+	var sb strings.Builder
+	sb.WriteString(p.label)
+	if fraction >= 0 {
+		filled := int(fraction * progressBarWidth)
+		fmt.Fprintf(&sb, " [%s%s] %5.1f%% %s/%s", strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+			100*fraction, p.count(done), p.count(p.total))
+	} else {
+		sb.WriteString(" " + p.count(done))
+	}
+	if p.unit != "bytes" {
+		sb.WriteString(" " + p.unit)
+	}
+	if eta >= 0 {
+		sb.WriteString(" ETA " + eta.Round(time.Second).String())
+	}
+	if note != "" {
+		sb.WriteString(" " + note)
+	}
+	return sb.String()
+}
+
+// logLine returns a structured progress log line, e.g. "progress stage="Construct search" done=500 total=1000
+// unit=iterations percent=50.0 elapsed=12s eta=12s"
+func (p *progress) logLine(elapsed time.Duration) string {
+	done, fraction, eta, note := p.status(elapsed)
+	line := fmt.Sprintf("progress stage=%q done=%d", p.label, done)
+	if p.total > 0 {
+		line += fmt.Sprintf(" total=%d", p.total)
+	}
+	line += " unit=" + p.unit
+	if fraction >= 0 {
+		line += fmt.Sprintf(" percent=%.1f", 100*fraction)
+	}
+	line += " elapsed=" + elapsed.Round(time.Second).String()
+	if eta >= 0 {
+		line += " eta=" + eta.Round(time.Second).String()
+	}
+	if note != "" {
+		line += fmt.Sprintf(" note=%q", note)
+	}
+	return line
+}
+
+// count formats a no. of units for a progress bar
+func (p *progress) count(n int64) string {
+	if p.unit == "bytes" {
+		return formatBytes(n)
+	}
+	return intWithCommas(int(n))
+}
+
+// formatBytes formats a no. of bytes with a binary unit, e.g. "1.5 GiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// progressReader counts the bytes read through it as progress
+type progressReader struct {
+	r    io.Reader
+	prog *progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.prog.add(int64(n))
+	return n, err
+}
+
+// fileSizes returns the total size of files, skipping any that can't be read (they're reported when opened)
+func fileSizes(files []string) int64 {
+	var total int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_formatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func Test_progressLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *progress
+		note    string
+		wantBar string
+		wantLog string
+	}{
+		{
+			name:    "iterations",
+			p:       &progress{label: "Construct search", unit: "iterations", total: 1000, done: 250},
+			note:    "best score 12.0",
+			wantBar: "Construct search [#######.......................]  25.0% 250/1,000 iterations ETA 30s best score 12.0",
+			wantLog: `progress stage="Construct search" done=250 total=1000 unit=iterations percent=25.0 elapsed=10s eta=30s note="best score 12.0"`,
+		},
+		{
+			name:    "bytes",
+			p:       &progress{label: "Off-target screen", unit: "bytes", total: 4 << 20, done: 2 << 20},
+			wantBar: "Off-target screen [###############...............]  50.0% 2.0 MiB/4.0 MiB ETA 10s",
+			wantLog: `progress stage="Off-target screen" done=2097152 total=4194304 unit=bytes percent=50.0 elapsed=10s eta=10s`,
+		},
+		{
+			name:    "unknown total",
+			p:       &progress{label: "Off-target kmer screen", unit: "chunks", done: 7},
+			wantBar: "Off-target kmer screen 7 chunks",
+			wantLog: `progress stage="Off-target kmer screen" done=7 unit=chunks elapsed=10s`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.p.setNote(tt.note)
+			if got := tt.p.barLine(10 * time.Second); got != tt.wantBar {
+				t.Errorf("barLine() = %q, want %q", got, tt.wantBar)
+			}
+			if got := tt.p.logLine(10 * time.Second); got != tt.wantLog {
+				t.Errorf("logLine() = %q, want %q", got, tt.wantLog)
+			}
+		})
+	}
+}
+
+func Test_newProgress(t *testing.T) {
+	defer func(out io.Writer, bar bool, barInterval, logInterval time.Duration) {
+		progressOutput, progressAsBar, progressBarInterval, progressLogInterval = out, bar, barInterval, logInterval
+	}(progressOutput, progressAsBar, progressBarInterval, progressLogInterval)
+
+	// Nothing is reported by default, and a nil progress is safe to use
+	progressOutput = nil
+	p := newProgress("Construct search", 10, "iterations")
+	if p != nil {
+		t.Fatalf("newProgress() = %v, want nil with no progress output", p)
+	}
+	p.add(1)
+	p.setNote("best score 1.0")
+	p.finish()
+
+	var buf bytes.Buffer
+	progressOutput, progressAsBar, progressLogInterval = &buf, false, time.Millisecond
+	p = newProgress("Construct search", 10, "iterations")
+	p.add(5)
+	time.Sleep(20 * time.Millisecond)
+	p.add(5)
+	p.finish()
+	if !strings.Contains(buf.String(), `progress stage="Construct search" done=5 total=10`) || !strings.Contains(buf.String(), "done=10 total=10") {
+		t.Errorf("newProgress() logged %q, want progress lines ending with the stage done", buf.String())
+	}
+
+	// A bar is cleared once done, but only if it was drawn
+	buf.Reset()
+	progressAsBar, progressBarInterval = true, time.Hour
+	p = newProgress("Construct search", 10, "iterations")
+	p.finish()
+	if buf.Len() != 0 {
+		t.Errorf("newProgress() drew %q for a quick stage, want nothing", buf.String())
+	}
+
+	// Reading through a progressReader counts the bytes read
+	progressOutput = io.Discard
+	p = newProgress("Off-target screen", 0, "bytes")
+	n, _ := io.Copy(io.Discard, &progressReader{strings.NewReader("ACGTACGT"), p})
+	p.finish()
+	if p.done != n || n != 8 {
+		t.Errorf("progressReader counted %d bytes, want %d", p.done, n)
+	}
+}
+
+func Test_setProgressMode(t *testing.T) {
+	defer func(out io.Writer, bar bool) {
+		progressOutput, progressAsBar = out, bar
+	}(progressOutput, progressAsBar)
+
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := setProgressMode("auto", f); err != nil || progressOutput == nil || progressAsBar {
+		t.Errorf("setProgressMode(auto) to a file = %v, want log lines", err)
+	}
+	if err := setProgressMode("bar", f); err != nil || !progressAsBar {
+		t.Errorf("setProgressMode(bar) = %v, want a bar", err)
+	}
+	if err := setProgressMode("none", f); err != nil || progressOutput != nil {
+		t.Errorf("setProgressMode(none) = %v, want no progress output", err)
+	}
+	if err := setProgressMode("verbose", f); err == nil {
+		t.Error("setProgressMode(verbose) = nil, want an error")
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// annealSchedule is a simulated annealing temperature schedule, cooling geometrically from t0 to t1 over a time
+// budget, or over a no. of steps when steps is set (the time budget then only caps the run)
+type annealSchedule struct {
+	t0, t1 float64       // initial and final temperature, in objective score units
+	budget time.Duration // 0 for no time limit
+	steps  int           // 0 for no step limit
+}
+
+// progress returns how far through the schedule a run is (>= 1 once it's over)
+func (s annealSchedule) progress(step int, elapsed time.Duration) float64 {
+	progress := 0.0
+	if s.steps > 0 {
+		progress = float64(step) / float64(s.steps)
+	}
+	if s.budget > 0 {
+		if elapsed >= s.budget {
+			return 1
+		}
+		if s.steps == 0 {
+			progress = float64(elapsed) / float64(s.budget)
+		}
+	}
+	return progress
+}
+
+// temperature returns the temperature at a point of the schedule
+func (s annealSchedule) temperature(progress float64) float64 {
+	return s.t0 * math.Pow(s.t1/s.t0, progress)
+}
+
+// refineStats summarizes a refinement run
+type refineStats struct {
+	steps, accepted, improved int
+	initial                   float64 // score of the construct refined
+}
+
+// refiner perturbs and re-scores constructs of target kmers
+type refiner struct {
+	goodKmers *kmerTable
+	kmerCts   []float64 // abundance of each kmer, by row (negative if it can't be used)
+	ref       []*HeaderRef
+	p         searchParams
+	r         *rand.Rand
+}
+
+// refineConstruct refines a construct by simulated annealing.  Each step perturbs the construct - taking an alternate
+// branch at a de Bruijn graph fork, shifting the window, or splicing in the path of a target sharing one of its kmers
+// - and accepts the result if it scores higher, or with probability exp(change / temperature) if not.  Perturbed
+// constructs are made of unused target kmers and must meet the min. kmer hits and composition constraints.  Returns the
+// best construct seen, once the schedule is done or the search's context is cancelled.
+func refineConstruct(goodKmers *kmerTable, kmerCts []float64, ref []*HeaderRef, c *construct, p searchParams, sched annealSchedule) (*construct, refineStats) {
+	rf := &refiner{goodKmers: goodKmers, kmerCts: kmerCts, ref: ref, p: p, r: rand.New(rand.NewSource(p.seed))}
+	stats := refineStats{initial: c.score}
+	best, cur := c, c
+	start := time.Now()
+	for ; ; stats.steps++ {
+		progress := sched.progress(stats.steps, time.Since(start))
+		if progress >= 1 || (stats.steps%256 == 0 && p.cancelled()) {
+			break
+		}
+		seq, ok := rf.perturb(cur.seq)
+		if !ok {
+			continue
+		}
+		cand := rf.score(seq)
+		if cand == nil {
+			continue
+		}
+		delta := cand.score - cur.score
+		if delta < 0 && rf.r.Float64() >= math.Exp(delta/sched.temperature(progress)) {
+			continue
+		}
+		cur = cand
+		stats.accepted++
+		if cand.score > best.score {
+			best = cand
+			stats.improved++
+		}
+	}
+	return best, stats
+}
+
+// score returns the construct for seq, scored as in the greedy search, or nil if it breaks the min. kmer hits or
+// composition constraints
+func (rf *refiner) score(seq string) *construct {
+	hits := constructHits(rf.goodKmers, seq)
+	var weighted []float64
+	if rf.p.kmerWeights != nil {
+		weighted = make([]float64, rf.goodKmers.seqLen)
+		for _, row := range rf.goodKmers.rows(seq) {
+			if row >= 0 {
+				rf.goodKmers.addWeightedHits(row, weighted, rf.p.kmerWeights[row])
+			}
+		}
+	}
+	score, ok := windowScore(rf.p, hits, weighted)
+	if !ok || !rf.p.constraints.satisfied(seq) {
+		return nil
+	}
+	return &construct{kmerHits: hits, score: score, seq: seq}
+}
+
+// abundance returns the abundance of a kmer, or false if it isn't a target kmer constructs can be built from
+func (rf *refiner) abundance(kmer string) (float64, bool) {
+	row, ok := rf.goodKmers.lookup(kmer)
+	if !ok || rf.kmerCts[row] < 0 {
+		return 0, false
+	}
+	return rf.kmerCts[row], true
+}
+
+// perturb returns a random perturbation of seq of the same length, or false if the chosen perturbation isn't possible
+func (rf *refiner) perturb(seq string) (string, bool) {
+	k := rf.p.kmerLen
+	numKmers := len(seq) - k + 1
+	forward := rf.r.Intn(2) == 0
+	switch rf.r.Intn(3) {
+	case 0:
+		// Take an alternate branch at a fork, then extend back to full length
+		if numKmers < 2 {
+			return "", false
+		}
+		if forward {
+			kept := seq[:k+rf.r.Intn(numKmers-1)]
+			used := rf.kmerSet(kept)
+			next := rf.pick(kept[len(kept)-k+1:], used, true, seq[len(kept)])
+			if next == "" {
+				return "", false
+			}
+			used[next] = struct{}{}
+			return rf.extendf(kept+next[k-1:], len(seq), used, "")
+		}
+		kept := seq[1+rf.r.Intn(numKmers-1):]
+		used := rf.kmerSet(kept)
+		next := rf.pick(kept[:k-1], used, false, seq[len(seq)-len(kept)-1])
+		if next == "" {
+			return "", false
+		}
+		used[next] = struct{}{}
+		return rf.extendr(next[:1]+kept, len(seq), used, "")
+	case 1:
+		// Shift the window up to a kmer length along
+		shift := 1 + rf.r.Intn(k)
+		if shift >= numKmers {
+			return "", false
+		}
+		if forward {
+			kept := seq[shift:]
+			return rf.extendf(kept, len(seq), rf.kmerSet(kept), "")
+		}
+		kept := seq[:len(seq)-shift]
+		return rf.extendr(kept, len(seq), rf.kmerSet(kept), "")
+	default:
+		// Splice in the path of a target sharing a kmer, from that kmer on
+		i := rf.r.Intn(numKmers)
+		kmer := seq[i : i+k]
+		var guides []string
+		for _, hr := range rf.ref {
+			for offset := 0; ; {
+				pos := strings.Index(hr.Seq[offset:], kmer)
+				if pos < 0 {
+					break
+				}
+				pos += offset
+				if forward {
+					guides = append(guides, hr.Seq[pos+k:])
+				} else {
+					guides = append(guides, hr.Seq[:pos])
+				}
+				offset = pos + 1
+			}
+		}
+		if len(guides) == 0 {
+			return "", false
+		}
+		guide := guides[rf.r.Intn(len(guides))]
+		var spliced string
+		var ok bool
+		if forward {
+			kept := seq[:i+k]
+			spliced, ok = rf.extendf(kept, len(seq), rf.kmerSet(kept), guide)
+		} else {
+			kept := seq[i:]
+			spliced, ok = rf.extendr(kept, len(seq), rf.kmerSet(kept), guide)
+		}
+		return spliced, ok && spliced != seq
+	}
+}
+
+// kmerSet returns the set of kmers of seq, sized for a construct of the search's length
+func (rf *refiner) kmerSet(seq string) map[string]struct{} {
+	kmerLen := rf.p.kmerLen
+	kmers := make(map[string]struct{}, rf.p.constructLen-kmerLen+1)
+	for i := 0; i <= len(seq)-kmerLen; i++ {
+		kmers[seq[i:i+kmerLen]] = struct{}{}
+	}
+	return kmers
+}
+
+// pick returns a random unused target kmer extending sub (forward) or preceding it, chosen in proportion to kmer
+// abundance and skipping the nucleotide exclude (0 for none), or "" if there is none
+func (rf *refiner) pick(sub string, used map[string]struct{}, forward bool, exclude byte) string {
+	var kmers []string
+	var cts []float64
+	var total float64
+	for _, nuc := range []byte("ACGT") {
+		if nuc == exclude {
+			continue
+		}
+		kmer := sub + string(nuc)
+		if !forward {
+			kmer = string(nuc) + sub
+		}
+		ct, ok := rf.abundance(kmer)
+		if !ok {
+			continue
+		}
+		if _, ok := used[kmer]; ok {
+			continue
+		}
+		kmers = append(kmers, kmer)
+		cts = append(cts, ct)
+		total += ct
+	}
+	if len(kmers) == 0 {
+		return ""
+	}
+	x := rf.r.Float64() * total
+	for i, kmer := range kmers {
+		if x -= cts[i]; x < 0 {
+			return kmer
+		}
+	}
+	return kmers[len(kmers)-1]
+}
+
+// extendf extends seq forward to n nt through unused target kmers, following guide (the sequence to continue with,
+// "" for none) while its kmers are unused target kmers, then picking each nucleotide at random
+func (rf *refiner) extendf(seq string, n int, used map[string]struct{}, guide string) (string, bool) {
+	k := rf.p.kmerLen
+	var sb strings.Builder
+	sb.Grow(n)
+	sb.WriteString(seq)
+	sub := seq[len(seq)-k+1:]
+	for length := len(seq); length < n; length++ {
+		next := ""
+		if guide != "" {
+			kmer := sub + guide[:1]
+			_, good := rf.abundance(kmer)
+			_, dup := used[kmer]
+			if good && !dup {
+				next = kmer
+				guide = guide[1:]
+			} else {
+				guide = ""
+			}
+		}
+		if next == "" {
+			if next = rf.pick(sub, used, true, 0); next == "" {
+				return "", false
+			}
+		}
+		used[next] = struct{}{}
+		sb.WriteByte(next[k-1])
+		sub = next[1:]
+	}
+	return sb.String(), true
+}
+
+// extendr extends seq backward to n nt, as for extendf with guide the sequence to precede it with
+func (rf *refiner) extendr(seq string, n int, used map[string]struct{}, guide string) (string, bool) {
+	k := rf.p.kmerLen
+	added := make([]byte, n-len(seq)) // filled from the end
+	sub := seq[:k-1]
+	for i := len(added) - 1; i >= 0; i-- {
+		next := ""
+		if guide != "" {
+			kmer := guide[len(guide)-1:] + sub
+			_, good := rf.abundance(kmer)
+			_, dup := used[kmer]
+			if good && !dup {
+				next = kmer
+				guide = guide[:len(guide)-1]
+			} else {
+				guide = ""
+			}
+		}
+		if next == "" {
+			if next = rf.pick(sub, used, false, 0); next == "" {
+				return "", false
+			}
+		}
+		used[next] = struct{}{}
+		added[i] = next[0]
+		sub = next[:k-1]
+	}
+	return string(added) + seq, true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func Test_annealSchedule(t *testing.T) {
+	s := annealSchedule{t0: 10, t1: 0.1, steps: 100}
+	if got := s.temperature(0.5); math.Abs(got-1) > 1e-9 {
+		t.Errorf("temperature(0.5) = %v, want 1", got)
+	}
+	if got := s.progress(25, time.Hour); got != 0.25 {
+		t.Errorf("progress() = %v, want 0.25 with no time budget", got)
+	}
+	s.budget = time.Minute
+	if got := s.progress(25, 2*time.Minute); got != 1 {
+		t.Errorf("progress() = %v, want 1 once the time budget is spent", got)
+	}
+	s.steps = 0
+	if got := s.progress(1000, 15*time.Second); got != 0.25 {
+		t.Errorf("progress() = %v, want 0.25 of the time budget", got)
+	}
+}
+
+func Test_refinerPerturb(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	ref := randomTargets(r, 3, 200, 12)
+	goodKmers, _ := getKmers(ref, 9)
+	p := searchParams{kmerLen: 9, seqLen: 3, constructLen: 60, iterations: 3, seed: 1}
+	c := conBestConstruct(goodKmers, kmerAbun(goodKmers, nil), p)
+	rf := &refiner{goodKmers: goodKmers, kmerCts: kmerAbun(goodKmers, nil), ref: ref, p: p, r: r}
+	changed := 0
+	for i := 0; i < 500; i++ {
+		seq, ok := rf.perturb(c.seq)
+		if !ok {
+			continue
+		}
+		if seq != c.seq {
+			changed++
+		}
+		if len(seq) != len(c.seq) {
+			t.Fatalf("perturb() = %s, want %d nt", seq, len(c.seq))
+		}
+		seen := make(map[string]bool)
+		for j := 0; j <= len(seq)-p.kmerLen; j++ {
+			kmer := seq[j : j+p.kmerLen]
+			if !goodKmers.has(kmer) || seen[kmer] {
+				t.Fatalf("perturb() = %s has a repeated or non-target kmer %s", seq, kmer)
+			}
+			seen[kmer] = true
+		}
+	}
+	if changed == 0 {
+		t.Error("perturb() never changed the construct")
+	}
+}
+
+func Test_refineConstruct(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	ref := randomTargets(r, 4, 300, 20)
+	goodKmers, _ := getKmers(ref, 9)
+	kmerCts := kmerAbun(goodKmers, nil)
+	obj, _ := newObjective("min", nil)
+	constraints, _ := newSeqConstraints(4, 50, 0, 100, "", 80)
+	p := searchParams{kmerLen: 9, seqLen: 4, constructLen: 80, iterations: 1, seed: 4, obj: obj, minHits: []int{10, 10, 10, 10}, constraints: constraints}
+	c := conBestConstruct(goodKmers, kmerCts, p)
+	if c == nil {
+		t.Fatal("conBestConstruct() found no construct")
+	}
+	sched := annealSchedule{t0: 2, t1: 0.01, steps: 3000}
+	got, stats := refineConstruct(goodKmers, kmerCts, ref, c, p, sched)
+	if got.score < c.score || stats.initial != c.score || stats.steps != 3000 {
+		t.Errorf("refineConstruct() score = %v (stats %+v), want >= %v", got.score, stats, c.score)
+	}
+	if len(got.seq) != p.constructLen || !constraints.satisfied(got.seq) {
+		t.Errorf("refineConstruct() = %s, want a %d nt construct meeting the constraints", got.seq, p.constructLen)
+	}
+	rescored := scoreConstruct(goodKmers, got.seq, p)
+	if rescored.score != got.score {
+		t.Errorf("refineConstruct() score = %v, rescored %v", got.score, rescored.score)
+	}
+	for i, hits := range rescored.kmerHits {
+		if hits < p.minHits[i] {
+			t.Errorf("refineConstruct() has %d hits to target %d, want >= %d", hits, i, p.minHits[i])
+		}
+	}
+	again, _ := refineConstruct(goodKmers, kmerCts, ref, c, p, sched)
+	if again.seq != got.seq {
+		t.Error("refineConstruct() differs between runs with the same seed and step schedule")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.ctx = ctx
+	if got, stats := refineConstruct(goodKmers, kmerCts, ref, c, p, sched); got != c || stats.steps != 0 {
+		t.Errorf("refineConstruct() once cancelled ran %d steps, want 0", stats.steps)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Guide strand seed region (positions 2-8, 1-based), which dominates siRNA off-target activity
+const (
+	seedRegionStart = 1
+	seedRegionLen   = 7
+)
+
+// otPolicy controls how target kmers are matched against off-target sequences
+type otPolicy struct {
+	kmerLen       int  // off-target match length; sub-kmers are matched when less than the target kmer length
+	maxMismatches int  // max. Hamming distance tolerated for an off-target match
+	seedOnly      bool // match only the seed region plus seedExtra 3' positions of each strand as guide
+	seedExtra     int  // no. of guide positions 3' of the seed region included in a seed match
+	wobble        bool // also match off-targets differing only by G:U wobble-compatible transitions (not with seedOnly)
+}
+
+// matchKmers returns the sequences to match against off-targets for the policy, mapped to the target kmers they were
+// derived from, along with their length.  A nil map is returned when whole target kmers are matched exactly.
+func (p otPolicy) matchKmers(goodKmers *kmerTable, kmerLen int) (map[string][]string, int) {
+	switch {
+	case p.seedOnly:
+		return GenerateSeedRegionKmersMap(goodKmers.kmers(), p.seedExtra), seedRegionLen + p.seedExtra
+	case p.kmerLen < kmerLen || p.maxMismatches > 0 || p.wobble:
+		return GenerateSubKmersMap(goodKmers.kmers(), p.kmerLen), p.kmerLen
+	default:
+		return nil, kmerLen
+	}
+}
+
+// validateSeedRegion checks the seed region plus seedExtra 3' positions fits within the target kmer length
+func validateSeedRegion(kmerLen int, seedExtra int) error {
+	if seedExtra < 0 {
+		return fmt.Errorf("no. of 3' positions past the seed region (%d) must be >= 0", seedExtra)
+	}
+	if seedRegionStart+seedRegionLen+seedExtra > kmerLen {
+		return fmt.Errorf("seed region plus %d 3' positions (guide positions %d-%d) exceeds kmer length (%d)",
+			seedExtra, seedRegionStart+1, seedRegionStart+seedRegionLen+seedExtra, kmerLen)
+	}
+	return nil
+}
+
+// GenerateSeedRegionKmersMap creates a map where keys are the seed region (guide positions 2-8) plus seedExtra 3' positions of
+// each target kmer, and values are lists of the target kmers they were derived from.  Either strand of the dsRNA can be loaded into
+// RISC, so both the kmer and its reverse complement are treated as the guide strand.
+//
+// Args:
+//
+//	goodKmers: The target kmers.
+//	seedExtra: The no. of guide positions 3' of the seed region to include.
+//
+// Returns:
+//
+//	A map[string][]string where keys are seed region sequences and values are lists of the target kmers they were derived from.
+func GenerateSeedRegionKmersMap(goodKmers []string, seedExtra int) map[string][]string {
+	seedKmers := make(map[string][]string)
+	end := seedRegionStart + seedRegionLen + seedExtra
+	for _, kmer := range goodKmers {
+		if len(kmer) < end {
+			continue
+		}
+		for _, guide := range []string{kmer, reverseComplement(kmer)} {
+			seed := guide[seedRegionStart:end]
+			seedKmers[seed] = append(seedKmers[seed], kmer)
+		}
+	}
+	return seedKmers
+}
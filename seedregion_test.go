@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateSeedRegionKmersMap(t *testing.T) {
+	tests := []struct {
+		name      string
+		goodKmers []string
+		seedExtra int
+		want      map[string][]string
+	}{
+		{
+			name:      "bothStrands",
+			goodKmers: []string{"AACCGGTTAC"},
+			seedExtra: 1,
+			want: map[string][]string{
+				"ACCGGTTA": {"AACCGGTTAC"}, // kmer as guide
+				"TAACCGGT": {"AACCGGTTAC"}, // reverse complement (GTAACCGGTT) as guide
+			},
+		},
+		{
+			name:      "kmerTooShort",
+			goodKmers: []string{"ACGTACG"},
+			seedExtra: 0,
+			want:      map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GenerateSeedRegionKmersMap(tt.goodKmers, tt.seedExtra); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GenerateSeedRegionKmersMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateSeedRegion(t *testing.T) {
+	tests := []struct {
+		name      string
+		kmerLen   int
+		seedExtra int
+		wantErr   bool
+	}{
+		{name: "fits", kmerLen: 21, seedExtra: 4, wantErr: false},
+		{name: "fitsExactly", kmerLen: 21, seedExtra: 13, wantErr: false},
+		{name: "tooLong", kmerLen: 21, seedExtra: 14, wantErr: true},
+		{name: "negative", kmerLen: 21, seedExtra: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSeedRegion(tt.kmerLen, tt.seedExtra); (err != nil) != tt.wantErr {
+				t.Errorf("validateSeedRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConcurrentlyProcessSequencesSeed checks a seed region match removes a kmer that has no full-length off-target match
+func TestConcurrentlyProcessSequencesSeed(t *testing.T) {
+	refFile := createTempFastaFile([]string{">ot1", "TTTTACCGGTTTTTT"}, t) // contains seed ACCGGTT of AACCGGTTAC
+	defer os.Remove(refFile)
+
+	tests := []struct {
+		name   string
+		policy otPolicy
+		want   []string
+	}{
+		{name: "full", policy: otPolicy{kmerLen: 10}, want: []string{"AACCGGTTAC", "CCCCCCCCCC"}},
+		{name: "seed", policy: otPolicy{kmerLen: 10, seedOnly: true}, want: []string{"CCCCCCCCCC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodKmers := testKmerTable(map[string][]int{"AACCGGTTAC": {1}, "CCCCCCCCCC": {1}})
+			ConcurrentlyProcessSequences([]string{refFile}, goodKmers, 10, tt.policy, nil)
+			if goodKmers.len() != len(tt.want) {
+				t.Errorf("got %d goodKmers; want %d", goodKmers.len(), len(tt.want))
+			}
+			for _, kmer := range tt.want {
+				if !goodKmers.has(kmer) {
+					t.Errorf("expected kmer %s to be present; it was not", kmer)
+				}
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"errors"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // HeaderRef is a struct comprising a reference sequence header, seques and reverse complement
@@ -16,61 +19,156 @@ type HeaderRef struct {
 	ReverseSeq string
 }
 
-// RefLoad loads a reference sequence DNA file (FASTA format).
+// RefLoad loads a reference sequence DNA file (FASTA or FASTQ format, optionally gzip/bgzip or zstd compressed).
 // It returns a slice of HeaderRef structs (individual reference header, sequence and reverse complement).
 // Lower case nucleotides are converted to uppercase.
 func RefLoad(refFile string) []*HeaderRef {
 	var refSlice []*HeaderRef
-	var singleHeaderRef *HeaderRef
-	var header string
-	var refSeq bytes.Buffer
-	f, err := os.Open(refFile)
+	f, err := openSeqFile(refFile)
 	if err != nil {
 		fmt.Println("Problem opening fasta reference file " + refFile)
 		errorShutdown()
 	}
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		fastaLine := scanner.Text()
-		switch {
-		case strings.HasPrefix(fastaLine, ">"):
-			seq := refSeq.String()
-			singleHeaderRef = &HeaderRef{header, seq, reverseComplement(seq)}
-			refSlice = append(refSlice, singleHeaderRef)
-			header = fastaLine[1:]
-			refSeq.Reset()
-		case len(fastaLine) != 0:
-			refSeq.WriteString(strings.ToUpper(fastaLine))
-		}
+	defer f.Close()
+	err = readSeqRecords(f, func(header string, seq string) {
+		refSlice = append(refSlice, &HeaderRef{header, seq, reverseComplement(seq)})
+	})
+	if err != nil {
+		fmt.Println("Problem reading reference file "+refFile+":", err)
+		errorShutdown()
 	}
-	seq := refSeq.String()
-	singleHeaderRef = &HeaderRef{header, seq, reverseComplement(seq)}
-	refSlice = append(refSlice, singleHeaderRef)
-	refSlice = refSlice[1:]
 	fmt.Println("     --->", len(refSlice), "sequences loaded")
-	f.Close()
 	return refSlice
 }
 
-// biasMod adds additional copies of the selected HeaderRef to a new HeaderREf slice.
-// This biases kmer selection toward that HeaderRef at the cost of the overall geomean
-func biasMod(ref []*HeaderRef, header string, bias int) ([]*HeaderRef, error) {
-	var biasRef []*HeaderRef
-	headerPresent := false
-	for _, hr := range ref {
-		biasRef = append(biasRef, hr)
-		if hr.Header == header {
-			headerPresent = true
-			for i := 0; i < bias; i++ {
-				biasRef = append(biasRef, hr)
+// Magic bytes used to detect compressed sequence files.  bgzip files are
+// multi-member gzip files and share the gzip magic bytes.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// maxSeqLineLen is the longest single line accepted in a sequence file (unwrapped chromosomes can be long)
+const maxSeqLineLen = 1 << 30
+
+// seqFileReader wraps an opened sequence file and any decompressor reading from it
+type seqFileReader struct {
+	io.Reader
+	file *os.File
+	dec  io.Closer
+}
+
+// Close closes the decompressor (if any) and the underlying file
+func (s *seqFileReader) Close() error {
+	if s.dec != nil {
+		s.dec.Close()
+	}
+	return s.file.Close()
+}
+
+// openSeqFile opens a sequence file for reading.  gzip/bgzip and zstd compressed files are detected
+// by their magic bytes and stream-decompressed transparently; anything else is read as plain text.
+func openSeqFile(fileName string) (io.ReadCloser, error) {
+	return openSeqFileProgress(fileName, nil)
+}
+
+// openSeqFileProgress opens a sequence file as for openSeqFile, adding the (compressed) bytes read to prog
+func openSeqFileProgress(fileName string, prog *progress) (io.ReadCloser, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	if prog != nil {
+		r = &progressReader{f, prog}
+	}
+	br := bufio.NewReaderSize(r, 64*1024)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("error reading gzip header: %v", err)
+		}
+		return &seqFileReader{gz, f, gz}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("error reading zstd header: %v", err)
+		}
+		dec := zr.IOReadCloser()
+		return &seqFileReader{dec, f, dec}, nil
+	default:
+		return &seqFileReader{br, f, nil}, nil
+	}
+}
+
+// readSeqRecords reads FASTA or FASTQ records from r, calling fn with the header and upper case sequence of each record.
+// The format is detected from the first non-empty line ('>' for FASTA, '@' for FASTQ).  FASTQ records must be 4 lines
+// (header, sequence, '+' separator, quality); quality scores are ignored.  FASTA lines before the first header are skipped.
+func readSeqRecords(r io.Reader, fn func(header string, seq string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSeqLineLen)
+	var header string
+	var refSeq strings.Builder
+	detected, isFastq, inRecord := false, false, false
+	truncated := func() error {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("truncated FASTQ record %q", header)
+	}
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if !detected {
+			if len(line) == 0 {
+				continue
+			}
+			detected = true
+			isFastq = line[0] == '@'
+		}
+		if isFastq {
+			if len(line) == 0 {
+				continue
+			}
+			if line[0] != '@' {
+				return fmt.Errorf("malformed FASTQ record: expected '@' header line, got %q", line)
+			}
+			header = line[1:]
+			if !scanner.Scan() {
+				return truncated()
+			}
+			seq := strings.ToUpper(strings.TrimSuffix(scanner.Text(), "\r"))
+			if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "+") {
+				return fmt.Errorf("malformed FASTQ record %q: expected '+' separator line", header)
+			}
+			if !scanner.Scan() {
+				return truncated()
 			}
+			fn(header, seq)
+			continue
 		}
+		switch {
+		case strings.HasPrefix(line, ">"):
+			if inRecord {
+				fn(header, refSeq.String())
+			}
+			header = line[1:]
+			refSeq.Reset()
+			inRecord = true
+		case len(line) != 0 && inRecord:
+			refSeq.WriteString(strings.ToUpper(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
 	}
-	if headerPresent {
-		return biasRef, nil
-	} else {
-		return biasRef, errors.New("bias reference header not present in input file")
+	if inRecord {
+		fn(header, refSeq.String())
 	}
+	return nil
 }
 
 // Reverse complementary DNA sequence
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// siRNACoreLen is the length of the siRNA duplex region scored by the efficacy rules
+const siRNACoreLen = 19
+
+// siRNAScorerNames lists the supported siRNA efficacy scorers
+var siRNAScorerNames = []string{"reynolds", "uitei"}
+
+// siRNAScorer predicts the silencing efficacy of the siRNA whose guide strand is complementary to a target kmer.
+// Scorers see the 19 nt duplex region as the sense (target) strand - the last 19 nt of the kmer, as the guide's 5'
+// end pairs with the kmer's 3' end.
+type siRNAScorer interface {
+	name() string
+	score(core string) float64 // predicted efficacy, from 0 (worst) to 1 (best)
+}
+
+// newSiRNAScorer returns the named siRNA efficacy scorer
+func newSiRNAScorer(name string) (siRNAScorer, error) {
+	switch name {
+	case "reynolds":
+		return reynoldsScorer{}, nil
+	case "uitei":
+		return uiTeiScorer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown siRNA scorer '%s' - must be one of %s", name, strings.Join(siRNAScorerNames, ", "))
+	}
+}
+
+// siRNAEfficacy scores the siRNAs of target kmers for a run, and sets whether efficacy weights kmer hits in the objective
+type siRNAEfficacy struct {
+	scorer   siRNAScorer
+	weighted bool
+}
+
+// newSiRNAEfficacy returns the siRNA efficacy settings for a run, or nil if efficacy isn't scored - the scorer is
+// "none", or kmers are shorter than an siRNA duplex and efficacy weighting wasn't requested.
+func newSiRNAEfficacy(name string, weighted bool, kmerLen int) (*siRNAEfficacy, error) {
+	if name == "none" {
+		if weighted {
+			return nil, fmt.Errorf("siRNA efficacy weighting needs an siRNA scorer (%s)", strings.Join(siRNAScorerNames, ", "))
+		}
+		return nil, nil
+	}
+	scorer, err := newSiRNAScorer(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSiRNAKmerLen(kmerLen); err != nil {
+		if weighted {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &siRNAEfficacy{scorer: scorer, weighted: weighted}, nil
+}
+
+// kmerScore returns the predicted efficacy of the siRNA for a kmer of at least siRNACoreLen nt
+func (e *siRNAEfficacy) kmerScore(kmer string) float64 {
+	return e.scorer.score(kmer[len(kmer)-siRNACoreLen:])
+}
+
+// kmerWeights returns the predicted efficacy of each kmer, by kmer table row, to weight its hits in the objective
+func (e *siRNAEfficacy) kmerWeights(goodKmers *kmerTable) []float64 {
+	weights := make([]float64, len(goodKmers.keys))
+	for row := range weights {
+		if !goodKmers.removed[row] {
+			weights[row] = e.kmerScore(goodKmers.kmer(int32(row)))
+		}
+	}
+	return weights
+}
+
+// validateSiRNAKmerLen checks kmers are long enough to contain a scored siRNA duplex region
+func validateSiRNAKmerLen(kmerLen int) error {
+	if kmerLen < siRNACoreLen {
+		return fmt.Errorf("kmer length (%d) must be >= %d for siRNA efficacy scoring", kmerLen, siRNACoreLen)
+	}
+	return nil
+}
+
+// isWeak reports whether a nucleotide is A or T (U)
+func isWeak(nuc byte) bool {
+	return nuc == 'A' || nuc == 'T'
+}
+
+// reynoldsScorer implements the rational siRNA design criteria of Reynolds et al. (2004), scaled from the raw
+// score range (-2 to 10) to 0-1.  Positions are 1-based on the sense strand of the 19 nt duplex.
+type reynoldsScorer struct{}
+
+func (reynoldsScorer) name() string { return "Reynolds" }
+
+func (reynoldsScorer) score(core string) float64 {
+	raw := 0
+	// GC content of 30-52%
+	if gc := gcContent(core); gc >= 30 && gc <= 52 {
+		raw++
+	}
+	// A/U at positions 15-19, which gives the guide strand the less stable 5' end
+	for i := 14; i < 19; i++ {
+		if isWeak(core[i]) {
+			raw++
+		}
+	}
+	// No internal repeats that could form secondary structure
+	if !hasInternalRepeat(core) {
+		raw++
+	}
+	if core[18] == 'A' {
+		raw++
+	}
+	if core[2] == 'A' {
+		raw++
+	}
+	if core[9] == 'T' {
+		raw++
+	}
+	if core[18] == 'G' || core[18] == 'C' {
+		raw--
+	}
+	if core[12] == 'G' {
+		raw--
+	}
+	return float64(raw+2) / 12
+}
+
+// uiTeiScorer implements the class I siRNA criteria of Ui-Tei et al. (2004), scored as the fraction met: A/U at the
+// guide 5' end, G/C at the sense 5' end, at least 5 A/U in the guide's 5' 7 nt, and no G/C stretch longer than 9 nt.
+type uiTeiScorer struct{}
+
+func (uiTeiScorer) name() string { return "Ui-Tei" }
+
+func (uiTeiScorer) score(core string) float64 {
+	met := 0
+	if isWeak(core[18]) {
+		met++
+	}
+	if !isWeak(core[0]) {
+		met++
+	}
+	weak := 0
+	for i := 12; i < 19; i++ {
+		if isWeak(core[i]) {
+			weak++
+		}
+	}
+	if weak >= 5 {
+		met++
+	}
+	if longestStrongRun(core) <= 9 {
+		met++
+	}
+	return float64(met) / 4
+}
+
+// longestStrongRun returns the length of the longest stretch of G/C in a sequence
+func longestStrongRun(seq string) int {
+	longest, run := 0, 0
+	for i := 0; i < len(seq); i++ {
+		if isWeak(seq[i]) {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// hasInternalRepeat approximates Reynolds' internal repeat criterion: a homopolymer run of 4+ nt, or a 5 nt inverted
+// repeat able to form a hairpin stem
+func hasInternalRepeat(seq string) bool {
+	run := 1
+	for i := 1; i < len(seq); i++ {
+		if seq[i] == seq[i-1] {
+			run++
+			if run >= 4 {
+				return true
+			}
+		} else {
+			run = 1
+		}
+	}
+	const stemLen = 5
+	// A loop of at least 3 nt separates the stem's arms
+	for i := 0; i+2*stemLen+3 <= len(seq); i++ {
+		if strings.Contains(seq[i+stemLen+3:], reverseComplement(seq[i:i+stemLen])) {
+			return true
+		}
+	}
+	return false
+}
+
+// efficacyStats returns the mean siRNA efficacy of each target's matching kmers, and the fraction with low (< 1/3),
+// mid and high (>= 2/3) efficacy
+func efficacyStats(kmersForInput [][]string, eff *siRNAEfficacy) ([]float64, [][3]float64) {
+	means := make([]float64, len(kmersForInput))
+	dists := make([][3]float64, len(kmersForInput))
+	for i, kmers := range kmersForInput {
+		if len(kmers) == 0 {
+			continue
+		}
+		for _, kmer := range kmers {
+			s := eff.kmerScore(kmer)
+			means[i] += s
+			switch {
+			case s < 1.0/3:
+				dists[i][0]++
+			case s < 2.0/3:
+				dists[i][1]++
+			default:
+				dists[i][2]++
+			}
+		}
+		means[i] /= float64(len(kmers))
+		for j := range dists[i] {
+			dists[i][j] /= float64(len(kmers))
+		}
+	}
+	return means, dists
+}
+
+// efficacyColumns returns the results table headers and per-target values for the siRNA efficacy of matching kmers
+func efficacyColumns(kmersForInput [][]string, eff *siRNAEfficacy) ([]string, [][]string) {
+	headers := []string{eff.scorer.name() + " efficacy (mean)", eff.scorer.name() + " efficacy low/mid/high (%)"}
+	means, dists := efficacyStats(kmersForInput, eff)
+	cols := make([][]string, len(kmersForInput))
+	for i := range kmersForInput {
+		cols[i] = []string{
+			strconv.FormatFloat(means[i], 'f', 2, 64),
+			strconv.FormatFloat(dists[i][0]*100, 'f', 0, 64) + "/" + strconv.FormatFloat(dists[i][1]*100, 'f', 0, 64) + "/" +
+				strconv.FormatFloat(dists[i][2]*100, 'f', 0, 64),
+		}
+	}
+	return headers, cols
+}
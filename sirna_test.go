@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_siRNAScorers(t *testing.T) {
+	tests := []struct {
+		core    string
+		reynold float64
+		uiTei   float64
+	}{
+		{"ACGATCAGTCATGCTAGCA", 7.0 / 12, 0.5},
+		{"AAAAAAAAAAAAAAAAAAA", 9.0 / 12, 0.75},
+		{"GCGCGCGCGCGCGCGCGCG", 0, 0.25},
+	}
+	for _, tt := range tests {
+		if got := (reynoldsScorer{}).score(tt.core); math.Abs(got-tt.reynold) > 1e-9 {
+			t.Errorf("reynoldsScorer.score(%s) = %v, want %v", tt.core, got, tt.reynold)
+		}
+		if got := (uiTeiScorer{}).score(tt.core); math.Abs(got-tt.uiTei) > 1e-9 {
+			t.Errorf("uiTeiScorer.score(%s) = %v, want %v", tt.core, got, tt.uiTei)
+		}
+	}
+}
+
+func Test_hasInternalRepeat(t *testing.T) {
+	tests := []struct {
+		seq  string
+		want bool
+	}{
+		{"ACGATCAGTCATGCTAGCA", false},
+		{"ACGATTTTGCA", true},     // homopolymer
+		{"GACTTGCAGTCAAGT", true}, // ACTTG ... CAAGT stem
+		{"ACTTGCACAAGT", false},   // stem loop too short
+		{"AACCAGGTTCAGGCCCAGC", false},
+	}
+	for _, tt := range tests {
+		if got := hasInternalRepeat(tt.seq); got != tt.want {
+			t.Errorf("hasInternalRepeat(%s) = %v, want %v", tt.seq, got, tt.want)
+		}
+	}
+}
+
+func Test_longestStrongRun(t *testing.T) {
+	if got := longestStrongRun("AGCGATGCCCGCGTA"); got != 7 {
+		t.Errorf("longestStrongRun() = %d, want 7", got)
+	}
+	if got := longestStrongRun("ATTA"); got != 0 {
+		t.Errorf("longestStrongRun() = %d, want 0", got)
+	}
+}
+
+func Test_newSiRNAEfficacy(t *testing.T) {
+	tests := []struct {
+		name     string
+		scorer   string
+		weighted bool
+		kmerLen  int
+		wantNil  bool
+		wantErr  bool
+	}{
+		{"reynolds", "reynolds", false, 21, false, false},
+		{"uitei weighted", "uitei", true, 19, false, false},
+		{"none", "none", false, 21, true, false},
+		{"none weighted", "none", true, 21, true, true},
+		{"unknown scorer", "foo", false, 21, true, true},
+		{"short kmers", "reynolds", false, 15, true, false},
+		{"short kmers weighted", "reynolds", true, 15, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSiRNAEfficacy(tt.scorer, tt.weighted, tt.kmerLen)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSiRNAEfficacy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("newSiRNAEfficacy() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_efficacyStats(t *testing.T) {
+	eff := &siRNAEfficacy{scorer: uiTeiScorer{}}
+	kmers := [][]string{
+		// Scored on the last 19 nt: 0.75, 0.5 and 0.25
+		{"CCAAAAAAAAAAAAAAAAAAA", "GGACGATCAGTCATGCTAGCA", "GCGCGCGCGCGCGCGCGCGCG"},
+		nil,
+	}
+	means, dists := efficacyStats(kmers, eff)
+	if math.Abs(means[0]-0.5) > 1e-9 || means[1] != 0 {
+		t.Errorf("efficacyStats() means = %v, want [0.5 0]", means)
+	}
+	third := 1.0 / 3
+	if math.Abs(dists[0][0]-third) > 1e-9 || math.Abs(dists[0][1]-third) > 1e-9 || math.Abs(dists[0][2]-third) > 1e-9 {
+		t.Errorf("efficacyStats() dists = %v, want a third in each", dists[0])
+	}
+}
+
+func Test_bestConstructKmerWeights(t *testing.T) {
+	// Two equally covered halves - weighting the second half's kmers picks it
+	ref := []*HeaderRef{{Header: "ref_1", Seq: "AAAACCCCGGGGTTTTA"}}
+	goodKmers, _ := getKmers(ref, 4)
+	p := searchParams{kmerLen: 4, seqLen: 1, constructLen: 8, obj: objective{name: "median"}}
+	p.kmerWeights = make([]float64, len(goodKmers.keys))
+	for row := range p.kmerWeights {
+		p.kmerWeights[row] = 0.1
+	}
+	for _, kmer := range []string{"GGGG", "GGGT", "GGTT", "GTTT", "TTTT"} {
+		row, _ := goodKmers.lookup(kmer)
+		p.kmerWeights[row] = 1
+	}
+	got, err := bestConstruct(goodKmers, ref[0].Seq, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.seq != "GGGGTTTT" {
+		t.Errorf("bestConstruct() seq = %s, want GGGGTTTT", got.seq)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+// nnStackDeltaG is the free energy (kcal/mol, 37°C) of each RNA/RNA nearest-neighbor stack, keyed by the 5'->3'
+// dinucleotide of one strand (T for U).  Values are the Turner parameters of Xia et al. (1998); a stack and its reverse
+// complement (e.g. CT and AG) share a value.
+var nnStackDeltaG = map[string]float64{
+	"AA": -0.93, "TT": -0.93,
+	"AT": -1.10,
+	"TA": -1.33,
+	"CT": -2.08, "AG": -2.08,
+	"CA": -2.11, "TG": -2.11,
+	"GT": -2.24, "AC": -2.24,
+	"GA": -2.35, "TC": -2.35,
+	"CG": -2.36,
+	"GG": -3.26, "CC": -3.26,
+	"GC": -3.42,
+}
+
+// terminalATPenalty is the free energy penalty (kcal/mol) for an A-U pair at a duplex end (Xia et al. 1998)
+const terminalATPenalty = 0.45
+
+// endStabilityLen is the no. of terminal base pairs whose stability decides which strand of an siRNA duplex is
+// loaded into RISC (Schwarz et al. 2003, Khvorova et al. 2003)
+const endStabilityLen = 4
+
+// endDeltaG returns the nearest-neighbor free energy of the first endStabilityLen base pairs at the 5' end of seq, a
+// strand of a perfectly paired duplex.  Lower (more negative) values are more stable.
+func endDeltaG(seq string) float64 {
+	dG := 0.0
+	if isWeak(seq[0]) {
+		dG += terminalATPenalty
+	}
+	for i := 0; i < endStabilityLen-1 && i+2 <= len(seq); i++ {
+		dG += nnStackDeltaG[seq[i:i+2]]
+	}
+	return dG
+}
+
+// endAsymmetry returns the free energy of the 5' end of a kmer's siRNA antisense (guide) strand minus that of the
+// sense strand's 5' end, for the duplex region of the siRNA (see siRNAScorer) or the whole kmer if it is shorter.  A
+// positive value means the antisense 5' end is less stable, so the antisense strand is favored for RISC loading.
+func endAsymmetry(kmer string) float64 {
+	duplex := kmer
+	if len(duplex) > siRNACoreLen {
+		duplex = duplex[len(duplex)-siRNACoreLen:]
+	}
+	return endDeltaG(reverseComplement(duplex)) - endDeltaG(duplex)
+}
+
+// antisenseFavored reports whether the antisense strand of a kmer's siRNA is thermodynamically favored for RISC loading
+func antisenseFavored(kmer string) bool {
+	return endAsymmetry(kmer) > 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_endDeltaG(t *testing.T) {
+	tests := []struct {
+		seq  string
+		want float64
+	}{
+		{"GCGCAAAA", -9.20},     // GC + CG + GC
+		{"AAAAGC", -2.34},       // terminal A-U penalty + 3 AA stacks
+		{"TACGTT", 0.45 - 5.93}, // TA + AC + CG
+	}
+	for _, tt := range tests {
+		if got := endDeltaG(tt.seq); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("endDeltaG(%s) = %v, want %v", tt.seq, got, tt.want)
+		}
+	}
+}
+
+func Test_endAsymmetry(t *testing.T) {
+	tests := []struct {
+		kmer    string
+		want    float64
+		favored bool
+	}{
+		// Stable sense 5' end, weak antisense 5' end
+		{"GCGCAAAAAAAAAAAAAAA", 6.86, true},
+		// Only the 19 nt duplex region is scored
+		{"TTGCGCAAAAAAAAAAAAAAA", 6.86, true},
+		{"AAAAAAAAAAAAAAAGCGC", -6.86, false},
+		// Symmetric ends favor neither strand
+		{"GCGCAAAAAAAAAAAGCGC", 0, false},
+	}
+	for _, tt := range tests {
+		if got := endAsymmetry(tt.kmer); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("endAsymmetry(%s) = %v, want %v", tt.kmer, got, tt.want)
+		}
+		if got := antisenseFavored(tt.kmer); got != tt.favored {
+			t.Errorf("antisenseFavored(%s) = %v, want %v", tt.kmer, got, tt.favored)
+		}
+	}
+}
+
+func Test_kmerStatsAntisenseFavored(t *testing.T) {
+	kmers := [][]string{{"GCGCAAAAAAAAAAAAAAA", "AAAAAAAAAAAAAAAGCGC"}, nil}
+	stats := kmerStats(kmers)
+	if stats[0][4] != 0.5 || stats[1][4] != 0 {
+		t.Errorf("kmerStats() antisense favored = %v, %v, want 0.5, 0", stats[0][4], stats[1][4])
+	}
+}
@@ -36,6 +36,12 @@ func removeOffTargetUint64KmersConcurrent(filename string, goodUint64Kmers map[u
 
 	const chunkSize = 1024 * 64 // 64 KB; adjust as needed
 	kmerSize := binary.Size(uint64(0))
+	var numChunks int64
+	if info, err := file.Stat(); err == nil {
+		numChunks = (info.Size() - int64(kmerSize) + chunkSize - 1) / chunkSize
+	}
+	prog := newProgress("Off-target kmer screen", numChunks, "chunks")
+	defer prog.finish()
 	kmerChan := make(chan []byte, numWorkers)
 	removedKmerChan := make(chan map[string]struct{}, numWorkers)
 
@@ -50,6 +56,7 @@ func removeOffTargetUint64KmersConcurrent(filename string, goodUint64Kmers map[u
 
 			for chunk := range kmerChan {
 				processChunk(chunk, kmerSize, k, goodUint64Kmers, localRemovedKmers)
+				prog.add(1)
 			}
 
 			removedKmerChan <- localRemovedKmers
@@ -126,42 +133,42 @@ func kmerToSequence(kmer uint64, k int) string {
 	return string(sequence)
 }
 
-// removeKmersFromGoodKmers removes kmers (and their reverse complements) from the 'goodKmers' map if they are present in the 'removedKmers' map.
+// removeKmersFromGoodKmers removes kmers (and their reverse complements) from the 'goodKmers' table if they are present in the 'removedKmers' map.
 //
 // Args:
 //
-//	goodKmers: A map where keys are target kmers and values are presence/absence slices.
+//	goodKmers: The table of target kmers.
 //	removedKmers: A map where keys are kmers identified for removal (e.g., off-target kmers).
-func removeKmersFromGoodKmers(goodKmers map[string][]int, removedKmers map[string]struct{}) {
-	for kmer := range goodKmers {
+func removeKmersFromGoodKmers(goodKmers *kmerTable, removedKmers map[string]struct{}) {
+	for _, kmer := range goodKmers.kmers() {
 		_, inRemoved := removedKmers[kmer]
 		rc := reverseComplement(kmer)
 		_, rcInRemoved := removedKmers[rc]
 
 		// If the k-mer or its reverse complement is in removedKmers, delete it from goodKmers
 		if inRemoved || rcInRemoved {
-			delete(goodKmers, kmer)
+			goodKmers.remove(kmer)
 		}
 	}
 }
 
-// convertGoodKmersToUint64Set converts a map of string-based kmers to a map using their canonical uint64 representations (considering reverse complements).
+// convertGoodKmersToUint64Set converts a slice of string-based kmers to a map using their canonical uint64 representations (considering reverse complements).
 //
 // Args:
 //
-//	goodKmers: A map where keys are kmers as strings and values are presence/absence slices.
+//	goodKmers: The kmers as strings.
 //	k: The length of the kmers.
 //
 // Returns:
 //  1. A map[uint64]struct{} where keys are canonical uint64 representations of kmers.
 //  2. An error if any occurs during conversion.
-func convertGoodKmersToUint64Set(goodKmers map[string][]int, k int) (map[uint64]struct{}, error) {
+func convertGoodKmersToUint64Set(goodKmers []string, k int) (map[uint64]struct{}, error) {
 	goodUint64Kmers := make(map[uint64]struct{})
 
 	toShift := uint((k - 1) * 2)         // Number of bit positions to shift for reverse complement
 	mask := (^uint64(0)) >> uint(64-k*2) // Mask to isolate k-mer bits
 
-	for kmer := range goodKmers {
+	for _, kmer := range goodKmers {
 		var next, nextRC uint64 // next for the k-mer, nextRC for its reverse complement
 		for _, b := range []byte(kmer) {
 			val := ((b >> 1) ^ ((b & 4) >> 2)) & 3
@@ -189,14 +196,14 @@ func min(a, b uint64) uint64 {
 //
 // Args:
 //
-//	goodKmers: A map where keys are target kmers as strings and values are presence/absence slices.
+//	goodKmers: The table of target kmers.
 //	offTargetKmersFile: The path to a file containing off-target kmers (likely in uint64 representation).
-//	goodKmerLength: The length of the kmers in the 'goodKmers' map.
+//	goodKmerLength: The length of the kmers in the 'goodKmers' table.
 //
 // Returns:
 //
 //	An error if any occurs during the filtering process
-func removeOffTargetKmersFromGoodKmers(goodKmers map[string][]int, offTargetKmersFile string, goodKmerLength int) error {
+func removeOffTargetKmersFromGoodKmers(goodKmers *kmerTable, offTargetKmersFile string, goodKmerLength int) error {
 	file, err := os.Open(offTargetKmersFile)
 	if err != nil {
 		return fmt.Errorf("error opening file: %v", err)
@@ -218,7 +225,7 @@ func removeOffTargetKmersFromGoodKmers(goodKmers map[string][]int, offTargetKmer
 		removeOffTargetSubKmersFromGoodKmers(goodKmers, offTargetKmersFile, OTKmerLen)
 	default:
 		// Convert the good k-mers to canonical uint64 representation
-		goodUint64Kmers, err := convertGoodKmersToUint64Set(goodKmers, goodKmerLength)
+		goodUint64Kmers, err := convertGoodKmersToUint64Set(goodKmers.kmers(), goodKmerLength)
 		if err != nil {
 			return err
 		}
@@ -229,7 +236,7 @@ func removeOffTargetKmersFromGoodKmers(goodKmers map[string][]int, offTargetKmer
 			return err
 		}
 
-		// Remove the k-mers found in removedKmers from the original goodKmers map
+		// Remove the k-mers found in removedKmers from the original goodKmers table
 		removeKmersFromGoodKmers(goodKmers, removedKmers)
 		log.Printf("Total off-target-matching kmers removed: %d\n\n", len(removedKmers))
 	}
@@ -239,17 +246,17 @@ func removeOffTargetKmersFromGoodKmers(goodKmers map[string][]int, offTargetKmer
 // removeOffTargetSubKmersFromGoodKmers removes off-target subkmers from a set of good kmers (string-based) using a file of off-target kmer references.
 //
 // Parameters:
-//   - goodKmers: A map where keys are target kmers as strings and values are presence/absence slices.
+//   - goodKmers: The table of target kmers.
 //   - offTargetKmersFile: The path to a file containing off-target kmers (likely in uint64 representation).
 //   - subKmerLength: The length of the subkmers to consider.
 //
 // Returns:
 //   - An error if any occurs during the filtering process.
-func removeOffTargetSubKmersFromGoodKmers(goodKmers map[string][]int, offTargetKmersFile string, subKmerLength int) error {
+func removeOffTargetSubKmersFromGoodKmers(goodKmers *kmerTable, offTargetKmersFile string, subKmerLength int) error {
 	// Convert the good k-mers to canonical uint64 representation
-	ori_len := len(goodKmers)
+	ori_len := goodKmers.len()
 
-	goodSubKmers := generateSubkmers(goodKmers, subKmerLength)
+	goodSubKmers := generateSubkmers(goodKmers.kmers(), subKmerLength)
 
 	goodUint64Kmers, err := convertGoodKmersToUint64Set(goodSubKmers, subKmerLength)
 	if err != nil {
@@ -262,27 +269,95 @@ func removeOffTargetSubKmersFromGoodKmers(goodKmers map[string][]int, offTargetK
 		return err
 	}
 
-	// Remove the k-mers found in removedKmers from the original goodKmers map
+	// Remove the k-mers found in removedKmers from the original goodKmers table
 	removeSubKmersFromGoodKmers(goodKmers, removedKmers)
-	log.Printf("Total off-target-matching kmers removed: %d\n\n", ori_len-len(goodKmers))
+	log.Printf("Total off-target-matching kmers removed: %d\n\n", ori_len-goodKmers.len())
+	return nil
+}
+
+// removeOffTargetSeedKmersFromGoodKmers removes target kmers whose seed region (plus seedExtra 3' positions) on either strand
+// matches an off-target in a kmer file.  When the kmer file's kmer length is shorter than the seed match length, a seed match
+// is called if any of its off-target length windows is present in the file.
+//
+// Args:
+//
+//	goodKmers: The table of target kmers.
+//	offTargetKmersFile: The path to a file containing off-target kmers (uint64 representation).
+//	seedExtra: The no. of guide positions 3' of the seed region to include.
+//
+// Returns:
+//
+//	An error if any occurs during the filtering process
+func removeOffTargetSeedKmersFromGoodKmers(goodKmers *kmerTable, offTargetKmersFile string, seedExtra int) error {
+	file, err := os.Open(offTargetKmersFile)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	var k64 uint64
+	err = binary.Read(file, binary.LittleEndian, &k64)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("error reading kmer length: %v", err)
+	}
+	OTKmerLen := int(k64)
+	seedKmerLen := seedRegionLen + seedExtra
+	log.Println("OT kmer length: ", OTKmerLen)
+	if OTKmerLen > seedKmerLen {
+		return fmt.Errorf("off-target kmer length (%d) is greater than the seed match length (%d) - it must be equal or lower", OTKmerLen, seedKmerLen)
+	}
+	ori_len := goodKmers.len()
+
+	seedKmers := GenerateSeedRegionKmersMap(goodKmers.kmers(), seedExtra)
+	seeds := make([]string, 0, len(seedKmers))
+	for seed := range seedKmers {
+		seeds = append(seeds, seed)
+	}
+	windowSeeds := GenerateSubKmersMap(seeds, OTKmerLen)
+	windows := generateSubkmers(seeds, OTKmerLen)
+
+	goodUint64Kmers, err := convertGoodKmersToUint64Set(windows, OTKmerLen)
+	if err != nil {
+		return err
+	}
+
+	// Read off-target k-mers and build a map of removed (canonical) windows
+	removedKmers, err := removeOffTargetUint64KmersConcurrent(offTargetKmersFile, goodUint64Kmers, 32)
+	if err != nil {
+		return err
+	}
+
+	for removed := range removedKmers {
+		for _, window := range []string{removed, reverseComplement(removed)} {
+			for _, seed := range windowSeeds[window] {
+				for _, kmer := range seedKmers[seed] {
+					goodKmers.remove(kmer)
+				}
+			}
+		}
+	}
+	log.Printf("Total off-target seed-matching kmers removed: %d\n\n", ori_len-goodKmers.len())
 	return nil
 }
 
 // generateSubkmers generates all subkmers of a given length from a set of kmers.
 //
 // Parameters:
-//   - goodKmers: A map where keys are kmers as strings and values are presence/absence slices.
+//   - goodKmers: The kmers as strings.
 //   - subkmerLength: The length of the subkmers to generate.
 //
 // Returns:
-//   - A map where keys are the generated subkmers and values are nil.
-func generateSubkmers(goodKmers map[string][]int, subkmerLength int) map[string][]int {
-	subkmers := make(map[string][]int)
+//   - The distinct generated subkmers.
+func generateSubkmers(goodKmers []string, subkmerLength int) []string {
+	seen := make(map[string]struct{})
+	var subkmers []string
 
-	for kmer := range goodKmers {
+	for _, kmer := range goodKmers {
 		for i := 0; i <= len(kmer)-subkmerLength; i++ {
 			subkmer := kmer[i : i+subkmerLength]
-			subkmers[subkmer] = nil // Explicitly setting value to nil for each subkmer key
+			if _, ok := seen[subkmer]; !ok {
+				seen[subkmer] = struct{}{}
+				subkmers = append(subkmers, subkmer)
+			}
 		}
 	}
 
@@ -292,13 +367,13 @@ func generateSubkmers(goodKmers map[string][]int, subkmerLength int) map[string]
 // removeSubKmersFromGoodKmers removes entries from goodKmers whose keys contain any subkmer from subkmers.
 //
 // Parameters:
-//   - goodKmers: A map where keys are target kmers and values are presence/absence slices.
+//   - goodKmers: The table of target kmers.
 //   - subkmers: A map where keys are subkmers to be removed from goodKmers.
-func removeSubKmersFromGoodKmers(goodKmers map[string][]int, subkmers map[string]struct{}) {
-	for kmer := range goodKmers {
+func removeSubKmersFromGoodKmers(goodKmers *kmerTable, subkmers map[string]struct{}) {
+	for _, kmer := range goodKmers.kmers() {
 		for subkmer := range subkmers {
 			if strings.Contains(kmer, subkmer) || strings.Contains(kmer, reverseComplement(subkmer)) {
-				delete(goodKmers, kmer)
+				goodKmers.remove(kmer)
 				break
 			}
 		}
@@ -9,11 +9,7 @@ func TestRemoveOffTargetUint64KmersConcurrent(t *testing.T) {
 	// Create a temporary file for testing
 
 	// Define the goodUint64Kmers map
-	goodUint64Kmers, _ := convertGoodKmersToUint64Set(map[string][]int{
-		"AAAT": {},
-		"TTGC": {},
-		"AAAC": {},
-	}, 4)
+	goodUint64Kmers, _ := convertGoodKmersToUint64Set([]string{"AAAT", "TTGC", "AAAC"}, 4)
 	for kmer := range goodUint64Kmers {
 		seq := kmerToSequence(kmer, 4)
 		t.Logf("Good k-mer: %s", seq)
@@ -41,27 +37,46 @@ func TestRemoveOffTargetUint64KmersConcurrent(t *testing.T) {
 
 func TestRemoveSubKmersFromGoodKmers(t *testing.T) {
 	// Define the goodKmers map
-	goodKmers := map[string][]int{
-		"AAAT": {},
-		"TTGC": {},
-		"AAAC": {},
-	}
+	goodKmers := testKmerTable(map[string][]int{
+		"AAAT": {1},
+		"TTGC": {1},
+		"AAAC": {1},
+	})
 	// Call the function with test data
 	removeOffTargetKmersFromGoodKmers(goodKmers, "testData/test_sub.kmer", 4)
 	// Check the expected goodKmers
 	expectedGoodKmers := map[string][]int{
-		"TTGC": {},
+		"TTGC": {1},
 	}
-	if len(goodKmers) != len(expectedGoodKmers) {
-		t.Errorf("Unexpected number of good k-mers. Got: %d, Want: %d", len(goodKmers), len(expectedGoodKmers))
+	if goodKmers.len() != len(expectedGoodKmers) {
+		t.Errorf("Unexpected number of good k-mers. Got: %d, Want: %d", goodKmers.len(), len(expectedGoodKmers))
 	}
 	for kmer := range expectedGoodKmers {
-		if _, found := goodKmers[kmer]; !found {
+		if !goodKmers.has(kmer) {
 			t.Errorf("Expected k-mer not found in good k-mers: %s", kmer)
 		}
 	}
 }
 
+func TestRemoveOffTargetSeedKmersFromGoodKmers(t *testing.T) {
+	// testData/test.kmer holds the 4nt kmers AAAC, GCAA and TTTT
+	goodKmers := testKmerTable(map[string][]int{
+		"GCGCGCGCGC": {1},
+		"CGCGCGTTTA": {1}, // reverse complement TAAACGCGCG has AAAC in its seed region
+		"AAACGCGCGC": {1}, // AAAC at guide position 1 is outside the seed region
+	})
+	if err := removeOffTargetSeedKmersFromGoodKmers(goodKmers, "testData/test.kmer", 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedGoodKmers := map[string][]int{
+		"GCGCGCGCGC": {1},
+		"AAACGCGCGC": {1},
+	}
+	if got := tablePresence(goodKmers); !reflect.DeepEqual(got, expectedGoodKmers) {
+		t.Errorf("unexpected result\nexpected: %v\ngot: %v", expectedGoodKmers, got)
+	}
+}
+
 func Test_removeKmersFromGoodKmers(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -72,9 +87,9 @@ func Test_removeKmersFromGoodKmers(t *testing.T) {
 		{
 			name: "Remove k-mers present in removedKmers",
 			goodKmers: map[string][]int{
-				"ATCG": {1, 2, 3},
-				"CGAT": {4, 5, 6},
-				"TGCA": {7, 8, 9},
+				"ATCG": {1, 0, 1},
+				"CGAT": {0, 1, 1},
+				"TGCA": {1, 1, 0},
 			},
 			removedKmers: map[string]struct{}{
 				"ATCG": {},
@@ -85,24 +100,25 @@ func Test_removeKmersFromGoodKmers(t *testing.T) {
 		{
 			name: "No k-mers to remove",
 			goodKmers: map[string][]int{
-				"ATCG": {1, 2, 3},
-				"CGAT": {4, 5, 6},
+				"ATCG": {1, 0, 1},
+				"CGAT": {0, 1, 1},
 			},
 			removedKmers: map[string]struct{}{
 				"TGCA": {},
 			},
 			expected: map[string][]int{
-				"ATCG": {1, 2, 3},
-				"CGAT": {4, 5, 6},
+				"ATCG": {1, 0, 1},
+				"CGAT": {0, 1, 1},
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			removeKmersFromGoodKmers(tt.goodKmers, tt.removedKmers)
-			if !reflect.DeepEqual(tt.goodKmers, tt.expected) {
-				t.Errorf("unexpected result\nexpected: %v\ngot: %v", tt.expected, tt.goodKmers)
+			goodKmers := testKmerTable(tt.goodKmers)
+			removeKmersFromGoodKmers(goodKmers, tt.removedKmers)
+			if got := tablePresence(goodKmers); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("unexpected result\nexpected: %v\ngot: %v", tt.expected, got)
 			}
 		})
 	}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// uniformWeights returns a weight of 1 for each of n target sequences
+func uniformWeights(n int) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return weights
+}
+
+// loadTargetWeights reads a tab-separated file of target header, weight and (optionally) the minimum no. of matching kmers
+// required for that target.  Targets not listed keep a weight of 1 and no minimum.  Blank lines and lines starting with '#'
+// are skipped.
+//
+// Args:
+//
+//	fileName: The path to the weights TSV file.
+//	ref: A slice of HeaderRef structures containing the target sequences.
+//
+// Returns:
+//
+//	A slice of weights and a slice of minimum kmer hits, each in target order, or an error if the file can't be read,
+//	is malformed, or names a header not present in the targets.
+func loadTargetWeights(fileName string, ref []*HeaderRef) ([]float64, []int, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening weights file: %v", err)
+	}
+	defer f.Close()
+
+	targetIndices := make(map[string][]int)
+	for i, hr := range ref {
+		targetIndices[hr.Header] = append(targetIndices[hr.Header], i)
+	}
+	weights := uniformWeights(len(ref))
+	minHits := make([]int, len(ref))
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, nil, fmt.Errorf("weights file line %d: expected header<TAB>weight[<TAB>min kmer hits]", lineNo)
+		}
+		indices, ok := targetIndices[fields[0]]
+		if !ok {
+			return nil, nil, fmt.Errorf("weights file line %d: header '%s' not present in target file", lineNo, fields[0])
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil || weight < 0 {
+			return nil, nil, fmt.Errorf("weights file line %d: weight must be a number >= 0", lineNo)
+		}
+		minHit := 0
+		if len(fields) == 3 {
+			minHit, err = strconv.Atoi(strings.TrimSpace(fields[2]))
+			if err != nil || minHit < 0 {
+				return nil, nil, fmt.Errorf("weights file line %d: min kmer hits must be an integer >= 0", lineNo)
+			}
+		}
+		for _, i := range indices {
+			weights[i] = weight
+			minHits[i] = minHit
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return weights, minHits, nil
+}
+
+// biasWeights adds the bias level to the weight of the selected target sequence.  This biases kmer selection
+// toward that sequence at the cost of the overall objective, as adding that many extra copies of it would.
+func biasWeights(weights []float64, ref []*HeaderRef, header string, bias int) error {
+	headerPresent := false
+	for i, hr := range ref {
+		if hr.Header == header {
+			headerPresent = true
+			weights[i] += float64(bias)
+		}
+	}
+	if !headerPresent {
+		return errors.New("bias reference header not present in input file")
+	}
+	return nil
+}
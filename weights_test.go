@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadTargetWeights(t *testing.T) {
+	ref := RefLoad("./testData/testRef.fa")
+	tests := []struct {
+		name        string
+		content     string
+		wantWeights []float64
+		wantMinHits []int
+		wantErr     bool
+	}{
+		{
+			name:        "weightsAndMinHits",
+			content:     "",
+			wantWeights: []float64{2.5, 1, 0},
+			wantMinHits: []int{0, 0, 4},
+		},
+		{name: "unknownHeader", content: "ref_4\t1\n", wantErr: true},
+		{name: "badWeight", content: "ref_1\tx\n", wantErr: true},
+		{name: "negativeWeight", content: "ref_1\t-1\n", wantErr: true},
+		{name: "badMinHits", content: "ref_1\t1\t1.5\n", wantErr: true},
+		{name: "tooManyFields", content: "ref_1\t1\t1\t1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := "./testData/testWeights.tsv"
+			if tt.content != "" {
+				fileName = filepath.Join(t.TempDir(), "weights.tsv")
+				if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("Failed to write temp file: %v", err)
+				}
+			}
+			weights, minHits, err := loadTargetWeights(fileName, ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTargetWeights() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(weights, tt.wantWeights) {
+				t.Errorf("loadTargetWeights() weights = %v, want %v", weights, tt.wantWeights)
+			}
+			if !reflect.DeepEqual(minHits, tt.wantMinHits) {
+				t.Errorf("loadTargetWeights() minHits = %v, want %v", minHits, tt.wantMinHits)
+			}
+		})
+	}
+}
+
+func Test_biasWeights(t *testing.T) {
+	ref := []*HeaderRef{{"a", "ACGT", "ACGT"}, {"b", "ACGT", "ACGT"}}
+	tests := []struct {
+		name    string
+		header  string
+		bias    int
+		want    []float64
+		wantErr bool
+	}{
+		{name: "present", header: "b", bias: 2, want: []float64{1, 3}},
+		{name: "absent", header: "c", bias: 2, want: []float64{1, 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights := uniformWeights(len(ref))
+			err := biasWeights(weights, ref, tt.header, tt.bias)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("biasWeights() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(weights, tt.want) {
+				t.Errorf("biasWeights() = %v, want %v", weights, tt.want)
+			}
+		})
+	}
+}
+
+// Test_bestConstructMinHits checks windows that don't meet a target's min. kmer hits are skipped
+func Test_bestConstructMinHits(t *testing.T) {
+	goodKmers := testKmerTable(map[string][]int{
+		"AAAA": {1, 0},
+		"AAAC": {1, 0},
+		"AACC": {1, 0},
+		"ACCG": {0, 1},
+		"CCGT": {0, 1},
+	})
+	tests := []struct {
+		name    string
+		minHits []int
+		want    string
+	}{
+		{name: "noMinimum", minHits: nil, want: "AAAACC"},
+		{name: "minimumForSecondTarget", minHits: []int{0, 2}, want: "AACCGT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := searchParams{kmerLen: 4, seqLen: 2, constructLen: 6, obj: objective{name: "mean"}, minHits: tt.minHits}
+			got, _ := bestConstruct(goodKmers, "AAAACCGTTT", p)
+			if got.seq != tt.want {
+				t.Errorf("bestConstruct() = %v, want %v", got.seq, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sync"
+)
+
+// maxWobbleKmerLen is the longest off-target match length supported by the wobble index's uint64 purine/pyrimidine patterns
+const maxWobbleKmerLen = 64
+
+// wobbleIndex indexes target (sub)kmers by their purine/pyrimidine pattern.  G:U wobble-compatible differences are
+// always transitions (A<->G or C<->T), so an off-target kmer can only be a wobble match to target kmers sharing its pattern.
+type wobbleIndex struct {
+	kmers     []string         // indexed (sub)kmers
+	longKmers [][]string       // target kmers containing each indexed (sub)kmer
+	patterns  map[uint64][]int // purine/pyrimidine pattern -> ids of indexed kmers
+	kmerLen   int
+	mask      uint64
+}
+
+// wobbleHits holds the ids of indexed kmers with exact and wobble-only off-target matches
+type wobbleHits struct {
+	exact  map[int]struct{}
+	wobble map[int]struct{}
+}
+
+// pyrimidineBit returns 1 for a pyrimidine (C/T), 0 for a purine (A/G), and false for any other nucleotide
+func pyrimidineBit(nuc byte) (uint64, bool) {
+	switch nuc {
+	case 'A', 'G':
+		return 0, true
+	case 'C', 'T':
+		return 1, true
+	default:
+		return 0, false
+	}
+}
+
+// newWobbleIndex builds a wobbleIndex from a map of sub-kmers to the target kmers containing them (see GenerateSubKmersMap).
+// Sub-kmers containing nucleotides other than ACGT are not indexed.
+//
+// Args:
+//
+//	subKmers: A map where keys are sub-kmers and values are lists of the original kmers containing them.
+//	subKmerLen: The length of the sub-kmers (<= maxWobbleKmerLen).
+//
+// Returns:
+//
+//	A pointer to the populated wobbleIndex.
+func newWobbleIndex(subKmers map[string][]string, subKmerLen int) *wobbleIndex {
+	idx := &wobbleIndex{
+		patterns: make(map[uint64][]int),
+		kmerLen:  subKmerLen,
+		mask:     ^uint64(0) >> uint(64-subKmerLen),
+	}
+	for subKmer, longKmers := range subKmers {
+		var pattern uint64
+		valid := true
+		for i := 0; i < len(subKmer) && valid; i++ {
+			var bit uint64
+			bit, valid = pyrimidineBit(subKmer[i])
+			pattern = (pattern << 1) | bit
+		}
+		if !valid {
+			continue
+		}
+		id := len(idx.kmers)
+		idx.kmers = append(idx.kmers, subKmer)
+		idx.longKmers = append(idx.longKmers, longKmers)
+		idx.patterns[pattern] = append(idx.patterns[pattern], id)
+	}
+	return idx
+}
+
+// wobbleCompatible reports whether a target kmer and an equal-length off-target kmer differ only at G:U wobble positions.
+// For a forward (same strand) comparison, the kmer's reverse complement is the guide: guide G pairs with mRNA U (kmer C,
+// off-target T) and guide U pairs with mRNA G (kmer A, off-target G).  For a comparison against the reverse complement of
+// an off-target, the kmer itself is the guide, giving kmer G/off-target A and kmer T/off-target C.
+func wobbleCompatible(kmer string, otKmer string, forward bool) bool {
+	for i := 0; i < len(kmer); i++ {
+		k, o := kmer[i], otKmer[i]
+		switch {
+		case k == o:
+		case forward && ((k == 'C' && o == 'T') || (k == 'A' && o == 'G')):
+		case !forward && ((k == 'G' && o == 'A') || (k == 'T' && o == 'C')):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// wobbleKmerCheckSeqs scans off-target sequences (and their reverse complements) for kmers matching a target (sub)kmer
+// exactly or with G:U wobble pairing only.  The ids of matched indexed kmers are sent through a channel.
+//
+// Args:
+//
+//	seqChan: A channel receiving off-target sequence records.
+//	idx: The wobbleIndex of target (sub)kmers.
+//	wg: A WaitGroup for synchronization with the main process.
+//	toDeleteChan: A channel for sending exact and wobble-only matched ids.
+//	rec: Collects each match for the off-target report (nil if not reporting).
+func wobbleKmerCheckSeqs(seqChan <-chan seqRecord, idx *wobbleIndex, wg *sync.WaitGroup, toDeleteChan chan<- wobbleHits, rec *otRecorder) {
+	defer wg.Done()
+
+	hits := wobbleHits{make(map[int]struct{}), make(map[int]struct{})}
+	var reported []otHit
+
+	for record := range seqChan {
+		// Compute the reverse complement of the entire sequence once
+		rcSeq := reverseComplement(record.seq)
+
+		// Iterate over the original sequence and the reverse complement
+		for strand, s := range []string{record.seq, rcSeq} {
+			var pattern uint64
+			valid := 0 // no. of consecutive ACGT nucleotides ending at pos
+			for pos := 0; pos < len(s); pos++ {
+				bit, ok := pyrimidineBit(s[pos])
+				if !ok {
+					valid = 0
+					continue
+				}
+				pattern = ((pattern << 1) | bit) & idx.mask
+				valid++
+				if valid < idx.kmerLen {
+					continue
+				}
+				otKmer := s[pos-idx.kmerLen+1 : pos+1]
+				for _, id := range idx.patterns[pattern] {
+					switch {
+					case idx.kmers[id] == otKmer:
+						hits.exact[id] = struct{}{}
+					case wobbleCompatible(idx.kmers[id], otKmer, strand == 0):
+						hits.wobble[id] = struct{}{}
+					default:
+						continue
+					}
+					if rec != nil {
+						for _, longKmer := range idx.longKmers[id] {
+							reported = append(reported, newOTHit(longKmer, otKmer, record, strand, pos-idx.kmerLen+1))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Send the matched ids to the channel
+	rec.add(reported)
+	toDeleteChan <- hits
+}
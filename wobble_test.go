@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_wobbleCompatible(t *testing.T) {
+	tests := []struct {
+		name    string
+		kmer    string
+		otKmer  string
+		forward bool
+		want    bool
+	}{
+		{name: "identical", kmer: "ACGT", otKmer: "ACGT", forward: true, want: true},
+		{name: "forwardCtoT", kmer: "ACGT", otKmer: "ATGT", forward: true, want: true},
+		{name: "forwardAtoG", kmer: "ACGT", otKmer: "GCGT", forward: true, want: true},
+		{name: "forwardGtoA", kmer: "ACGT", otKmer: "ACAT", forward: true, want: false},
+		{name: "reverseGtoA", kmer: "ACGT", otKmer: "ACAT", forward: false, want: true},
+		{name: "reverseTtoC", kmer: "ACGT", otKmer: "ACGC", forward: false, want: true},
+		{name: "reverseCtoT", kmer: "ACGT", otKmer: "ATGT", forward: false, want: false},
+		{name: "transversion", kmer: "ACGT", otKmer: "ACGA", forward: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wobbleCompatible(tt.kmer, tt.otKmer, tt.forward); got != tt.want {
+				t.Errorf("wobbleCompatible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConcurrentlyProcessSequencesWobble checks wobble-compatible kmers are removed in either orientation
+func TestConcurrentlyProcessSequencesWobble(t *testing.T) {
+	refFile := createTempFastaFile([]string{
+		">ot1",
+		"TCGACCAANNGGTTGGTTNNACACACAT", // CCAACCAA with forward wobbles, GGTTGGTT exact, reverse complement of GTGTGTGT with a G:A wobble
+	}, t)
+	defer os.Remove(refFile)
+
+	tests := []struct {
+		name   string
+		policy otPolicy
+		want   []string
+	}{
+		{name: "exactOnly", policy: otPolicy{kmerLen: 8}, want: []string{"CCAACCAA", "GTGTGTGT", "GGGGCCCC"}},
+		{name: "wobble", policy: otPolicy{kmerLen: 8, wobble: true}, want: []string{"GGGGCCCC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodKmers := testKmerTable(map[string][]int{
+				"CCAACCAA": {1},
+				"GGTTGGTT": {1},
+				"GTGTGTGT": {1},
+				"GGGGCCCC": {1},
+			})
+			ConcurrentlyProcessSequences([]string{refFile}, goodKmers, 8, tt.policy, nil)
+			if goodKmers.len() != len(tt.want) {
+				t.Errorf("got %d goodKmers; want %d", goodKmers.len(), len(tt.want))
+			}
+			for _, kmer := range tt.want {
+				if !goodKmers.has(kmer) {
+					t.Errorf("expected kmer %s to be present; it was not", kmer)
+				}
+			}
+		})
+	}
+}